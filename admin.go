@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	auditSimulate = "/audit/simulate"
+
+	maxSimulateRequestBytes = 10 << 20
+)
+
+// AdminServer serves the endpoints that act on the agent, it only listens on
+// the loopback interface so they're reachable from inside the pod only
+type AdminServer struct {
+	address string
+
+	// RunCommand runs a command registered in the agent as if the gateway sent it
+	RunCommand agent.CommandHandler
+}
+
+func NewAdminServer(port string) *AdminServer {
+	return &AdminServer{
+		address: net.JoinHostPort("127.0.0.1", port),
+	}
+}
+
+func (s *AdminServer) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(auditSimulate, s.auditSimulateHandler)
+
+	logger.Infow("Starting admin server....", "address", s.address)
+	return http.ListenAndServe(s.address, mux)
+}
+
+// auditSimulateHandler runs the simulate command with a proto.PacketSimulateRequest body
+func (s *AdminServer) auditSimulateHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.RunCommand == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxSimulateRequestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := s.RunCommand(&agent.CommandRequest{
+		ID:      uuid.NewV4(),
+		Name:    agent.CommandSimulate,
+		Payload: body,
+	})
+	if result.State != agent.CommandStateSucceeded {
+		http.Error(w, result.Error, http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, result.Response)
+}
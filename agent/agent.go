@@ -3,8 +3,10 @@ package agent
 import (
 	"context"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/MagalixTechnologies/core/logger"
 	"github.com/MagalixTechnologies/uuid-go"
 	"golang.org/x/sync/errgroup"
 )
@@ -24,39 +26,60 @@ type Agent struct {
 	Gateway        Gateway
 	Auditor        Auditor
 
+	// Commands the commands the gateway can run, more can be registered before Start
+	Commands *Commands
+
 	changeLogLevel ChangeLogLevelHandler
 
+	// shutdownTimeout max time to wait for sources to stop and pending data to be sent on shutdown
+	shutdownTimeout time.Duration
+
+	// the contexts are made by New so a shutdown before Start stops it too
+	allCtx        context.Context
 	cancelAll     context.CancelFunc
+	sourcesCtx    context.Context
 	cancelSources context.CancelFunc
+	sinksCtx      context.Context
 	cancelSinks   context.CancelFunc
+	// sourcesDone is closed once all sources returned
+	sourcesDone chan struct{}
+	shutdown    sync.Once
 }
 
-func New(entitiesSource EntitiesSource, gateway Gateway, logLevelHandler ChangeLogLevelHandler, auditor Auditor) *Agent {
-	return &Agent{
-		EntitiesSource: entitiesSource,
-		Gateway:        gateway,
-		changeLogLevel: logLevelHandler,
-		Auditor:        auditor,
+func New(
+	entitiesSource EntitiesSource,
+	gateway Gateway,
+	logLevelHandler ChangeLogLevelHandler,
+	auditor Auditor,
+	shutdownTimeout time.Duration,
+) *Agent {
+	a := &Agent{
+		EntitiesSource:  entitiesSource,
+		Gateway:         gateway,
+		Commands:        NewCommands(),
+		changeLogLevel:  logLevelHandler,
+		Auditor:         auditor,
+		shutdownTimeout: shutdownTimeout,
 	}
+	a.allCtx, a.cancelAll = context.WithCancel(context.Background())
+	a.sourcesCtx, a.cancelSources = context.WithCancel(a.allCtx)
+	a.sinksCtx, a.cancelSinks = context.WithCancel(a.allCtx)
+	a.registerCommands()
+	return a
 }
 
 func (a *Agent) Start() error {
-	allCtx, cancelAll := context.WithCancel(context.Background())
-	a.cancelAll = cancelAll
-	defer a.cancelAll()
-
-	sourcesCtx, cancelSources := context.WithCancel(allCtx)
-	a.cancelSources = cancelSources
-	sinksCtx, cancelSinks := context.WithCancel(allCtx)
-	a.cancelSinks = cancelSinks
+	allCtx, sourcesCtx, sinksCtx := a.allCtx, a.sourcesCtx, a.sinksCtx
+	defer a.Stop()
 
 	a.Auditor.SetAuditResultHandler(a.handleAuditResult)
+	a.EntitiesSource.SetSyncStatusHandler(a.handleSyncStatus)
+	a.EntitiesSource.SetDeltasHandler(a.handleDeltas)
 
 	// Initialize and authenticate gateway
-	a.Gateway.SetAuditCommandHandler(a.Auditor.HandleAuditCommand)
-	a.Gateway.SetConstraintsHandler(a.Auditor.HandleConstraints)
-	a.Gateway.SetRestartHandler(a.handleRestart)
-	a.Gateway.SetChangeLogLevelHandler(a.handleLogLevelChange)
+	a.Commands.SetResultHandler(a.Gateway.SendCommandResult)
+	a.Gateway.SetCommandHandler(a.Commands.Execute)
+	a.Gateway.SetSuspendHandler(a.handleSuspend)
 
 	eg, _ := errgroup.WithContext(allCtx)
 
@@ -64,45 +87,99 @@ func (a *Agent) Start() error {
 	eg.Go(func() error { return a.Gateway.Start(sinksCtx) })
 
 	// Blocks until authorized. Uses a long timeout to slowdown agents that are no longer authorized.
-	err := a.Gateway.WaitAuthorization(AuthorizationTimeoutDuration)
+	err := a.Gateway.WaitAuthorization(allCtx, AuthorizationTimeoutDuration)
 	if err != nil {
+		if allCtx.Err() != nil {
+			logger.Info("agent stopped before it was authorized")
+			return nil
+		}
 		return err
 	}
 
-	eg.Go(func() error { return a.EntitiesSource.Start(sourcesCtx) })
-	eg.Go(func() error { return a.Auditor.Start(sourcesCtx) })
+	var sources sync.WaitGroup
+	sources.Add(2)
+	sourcesDone := make(chan struct{})
+	a.sourcesDone = sourcesDone
+	go func() {
+		sources.Wait()
+		close(sourcesDone)
+	}()
+
+	eg.Go(func() error {
+		defer sources.Done()
+		return a.EntitiesSource.Start(sourcesCtx)
+	})
+	eg.Go(func() error {
+		defer sources.Done()
+		return a.Auditor.Start(sourcesCtx)
+	})
 
 	return eg.Wait()
 }
 
 func (a *Agent) stopSources() error {
-	if a.cancelSources == nil {
-		return nil
-	}
 	a.cancelSources()
-	a.cancelSources = nil
 	return nil
 }
 
-func (a *Agent) stopSinks() error {
-	if a.cancelSinks == nil {
-		return nil
+// waitSources waits for the sources to return after they're stopped,
+// the auditor finishes its current batch and the entities source flushes its deltas
+func (a *Agent) waitSources(ctx context.Context) {
+	if a.sourcesDone == nil {
+		return
+	}
+	select {
+	case <-a.sourcesDone:
+	case <-ctx.Done():
+		logger.Warn("sources didn't stop in time")
 	}
+}
+
+func (a *Agent) stopSinks() error {
 	a.cancelSinks()
-	a.cancelSinks = nil
 	return nil
 }
 
 func (a *Agent) Stop() error {
-	if a.cancelAll == nil {
-		return nil
-	}
 	a.cancelAll()
-	a.cancelAll = nil
 	// TODO There's no way to know if workers exited with an error
 	return nil
 }
 
+// Shutdown stops the agent in order: the sources are stopped and waited for,
+// the data they sent to the gateway is drained, a bye is sent with the reason
+// and finally the gateway is stopped. Only the first call has an effect.
+func (a *Agent) Shutdown(reason string) error {
+	a.shutdown.Do(func() {
+		a.drain(reason)
+	})
+	return a.Stop()
+}
+
+// drain stops the sources and sends everything pending to the gateway before
+// saying bye, waiting for shutdownTimeout at most
+func (a *Agent) drain(reason string) {
+	logger.Infow("shutting down", "reason", reason, "timeout", a.shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := a.stopSources(); err != nil {
+		logger.Errorw("failed to stop agent sources", "error", err)
+	}
+	a.waitSources(ctx)
+
+	if err := a.Gateway.Sync(ctx); err != nil {
+		logger.Warnw("unable to send all pending data before shutdown", "error", err)
+	}
+	if err := a.Gateway.SendBye(reason); err != nil {
+		logger.Warnw("unable to say bye to the gateway", "error", err)
+	}
+
+	if err := a.stopSinks(); err != nil {
+		logger.Errorw("failed to stop agent sinks", "error", err)
+	}
+}
+
 func (a *Agent) Exit(exitCode int) {
 	os.Exit(exitCode)
 }
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// unauthorizedGateway never authorizes the agent, like a suspended one
+type unauthorizedGateway struct{}
+
+func (unauthorizedGateway) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (unauthorizedGateway) WaitAuthorization(ctx context.Context, timeout time.Duration) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (unauthorizedGateway) Sync(ctx context.Context) error                            { return nil }
+func (unauthorizedGateway) SendBye(reason string) error                               { return nil }
+func (unauthorizedGateway) SendAuditResults(auditResult []*AuditResult) error         { return nil }
+func (unauthorizedGateway) SendSyncStatus(statuses []*ResourceSyncStatus) error       { return nil }
+func (unauthorizedGateway) SendEntitiesDeltas(deltas []*Delta, done DeltasDone) error { return nil }
+func (unauthorizedGateway) SendCommandResult(result *CommandResult) error             { return nil }
+func (unauthorizedGateway) SetCommandHandler(handler CommandHandler)                  {}
+func (unauthorizedGateway) SetSuspendHandler(handler SuspendHandler)                  {}
+
+type idleSource struct{}
+
+func (idleSource) Start(ctx context.Context) error                  { <-ctx.Done(); return nil }
+func (idleSource) Stop() error                                      { return nil }
+func (idleSource) Pause()                                           {}
+func (idleSource) Resume()                                          {}
+func (idleSource) SetSyncStatusHandler(handler SyncStatusHandler)   {}
+func (idleSource) SetDeltasHandler(handler DeltasHandler)           {}
+func (idleSource) HandleConstraints([]*Constraint) map[string]error { return nil }
+func (idleSource) HandleAuditCommand(AuditFilter) (string, error)   { return "", nil }
+func (idleSource) Simulate([]*Constraint, int) (*Simulation, error) { return nil, nil }
+func (idleSource) SetAuditResultHandler(handler AuditResultHandler) {}
+
+func TestAgent_ShutdownBeforeAuthorization(t *testing.T) {
+	tests := []struct {
+		name          string
+		shutdownFirst bool
+	}{
+		{name: "while waiting for authorization"},
+		{name: "before start", shutdownFirst: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(idleSource{}, unauthorizedGateway{}, nil, idleSource{}, time.Second)
+			if tt.shutdownFirst {
+				if err := a.Shutdown("test"); err != nil {
+					t.Fatalf("Shutdown() error = %v", err)
+				}
+			}
+
+			started := make(chan error, 1)
+			go func() { started <- a.Start() }()
+			if !tt.shutdownFirst {
+				time.Sleep(10 * time.Millisecond)
+				if err := a.Shutdown("test"); err != nil {
+					t.Fatalf("Shutdown() error = %v", err)
+				}
+			}
+
+			select {
+			case err := <-started:
+				if err != nil {
+					t.Errorf("Start() error = %v, want nil", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Start() didn't return after the shutdown")
+			}
+		})
+	}
+}
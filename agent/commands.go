@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	defaultCommandTimeout       = 5 * time.Minute
+	defaultCommandMaxConcurrent = 1
+)
+
+type CommandState string
+
+const (
+	CommandStateRunning   CommandState = "running"
+	CommandStateSucceeded CommandState = "succeeded"
+	CommandStateFailed    CommandState = "failed"
+)
+
+// CommandRequest a command sent by the gateway
+type CommandRequest struct {
+	ID   uuid.UUID
+	Name string
+	// Timeout overrides the timeout of the command if set
+	Timeout time.Duration
+	// Payload the json encoded request of the command
+	Payload []byte
+}
+
+// CommandResult the progress or the outcome of a command
+type CommandResult struct {
+	ID         uuid.UUID
+	Name       string
+	State      CommandState
+	Progress   int
+	Message    string
+	Response   interface{}
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// CommandHandler runs a command and blocks until it's finished
+type CommandHandler func(request *CommandRequest) *CommandResult
+
+// CommandResultHandler reports the progress of running commands
+type CommandResultHandler func(result *CommandResult) error
+
+// Command a running command passed to its handler
+type Command struct {
+	ID   uuid.UUID
+	Name string
+	// Request the value returned by NewRequest with the payload decoded into it
+	Request interface{}
+
+	startedAt time.Time
+	report    func(result *CommandResult)
+}
+
+// Progress reports the progress of the command in percent
+func (command *Command) Progress(progress int, message string) {
+	command.report(&CommandResult{
+		ID:        command.ID,
+		Name:      command.Name,
+		State:     CommandStateRunning,
+		Progress:  progress,
+		Message:   message,
+		StartedAt: command.startedAt,
+	})
+}
+
+// CommandSpec describes a command that can be run by the gateway
+type CommandSpec struct {
+	Name string
+	// NewRequest returns a pointer to decode the request into, nil if the command takes none
+	NewRequest func() interface{}
+	// Handle runs the command, the response is sent back with the result
+	Handle func(ctx context.Context, command *Command) (response interface{}, err error)
+	// Timeout max run time of the command, defaults to 5m
+	Timeout time.Duration
+	// MaxConcurrent max number of commands of this kind running at once, more are refused, defaults to 1
+	MaxConcurrent int
+}
+
+type registeredCommand struct {
+	CommandSpec
+	slots chan struct{}
+}
+
+// Commands registry of the commands the agent runs
+type Commands struct {
+	specs    map[string]*registeredCommand
+	specsM   sync.RWMutex
+	reporter CommandResultHandler
+}
+
+func NewCommands() *Commands {
+	return &Commands{
+		specs: map[string]*registeredCommand{},
+	}
+}
+
+// Register adds a command, it panics if the spec is invalid or already registered
+func (commands *Commands) Register(spec CommandSpec) {
+	if spec.Name == "" || spec.Handle == nil {
+		panic("command name or handler is missing")
+	}
+	if spec.Timeout <= 0 {
+		spec.Timeout = defaultCommandTimeout
+	}
+	if spec.MaxConcurrent <= 0 {
+		spec.MaxConcurrent = defaultCommandMaxConcurrent
+	}
+
+	commands.specsM.Lock()
+	defer commands.specsM.Unlock()
+	if _, ok := commands.specs[spec.Name]; ok {
+		panic(fmt.Sprintf("command %s is already registered", spec.Name))
+	}
+	commands.specs[spec.Name] = &registeredCommand{
+		CommandSpec: spec,
+		slots:       make(chan struct{}, spec.MaxConcurrent),
+	}
+}
+
+// Names returns the names of the registered commands
+func (commands *Commands) Names() []string {
+	commands.specsM.RLock()
+	defer commands.specsM.RUnlock()
+	names := make([]string, 0, len(commands.specs))
+	for name := range commands.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetResultHandler sets where the progress of commands is reported
+func (commands *Commands) SetResultHandler(handler CommandResultHandler) {
+	commands.reporter = handler
+}
+
+// Execute runs a command and returns its result, it's failed if the command
+// is unknown, too many are running or it doesn't finish in time
+func (commands *Commands) Execute(request *CommandRequest) *CommandResult {
+	result := &CommandResult{
+		ID:        request.ID,
+		Name:      request.Name,
+		State:     CommandStateFailed,
+		StartedAt: time.Now().UTC(),
+	}
+	fail := func(err error) *CommandResult {
+		result.Error = err.Error()
+		result.FinishedAt = time.Now().UTC()
+		logger.Errorw("command failed", "command", request.Name, "id", request.ID, "error", err)
+		return result
+	}
+
+	commands.specsM.RLock()
+	spec, ok := commands.specs[request.Name]
+	commands.specsM.RUnlock()
+	if !ok {
+		return fail(fmt.Errorf("unknown command %s", request.Name))
+	}
+
+	select {
+	case spec.slots <- struct{}{}:
+	default:
+		return fail(fmt.Errorf("%d %s commands are already running", spec.MaxConcurrent, spec.Name))
+	}
+
+	command := &Command{
+		ID:        request.ID,
+		Name:      request.Name,
+		startedAt: result.StartedAt,
+		report:    commands.report,
+	}
+	if spec.NewRequest != nil {
+		command.Request = spec.NewRequest()
+		if len(request.Payload) > 0 {
+			err := json.Unmarshal(request.Payload, command.Request)
+			if err != nil {
+				<-spec.slots
+				return fail(fmt.Errorf("unable to decode %s request, error: %w", spec.Name, err))
+			}
+		}
+	}
+
+	timeout := spec.Timeout
+	if request.Timeout > 0 {
+		timeout = request.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type outcome struct {
+		response interface{}
+		err      error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		// the slot is kept until the handler returns even if it timed out
+		defer func() { <-spec.slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("command panicked: %v", r)}
+			}
+		}()
+		response, err := spec.Handle(ctx, command)
+		done <- outcome{response: response, err: err}
+	}()
+
+	logger.Infow("running command", "command", request.Name, "id", request.ID, "timeout", timeout)
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return fail(out.err)
+		}
+		result.State = CommandStateSucceeded
+		result.Progress = 100
+		result.Response = out.response
+		result.FinishedAt = time.Now().UTC()
+		logger.Infow("command succeeded", "command", request.Name, "id", request.ID)
+		return result
+	case <-ctx.Done():
+		return fail(fmt.Errorf("command timed out after %s", timeout))
+	}
+}
+
+func (commands *Commands) report(result *CommandResult) {
+	if commands.reporter == nil {
+		return
+	}
+	err := commands.reporter(result)
+	if err != nil {
+		logger.Warnw("unable to report command progress", "command", result.Name, "id", result.ID, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+type echoRequest struct {
+	Message string `json:"message"`
+}
+
+func TestCommands_Execute(t *testing.T) {
+	commands := NewCommands()
+	var (
+		progress   []int
+		progressM  sync.Mutex
+		release    = make(chan struct{})
+		blockStart = make(chan struct{})
+	)
+	commands.SetResultHandler(func(result *CommandResult) error {
+		progressM.Lock()
+		defer progressM.Unlock()
+		progress = append(progress, result.Progress)
+		return nil
+	})
+	commands.Register(CommandSpec{
+		Name:       "echo",
+		NewRequest: func() interface{} { return &echoRequest{} },
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) {
+			command.Progress(50, "halfway")
+			request := command.Request.(*echoRequest)
+			if request.Message == "" {
+				return nil, errors.New("nothing to echo")
+			}
+			return request.Message, nil
+		},
+	})
+	commands.Register(CommandSpec{
+		Name:    "block",
+		Timeout: 50 * time.Millisecond,
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) {
+			close(blockStart)
+			<-release
+			return nil, nil
+		},
+	})
+
+	result := commands.Execute(&CommandRequest{ID: uuid.NewV4(), Name: "echo", Payload: []byte(`{"message":"hi"}`)})
+	if result.State != CommandStateSucceeded || result.Response != "hi" || result.FinishedAt.IsZero() {
+		t.Errorf("Execute() = %+v, want the echoed message", result)
+	}
+	if len(progress) != 1 || progress[0] != 50 {
+		t.Errorf("progress = %v, want [50]", progress)
+	}
+
+	result = commands.Execute(&CommandRequest{Name: "echo"})
+	if result.State != CommandStateFailed || result.Error != "nothing to echo" {
+		t.Errorf("Execute() = %+v, want the handler error", result)
+	}
+	result = commands.Execute(&CommandRequest{Name: "unknown"})
+	if result.State != CommandStateFailed || !strings.Contains(result.Error, "unknown command") {
+		t.Errorf("Execute() = %+v, want unknown command", result)
+	}
+
+	// the handler keeps its slot after timing out until it returns
+	result = commands.Execute(&CommandRequest{Name: "block"})
+	if result.State != CommandStateFailed || !strings.Contains(result.Error, "timed out") {
+		t.Errorf("Execute() = %+v, want a timeout", result)
+	}
+	<-blockStart
+	result = commands.Execute(&CommandRequest{Name: "block"})
+	if result.State != CommandStateFailed || !strings.Contains(result.Error, "already running") {
+		t.Errorf("Execute() = %+v, want the command refused", result)
+	}
+	close(release)
+}
+
+func TestCommands_Register(t *testing.T) {
+	commands := NewCommands()
+	spec := CommandSpec{
+		Name:   "noop",
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) { return nil, nil },
+	}
+	commands.Register(spec)
+	if names := commands.Names(); len(names) != 1 || names[0] != "noop" {
+		t.Errorf("Names() = %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() should panic on a duplicate")
+		}
+	}()
+	commands.Register(spec)
+}
@@ -13,6 +13,8 @@ type EntityDeltaKind string
 const (
 	EntityDeltaKindUpsert EntityDeltaKind = "UPSERT"
 	EntityDeltaKindDelete EntityDeltaKind = "DELETE"
+	// EntityDeltaKindPatch a json merge patch to apply on the version BaseResourceVersion of the entity
+	EntityDeltaKindPatch EntityDeltaKind = "PATCH"
 )
 
 type GroupVersionResourceKind struct {
@@ -31,11 +33,42 @@ type ParentController struct {
 
 type Delta struct {
 	Kind      EntityDeltaKind
+	Gvrk      GroupVersionResourceKind
 	Data      unstructured.Unstructured
 	Timestamp time.Time
+
+	// Base the previous version of the entity already known by the backend if any,
+	// a patch from Base to Data is sent instead of Data when it's smaller
+	Base *unstructured.Unstructured
+	// Patch json merge patch from BaseResourceVersion to Data, set if Kind is EntityDeltaKindPatch
+	Patch               []byte
+	BaseResourceVersion string
 }
 
+// DeltasDone is called once the deltas are delivered to the gateway or dropped
+type DeltasDone func(delivered bool)
+
+type DeltasHandler func(deltas []*Delta, done DeltasDone) error
+
+// ResourceSyncStatus describes whether the agent has an up to date view of a watched resource
+type ResourceSyncStatus struct {
+	GroupVersionResourceKind
+	State         string
+	LastError     string
+	LastErrorTime time.Time
+	SyncedAt      time.Time
+	NextRetry     time.Time
+}
+
+type SyncStatusHandler func(statuses []*ResourceSyncStatus) error
+
 type EntitiesSource interface {
 	Start(ctx context.Context) error
 	Stop() error
+	// Pause stops watching the cluster until Resume is called
+	Pause()
+	Resume()
+
+	SetSyncStatusHandler(handler SyncStatusHandler)
+	SetDeltasHandler(handler DeltasHandler)
 }
@@ -5,20 +5,27 @@ import (
 	"time"
 )
 
-type RestartHandler func() error
 type ChangeLogLevelHandler func(level *LogLevel) error
-type ConstraintsHandler func(constraints []*Constraint) map[string]error
-type AuditCommandHandler func() error
+
+// SuspendHandler is called when the gateway suspends the agent and when it accepts it again
+type SuspendHandler func(suspended bool) error
 
 type Gateway interface {
 	Start(ctx context.Context) error
-	WaitAuthorization(timeout time.Duration) error
-	// TODO: Add Sync() function to ensure all buffered data is sent before exit
+	// WaitAuthorization blocks until the agent is authorized, it times out or ctx is done
+	WaitAuthorization(ctx context.Context, timeout time.Duration) error
+	// Sync sends all buffered data, it blocks until it's sent or ctx is done
+	Sync(ctx context.Context) error
+	// SendBye tells the gateway the agent is going away and why
+	SendBye(reason string) error
 
 	SendAuditResults(auditResult []*AuditResult) error
+	SendSyncStatus(statuses []*ResourceSyncStatus) error
+	// SendEntitiesDeltas queues deltas to be sent, done is called once they're delivered or dropped
+	SendEntitiesDeltas(deltas []*Delta, done DeltasDone) error
+	// SendCommandResult reports the progress of a command run with the command handler
+	SendCommandResult(result *CommandResult) error
 
-	SetRestartHandler(handler RestartHandler)
-	SetChangeLogLevelHandler(handler ChangeLogLevelHandler)
-	SetConstraintsHandler(handler ConstraintsHandler)
-	SetAuditCommandHandler(handler AuditCommandHandler)
+	SetCommandHandler(handler CommandHandler)
+	SetSuspendHandler(handler SuspendHandler)
 }
@@ -34,6 +34,32 @@ type Constraint struct {
 	DeletedAt    *string
 }
 
+func ConstraintFromPacket(c proto.PacketConstraintItem) *Constraint {
+	return &Constraint{
+		Id:           c.Id,
+		TemplateId:   c.TemplateId,
+		AccountId:    c.AccountId,
+		ClusterId:    c.ClusterId,
+		Name:         c.Name,
+		TemplateName: c.TemplateName,
+		Parameters:   c.Parameters,
+		Match: Match{
+			Namespaces: c.Match.Namespaces,
+			Kinds:      c.Match.Kinds,
+			Labels:     c.Match.Labels,
+		},
+		Code:        c.Code,
+		Description: c.Description,
+		HowToSolve:  c.HowToSolve,
+		UpdatedAt:   c.UpdatedAt,
+		CategoryId:  c.CategoryId,
+		Severity:    c.Severity,
+		Controls:    c.Controls,
+		Standards:   c.Standards,
+		DeletedAt:   c.DeletedAt,
+	}
+}
+
 type AuditResultStatus string
 
 const (
@@ -61,6 +87,18 @@ type AuditResult struct {
 	ParentKind    *string
 	EntitySpec    map[string]interface{}
 	Trigger       string
+	// CorrelationID id of the audit command the result was produced by, if any
+	CorrelationID string
+}
+
+// AuditFilter limits an audit command to the resources matching all the
+// filters set, an empty filter audits everything
+type AuditFilter struct {
+	Namespaces    []string
+	Kinds         []string
+	LabelSelector string
+	Names         []string
+	ConstraintIDs []string
 }
 
 func (a *AuditResult) GenerateID() *AuditResult {
@@ -87,6 +125,7 @@ func (r *AuditResult) ToPacket() *proto.PacketAuditResultItem {
 		ParentKind:    r.ParentKind,
 		EntitySpec:    r.EntitySpec,
 		Trigger:       r.Trigger,
+		CorrelationID: r.CorrelationID,
 	}
 	switch r.Status {
 	case AuditResultStatusViolating:
@@ -101,11 +140,71 @@ func (r *AuditResult) ToPacket() *proto.PacketAuditResultItem {
 
 type AuditResultHandler func(auditResult []*AuditResult) error
 
+// Simulation what constraints would report if they were installed
+type Simulation struct {
+	Resources   int
+	Constraints []*ConstraintSimulation
+}
+
+type ConstraintSimulation struct {
+	ConstraintID string
+	Name         string
+	// Error why the constraint couldn't be evaluated at all
+	Error     string
+	Matched   int
+	Violating int
+	Compliant int
+	// Errors number of resources the constraint failed to be evaluated against
+	Errors int
+	// Samples some of the violating resources
+	Samples []SimulationSample
+}
+
+type SimulationSample struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Msg       string
+}
+
+func (s *Simulation) ToPacket() proto.PacketSimulateResponse {
+	packet := proto.PacketSimulateResponse{
+		Resources:   s.Resources,
+		Constraints: make([]proto.PacketConstraintSimulation, 0, len(s.Constraints)),
+	}
+	for _, c := range s.Constraints {
+		item := proto.PacketConstraintSimulation{
+			ConstraintID: c.ConstraintID,
+			Name:         c.Name,
+			Error:        c.Error,
+			Matched:      c.Matched,
+			Violating:    c.Violating,
+			Compliant:    c.Compliant,
+			Errors:       c.Errors,
+		}
+		for _, sample := range c.Samples {
+			item.Samples = append(item.Samples, proto.PacketSimulationSample{
+				Namespace: sample.Namespace,
+				Kind:      sample.Kind,
+				Name:      sample.Name,
+				Msg:       sample.Msg,
+			})
+		}
+		packet.Constraints = append(packet.Constraints, item)
+	}
+	return packet
+}
+
 type Auditor interface {
 	Start(ctx context.Context) error
 	Stop() error
 
 	HandleConstraints(constraint []*Constraint) map[string]error
-	HandleAuditCommand() error
+	// HandleAuditCommand starts an audit of the resources matching filter, it
+	// returns the correlation id its results are tagged with
+	HandleAuditCommand(filter AuditFilter) (string, error)
+	// Simulate evaluates constraints against the cached resources without
+	// installing them, nothing is cached or sent
+	Simulate(constraints []*Constraint, sampleSize int) (*Simulation, error)
 	SetAuditResultHandler(handler AuditResultHandler)
 }
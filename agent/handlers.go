@@ -1,12 +1,83 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"time"
 
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
 	"github.com/MagalixTechnologies/core/logger"
 )
 
+// built-in commands, named after the packets older gateways send them with
+const (
+	CommandRestart     = "restart"
+	CommandLogLevel    = "loglevel"
+	CommandAudit       = "audit/audit_command"
+	CommandConstraints = "audit/constraints"
+	CommandSimulate    = "audit/simulate"
+)
+
+const (
+	constraintsTimeout  = 2 * time.Minute
+	auditCommandTimeout = 30 * time.Second
+	simulateTimeout     = 5 * time.Minute
+
+	defaultSimulationSampleSize = 10
+	maxSimulationSampleSize     = 100
+)
+
+func (a *Agent) registerCommands() {
+	a.Commands.Register(CommandSpec{
+		Name:       CommandRestart,
+		NewRequest: func() interface{} { return &proto.PacketRestart{} },
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) {
+			return nil, a.handleRestart()
+		},
+	})
+	a.Commands.Register(CommandSpec{
+		Name:       CommandLogLevel,
+		NewRequest: func() interface{} { return &proto.PacketLogLevel{} },
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) {
+			level := command.Request.(*proto.PacketLogLevel)
+			return nil, a.handleLogLevelChange(&LogLevel{Level: level.Level})
+		},
+	})
+	a.Commands.Register(CommandSpec{
+		Name:       CommandAudit,
+		NewRequest: func() interface{} { return &proto.PacketAuditCommand{} },
+		Handle: func(ctx context.Context, command *Command) (interface{}, error) {
+			request := command.Request.(*proto.PacketAuditCommand)
+			correlationID, err := a.Auditor.HandleAuditCommand(AuditFilter{
+				Namespaces:    request.Namespaces,
+				Kinds:         request.Kinds,
+				LabelSelector: request.LabelSelector,
+				Names:         request.Names,
+				ConstraintIDs: request.ConstraintIDs,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return proto.PacketAuditCommandResponse{CorrelationID: correlationID}, nil
+		},
+		Timeout: auditCommandTimeout,
+	})
+	a.Commands.Register(CommandSpec{
+		Name:       CommandConstraints,
+		NewRequest: func() interface{} { return &proto.PacketConstraintsRequest{} },
+		Handle:     a.handleConstraints,
+		Timeout:    constraintsTimeout,
+	})
+	a.Commands.Register(CommandSpec{
+		Name:       CommandSimulate,
+		NewRequest: func() interface{} { return &proto.PacketSimulateRequest{} },
+		Handle:     a.handleSimulate,
+		Timeout:    simulateTimeout,
+	})
+}
+
 func (a *Agent) handleAuditResult(auditResult []*AuditResult) error {
 	if len(auditResult) == 0 {
 		return nil
@@ -14,20 +85,37 @@ func (a *Agent) handleAuditResult(auditResult []*AuditResult) error {
 	return a.Gateway.SendAuditResults(auditResult)
 }
 
+func (a *Agent) handleSyncStatus(statuses []*ResourceSyncStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	err := a.Gateway.SendSyncStatus(statuses)
+	if errors.Is(err, proto.ErrUnsupportedKind) {
+		logger.Debugw("gateway doesn't accept sync status, skipping it", "error", err)
+		return nil
+	}
+	return err
+}
+
+func (a *Agent) handleDeltas(deltas []*Delta, done DeltasDone) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	err := a.Gateway.SendEntitiesDeltas(deltas, done)
+	if errors.Is(err, proto.ErrUnsupportedKind) {
+		logger.Debugw("gateway doesn't accept entities deltas, skipping them", "error", err)
+		done(false)
+		return nil
+	}
+	return err
+}
+
 func (a *Agent) handleRestart() error {
 	go func() {
 		logger.Info("Received restart. Stopping workers.")
-		if err := a.stopSources(); err != nil {
-			logger.Errorf("failed to stop agent sources. %s", err)
-		}
-
-		if err := logger.Sync(); err != nil {
-			logger.Errorf("failed to sync logs. %s", err)
-		}
-
-		if err := a.stopSinks(); err != nil {
-			logger.Errorf("failed to stop agent sinks. %s", err)
-		}
+		a.shutdown.Do(func() {
+			a.drain("restart requested by the gateway")
+		})
 
 		// Set a random wait time of up to 600 seconds (10 minutes)
 		waitTime := time.Duration(rand.Intn(600)) * time.Second
@@ -39,6 +127,61 @@ func (a *Agent) handleRestart() error {
 	return nil
 }
 
+func (a *Agent) handleConstraints(ctx context.Context, command *Command) (interface{}, error) {
+	request := command.Request.(*proto.PacketConstraintsRequest)
+	constraints := make([]*Constraint, 0, len(request.Constraints))
+	for _, item := range request.Constraints {
+		constraints = append(constraints, ConstraintFromPacket(item))
+	}
+
+	response := proto.PacketConstraintsResponse{}
+	errs := a.Auditor.HandleConstraints(constraints)
+	if len(errs) > 0 {
+		response.Errors = make(map[string]string, len(errs))
+		for id, err := range errs {
+			logger.Errorw("Couldn't add constraint", "error", err, "constraint-id", id)
+			response.Errors[id] = err.Error()
+		}
+	}
+	return response, nil
+}
+
+func (a *Agent) handleSimulate(ctx context.Context, command *Command) (interface{}, error) {
+	request := command.Request.(*proto.PacketSimulateRequest)
+	if len(request.Constraints) == 0 {
+		return nil, errors.New("no constraints to simulate")
+	}
+	sampleSize := request.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = defaultSimulationSampleSize
+	} else if sampleSize > maxSimulationSampleSize {
+		sampleSize = maxSimulationSampleSize
+	}
+
+	constraints := make([]*Constraint, 0, len(request.Constraints))
+	for _, item := range request.Constraints {
+		constraints = append(constraints, ConstraintFromPacket(item))
+	}
+	command.Progress(0, fmt.Sprintf("simulating %d constraints", len(constraints)))
+	simulation, err := a.Auditor.Simulate(constraints, sampleSize)
+	if err != nil {
+		return nil, err
+	}
+	return simulation.ToPacket(), nil
+}
+
 func (a *Agent) handleLogLevelChange(level *LogLevel) error {
 	return a.changeLogLevel(level)
 }
+
+// handleSuspend stops watching the cluster while the agent is suspended to spare the api server
+func (a *Agent) handleSuspend(suspended bool) error {
+	if suspended {
+		logger.Info("agent suspended, pausing the entities source")
+		a.EntitiesSource.Pause()
+		return nil
+	}
+	logger.Info("agent resumed, resuming the entities source")
+	a.EntitiesSource.Resume()
+	return nil
+}
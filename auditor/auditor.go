@@ -29,6 +29,9 @@ const (
 	AuditEventTypeEntitiesSync AuditEventType = "entities-sync"
 	AuditEventTypePeriodic     AuditEventType = "periodic-audit"
 	AuditEventTypeInitial      AuditEventType = "initial-audit"
+	AuditEventTypeSecrets      AuditEventType = "secret-findings"
+	// AuditEventTypeSimulation trigger of the results of simulated constraints, never sent
+	AuditEventTypeSimulation AuditEventType = "simulation"
 )
 
 type AuditEvent struct {
@@ -40,17 +43,28 @@ type Auditor struct {
 	opa             *opa.OpaAuditor
 	entitiesWatcher entities.EntitiesWatcherSource
 	sendAuditResult agent.AuditResultHandler
+	// secretFindings findings reported for every resource, used only by the worker
+	secretFindings map[string]string
+	// restoredFindings keys of the resources with findings reported before a restart,
+	// they are reconciled once the entities are synced
+	restoredFindings map[string]struct{}
+	// secretFindingsPath file the keys of the resources with reported findings are kept in
+	secretFindingsPath string
+	// secretDetection hardcoded secrets are detected and reported
+	secretDetection bool
 
 	auditEvents  chan AuditEvent
 	ctx          context.Context
 	cancelWorker context.CancelFunc
 }
 
-func NewAuditor(entitiesWatcher entities.EntitiesWatcherSource) *Auditor {
+func NewAuditor(entitiesWatcher entities.EntitiesWatcherSource, secretDetection bool) *Auditor {
 	a := &Auditor{
 		opa:             opa.New(entitiesWatcher),
 		auditEvents:     make(chan AuditEvent),
 		entitiesWatcher: entitiesWatcher,
+		secretFindings:  make(map[string]string),
+		secretDetection: secretDetection,
 	}
 	a.entitiesWatcher.AddResourceEventsHandler(a)
 	return a
@@ -86,16 +100,20 @@ func (a *Auditor) HandleConstraints(constraints []*agent.Constraint) map[string]
 	return errs
 }
 
-func (a *Auditor) HandleAuditCommand() error {
-	logger.Info("Received audit command. firing audit event")
+func (a *Auditor) HandleAuditCommand(filter agent.AuditFilter) (string, error) {
+	command, err := newAuditCommand(filter)
+	if err != nil {
+		return "", err
+	}
+	logger.Infow("Received audit command. firing audit event", "correlation-id", command.correlationID, "filter", filter)
 
-	go a.triggerAuditCommand()
+	go a.triggerAuditCommand(command)
 
-	return nil
+	return command.correlationID, nil
 }
 
-func (a *Auditor) triggerAuditCommand() {
-	a.auditEvents <- AuditEvent{Type: AuditEventTypeCommand}
+func (a *Auditor) triggerAuditCommand(command *auditCommand) {
+	a.auditEvents <- AuditEvent{Type: AuditEventTypeCommand, Data: command}
 }
 
 func (a *Auditor) OnResourceAdd(gvrk kuber.GroupVersionResourceKind, obj unstructured.Unstructured) {
@@ -119,6 +137,13 @@ func (a *Auditor) OnResourceDelete(gvrk kuber.GroupVersionResourceKind, obj unst
 	}
 }
 
+func (a *Auditor) OnResourceSecretFindings(gvrk kuber.GroupVersionResourceKind, obj unstructured.Unstructured, findings []kuber.SecretFinding) {
+	a.auditEvents <- AuditEvent{
+		Type: AuditEventTypeSecrets,
+		Data: &secretFindingsEvent{Resource: &obj, Findings: findings},
+	}
+}
+
 func (a *Auditor) OnCacheSync() {
 	a.auditEvents <- AuditEvent{Type: AuditEventTypeEntitiesSync}
 }
@@ -134,7 +159,9 @@ func (a *Auditor) auditResource(resource *unstructured.Unstructured, constraintI
 
 }
 
-func (a *Auditor) auditAllResourcesAndSendData(constraintIds []string, triggerType string) {
+// auditAllResourcesAndSendData audits all resources, only the ones matching
+// the command if it's not nil
+func (a *Auditor) auditAllResourcesAndSendData(constraintIds []string, triggerType string, command *auditCommand) {
 	resourcesByGvrk, errs := a.entitiesWatcher.GetAllEntitiesByGvrk()
 	if len(errs) > 0 {
 		logger.Errorw("error while getting all resources", "error", errs)
@@ -142,8 +169,16 @@ func (a *Auditor) auditAllResourcesAndSendData(constraintIds []string, triggerTy
 	for _, resources := range resourcesByGvrk {
 		for idx := range resources {
 			resource := resources[idx]
+			if command != nil && !command.matches(&resource) {
+				continue
+			}
 			results, _ := a.auditResource(&resource, constraintIds, triggerType)
 			a.opa.UpdateCache(results)
+			if command != nil {
+				for _, result := range results {
+					result.CorrelationID = command.correlationID
+				}
+			}
 			err := a.sendAuditResult(results)
 			if err != nil {
 				logger.Errorw("error while sending audit result", "error", err)
@@ -200,22 +235,36 @@ func (a *Auditor) Start(ctx context.Context) error {
 				}
 			case AuditEventTypeEntityDelete:
 				logger.Debugf("Received delete resource audit event")
-				a.opa.RemoveResource(e.Data.(*unstructured.Unstructured))
+				resource := e.Data.(*unstructured.Unstructured)
+				a.opa.RemoveResource(resource)
+				a.forgetSecretFindings(secretFindingsKey(resource))
+			case AuditEventTypeSecrets:
+				results := a.auditSecretFindings(e.Data.(*secretFindingsEvent))
+				if len(results) > 0 {
+					err := a.sendAuditResult(results)
+					if err != nil {
+						logger.Errorw("error while sending secret findings audit result", "error", err)
+					}
+				}
 			case AuditEventTypePolicyChange, AuditEventTypeInitial:
 				updated := e.Data.([]string)
-				a.auditAllResourcesAndSendData(updated, string(e.Type))
+				a.auditAllResourcesAndSendData(updated, string(e.Type), nil)
 			case AuditEventTypeEntitiesSync:
 				entitiesSynced = true
-				fallthrough
+				a.reconcileSecretFindings()
+				logger.Info("Received entities sync event. Auditing all resources")
+				a.auditAllResourcesAndSendData(nil, string(e.Type), nil)
 			case AuditEventTypeCommand:
-				logger.Info("Received audit command event. Auditing all resources")
-				a.auditAllResourcesAndSendData(nil, string(e.Type))
+				command := e.Data.(*auditCommand)
+				logger.Infow("Received audit command event. Auditing matching resources",
+					"correlation-id", command.correlationID)
+				a.auditAllResourcesAndSendData(command.filter.ConstraintIDs, string(e.Type), command)
 			default:
 				logger.Errorw("unsupported event type", "event-type", e.Type)
 			}
 		case <-auditTicker.C:
 			logger.Info("Starting periodical auditing. Auditing all resources")
-			a.auditAllResourcesAndSendData(nil, string(AuditEventTypePeriodic))
+			a.auditAllResourcesAndSendData(nil, string(AuditEventTypePeriodic), nil)
 		}
 	}
 }
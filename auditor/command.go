@@ -0,0 +1,61 @@
+package auditor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixTechnologies/uuid-go"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// auditCommand an audit requested by the gateway, its results are tagged with correlationID
+type auditCommand struct {
+	correlationID string
+	filter        agent.AuditFilter
+	// selector nil if the filter has no label selector
+	selector labels.Selector
+}
+
+func newAuditCommand(filter agent.AuditFilter) (*auditCommand, error) {
+	command := &auditCommand{
+		correlationID: uuid.NewV4().String(),
+		filter:        filter,
+	}
+	if filter.LabelSelector != "" {
+		selector, err := labels.Parse(filter.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q, error: %w", filter.LabelSelector, err)
+		}
+		command.selector = selector
+	}
+	return command, nil
+}
+
+// matches returns true if resource matches all the filters of the command
+func (command *auditCommand) matches(resource *unstructured.Unstructured) bool {
+	filter := command.filter
+	if len(filter.Namespaces) > 0 && !containsString(filter.Namespaces, resource.GetNamespace(), false) {
+		return false
+	}
+	if len(filter.Kinds) > 0 && !containsString(filter.Kinds, resource.GetKind(), true) {
+		return false
+	}
+	if len(filter.Names) > 0 && !containsString(filter.Names, resource.GetName(), false) {
+		return false
+	}
+	if command.selector != nil && !command.selector.Matches(labels.Set(resource.GetLabels())) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string, ignoreCase bool) bool {
+	for _, v := range values {
+		if v == value || (ignoreCase && strings.EqualFold(v, value)) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/MagalixCorp/magalix-agent/v3/agent"
 	"github.com/MagalixCorp/magalix-agent/v3/entities"
 	"github.com/MagalixCorp/magalix-agent/v3/kuber"
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
@@ -47,6 +48,8 @@ type OpaAuditor struct {
 	cache       *AuditResultsCache
 
 	entitiesWatcher entities.EntitiesWatcherSource
+	// capabilities templates must compile with, nil if unrestricted
+	capabilities *ast.Capabilities
 }
 
 func New(entitiesWatcher entities.EntitiesWatcherSource) *OpaAuditor {
@@ -58,6 +61,14 @@ func New(entitiesWatcher entities.EntitiesWatcherSource) *OpaAuditor {
 		entitiesWatcher: entitiesWatcher,
 	}
 }
+
+// NewSandbox returns an auditor for templates that aren't trusted, they can't
+// call builtins that reach the network or the runtime of the agent
+func NewSandbox(entitiesWatcher entities.EntitiesWatcherSource) *OpaAuditor {
+	a := New(entitiesWatcher)
+	a.capabilities = sandboxCapabilities()
+	return a
+}
 func (a *OpaAuditor) GetConstraintsSize() int {
 	return len(a.constraints)
 }
@@ -69,21 +80,9 @@ func (a *OpaAuditor) UpdateConstraint(constraint *agent.Constraint) (bool, error
 	t, tFound := a.templates[tId]
 	updated := false
 	if !cFound {
-		a.constraints[cId] = &Constraint{
-			Id:         cId,
-			TemplateId: tId,
-			Name:       constraint.Name,
-			Parameters: constraint.Parameters,
-			Match:      constraint.Match,
-			UpdatedAt:  constraint.UpdatedAt,
-			CategoryId: constraint.CategoryId,
-			Severity:   constraint.Severity,
-			Standards:  constraint.Standards,
-			Controls:   constraint.Controls,
-		}
-
+		// the template is parsed first so a constraint is never kept without one
 		if !tFound {
-			policy, err := opa.Parse(constraint.Code, PolicyQuery)
+			policy, err := a.parse(constraint.Code)
 			if err != nil {
 				return false, errors.Wrapf(
 					err, "couldn't parse template %s, template id: %s for constraint: %s, constraint id: %s",
@@ -103,6 +102,18 @@ func (a *OpaAuditor) UpdateConstraint(constraint *agent.Constraint) (bool, error
 			t.UsageCount++
 		}
 
+		a.constraints[cId] = &Constraint{
+			Id:         cId,
+			TemplateId: tId,
+			Name:       constraint.Name,
+			Parameters: constraint.Parameters,
+			Match:      constraint.Match,
+			UpdatedAt:  constraint.UpdatedAt,
+			CategoryId: constraint.CategoryId,
+			Severity:   constraint.Severity,
+			Standards:  constraint.Standards,
+			Controls:   constraint.Controls,
+		}
 		updated = true
 	} else if cFound && constraint.UpdatedAt.After(c.UpdatedAt) {
 		a.constraints[cId] = &Constraint{
@@ -118,7 +129,7 @@ func (a *OpaAuditor) UpdateConstraint(constraint *agent.Constraint) (bool, error
 			Controls:   constraint.Controls,
 		}
 
-		policy, err := opa.Parse(constraint.Code, PolicyQuery)
+		policy, err := a.parse(constraint.Code)
 		if err != nil {
 			return false, errors.Wrapf(
 				err, "couldn't parse template %s, template id: %s for constraint: %s, constraint id: %s",
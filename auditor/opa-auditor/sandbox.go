@@ -0,0 +1,49 @@
+package opa_auditor
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	opa "github.com/MagalixTechnologies/opa-core"
+)
+
+// sandboxDeniedBuiltins builtins sandboxed templates can't call, they reach the
+// network or expose the environment of the agent
+var sandboxDeniedBuiltins = map[string]bool{
+	ast.HTTPSend.Name:        true,
+	ast.NetLookupIPAddr.Name: true,
+	ast.OPARuntime.Name:      true,
+}
+
+func sandboxCapabilities() *ast.Capabilities {
+	capabilities := ast.CapabilitiesForThisVersion()
+	builtins := make([]*ast.Builtin, 0, len(capabilities.Builtins))
+	for _, builtin := range capabilities.Builtins {
+		if !sandboxDeniedBuiltins[builtin.Name] {
+			builtins = append(builtins, builtin)
+		}
+	}
+	capabilities.Builtins = builtins
+	// no remote schemas either
+	capabilities.AllowNet = []string{}
+	return capabilities
+}
+
+// parse parses the code of a template, it must compile with the capabilities
+// of the auditor if it has any
+func (a *OpaAuditor) parse(code string) (opa.Policy, error) {
+	policy, err := opa.Parse(code, PolicyQuery)
+	if err != nil || a.capabilities == nil {
+		return policy, err
+	}
+
+	module, err := ast.ParseModule("", code)
+	if err != nil {
+		return opa.Policy{}, err
+	}
+	compiler := ast.NewCompiler().WithCapabilities(a.capabilities)
+	compiler.Compile(map[string]*ast.Module{"template": module})
+	if compiler.Failed() {
+		return opa.Policy{}, compiler.Errors
+	}
+	return policy, nil
+}
@@ -0,0 +1,242 @@
+package auditor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixCorp/magalix-agent/v3/kuber"
+	"github.com/MagalixTechnologies/core/logger"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// SecretFindingsFileName name of the file the resources with reported secret findings are kept in
+	SecretFindingsFileName = "secret-findings.json"
+	// SecretsConstraintID identifies the audit results of the built-in hardcoded secrets detection
+	SecretsConstraintID = "builtin-hardcoded-secrets"
+	secretsSeverity     = "high"
+	secretsDescription  = "Secrets must not be hardcoded in workload specs or annotations"
+	secretsHowToSolve   = "Move the value to a Secret and reference it with valueFrom.secretKeyRef or mount it as a volume"
+)
+
+type secretFindingsEvent struct {
+	Resource *unstructured.Unstructured
+	Findings []kuber.SecretFinding
+}
+
+// auditSecretFindings returns a violation for every finding of a resource when its findings
+// changed, and a single compliance once a resource with reported findings has none left
+func (a *Auditor) auditSecretFindings(event *secretFindingsEvent) []*agent.AuditResult {
+	resource := event.Resource
+	key := secretFindingsKey(resource)
+
+	signature := findingsSignature(event.Findings)
+	reported, found := a.secretFindings[key]
+	if (found && reported == signature) || (!found && len(event.Findings) == 0) {
+		return nil
+	}
+
+	if len(event.Findings) == 0 {
+		a.forgetSecretFindings(key)
+		return []*agent.AuditResult{newSecretAuditResult(resource, agent.AuditResultStatusCompliant, nil)}
+	}
+
+	a.secretFindings[key] = signature
+	if !found {
+		a.saveSecretFindings()
+	}
+	logger.Infow(
+		"hardcoded secrets found",
+		"kind", resource.GetKind(),
+		"namespace", resource.GetNamespace(),
+		"name", resource.GetName(),
+		"count", len(event.Findings),
+	)
+
+	results := make([]*agent.AuditResult, 0, len(event.Findings))
+	for i := range event.Findings {
+		results = append(results, newSecretAuditResult(resource, agent.AuditResultStatusViolating, &event.Findings[i]))
+	}
+	return results
+}
+
+// reconcileSecretFindings reports the resources with findings reported before a restart
+// and none left as compliant, they would never be reported otherwise. Only workloads are
+// scanned for secrets, other kinds never had findings to reconcile.
+func (a *Auditor) reconcileSecretFindings() {
+	if !a.secretDetection || len(a.restoredFindings) == 0 {
+		return
+	}
+	resourcesByGvrk, errs := a.entitiesWatcher.GetAllEntitiesByGvrk()
+	if len(errs) > 0 {
+		logger.Errorw("error while getting all resources", "error", errs)
+	}
+	for gvrk, resources := range resourcesByGvrk {
+		if kuber.IsMetadataOnly(gvrk) || !kuber.HasPodSpec(gvrk.Kind) {
+			continue
+		}
+		var results []*agent.AuditResult
+		for idx := range resources {
+			resource := &resources[idx]
+			key := secretFindingsKey(resource)
+			if _, restored := a.restoredFindings[key]; !restored {
+				continue
+			}
+			if _, found := a.secretFindings[key]; found {
+				continue
+			}
+			results = append(results, newSecretAuditResult(resource, agent.AuditResultStatusCompliant, nil))
+		}
+		if len(results) == 0 {
+			continue
+		}
+		err := a.sendAuditResult(results)
+		if err != nil {
+			logger.Errorw("error while sending secret findings audit result", "error", err)
+		}
+	}
+	a.restoredFindings = nil
+	a.saveSecretFindings()
+}
+
+// forgetSecretFindings drops the findings reported for a resource
+func (a *Auditor) forgetSecretFindings(key string) {
+	_, found := a.secretFindings[key]
+	_, restored := a.restoredFindings[key]
+	if !found && !restored {
+		return
+	}
+	delete(a.secretFindings, key)
+	delete(a.restoredFindings, key)
+	a.saveSecretFindings()
+}
+
+// SetSecretFindingsFile keeps the resources with reported findings in path and
+// restores the ones reported before a restart, it must be called before Start
+func (a *Auditor) SetSecretFindingsFile(path string) {
+	a.secretFindingsPath = path
+	keys, err := readSecretFindings(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnw("unable to restore reported secret findings", "path", path, "error", err)
+		}
+		return
+	}
+	a.restoredFindings = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		a.restoredFindings[key] = struct{}{}
+	}
+}
+
+// saveSecretFindings writes the keys of the resources with reported findings, the
+// findings themselves are never written
+func (a *Auditor) saveSecretFindings() {
+	if a.secretFindingsPath == "" {
+		return
+	}
+	keys := make([]string, 0, len(a.secretFindings)+len(a.restoredFindings))
+	for key := range a.secretFindings {
+		keys = append(keys, key)
+	}
+	for key := range a.restoredFindings {
+		if _, found := a.secretFindings[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	err := writeSecretFindings(a.secretFindingsPath, keys)
+	if err != nil {
+		logger.Warnw("unable to save reported secret findings", "path", a.secretFindingsPath, "error", err)
+	}
+}
+
+func readSecretFindings(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read secret findings file, error: %w", err)
+	}
+	var keys []string
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode secret findings file %s, error: %w", path, err)
+	}
+	return keys, nil
+}
+
+// writeSecretFindings replaces the file atomically so a crash never leaves a partial one behind
+func writeSecretFindings(path string, keys []string) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("unable to encode secret findings, error: %w", err)
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create secret findings file, error: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to write secret findings file, error: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write secret findings file, error: %w", err)
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("unable to replace secret findings file, error: %w", err)
+	}
+	return nil
+}
+
+func newSecretAuditResult(
+	resource *unstructured.Unstructured,
+	status agent.AuditResultStatus,
+	finding *kuber.SecretFinding,
+) *agent.AuditResult {
+	constraintID := SecretsConstraintID
+	severity := secretsSeverity
+	name := resource.GetName()
+	kind := resource.GetKind()
+	namespace := resource.GetNamespace()
+
+	result := &agent.AuditResult{
+		TemplateID:    &constraintID,
+		ConstraintID:  &constraintID,
+		Severity:      &severity,
+		Description:   secretsDescription,
+		HowToSolve:    secretsHowToSolve,
+		Status:        status,
+		EntityName:    &name,
+		EntityKind:    &kind,
+		NamespaceName: &namespace,
+		Trigger:       string(AuditEventTypeSecrets),
+	}
+	if finding != nil {
+		// the location only, the value must never leave the agent
+		msg := fmt.Sprintf("hardcoded secret (%s) found in %s", finding.Detector, finding.Location)
+		result.Msg = &msg
+	}
+	return result.GenerateID()
+}
+
+func secretFindingsKey(resource *unstructured.Unstructured) string {
+	return kuber.GetEntityKey(resource.GetNamespace(), resource.GetKind(), resource.GetName())
+}
+
+func findingsSignature(findings []kuber.SecretFinding) string {
+	items := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		items = append(items, finding.Detector+"@"+finding.Location)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,91 @@
+package auditor
+
+import (
+	"fmt"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+
+	opa "github.com/MagalixCorp/magalix-agent/v3/auditor/opa-auditor"
+)
+
+// Simulate evaluates constraints against the cached resources in a separate
+// opa auditor so neither the installed constraints nor the results cache are
+// touched, and no result is sent
+func (a *Auditor) Simulate(constraints []*agent.Constraint, sampleSize int) (*agent.Simulation, error) {
+	simulation := &agent.Simulation{}
+	byID := make(map[string]*agent.ConstraintSimulation, len(constraints))
+	sandboxed := make([]*agent.Constraint, 0, len(constraints))
+	for i, constraint := range constraints {
+		// what-if constraints may not be saved yet, ids must not collide
+		c := *constraint
+		c.DeletedAt = nil
+		if c.Id == "" {
+			c.Id = fmt.Sprintf("simulated-%d", i)
+		}
+		if c.TemplateId == "" {
+			c.TemplateId = uuid.NewV4().String()
+		}
+		if _, ok := byID[c.Id]; ok {
+			return nil, fmt.Errorf("duplicate constraint id %s", c.Id)
+		}
+		result := &agent.ConstraintSimulation{ConstraintID: c.Id, Name: c.Name}
+		byID[c.Id] = result
+		simulation.Constraints = append(simulation.Constraints, result)
+		sandboxed = append(sandboxed, &c)
+	}
+
+	sandbox := opa.NewSandbox(a.entitiesWatcher)
+	_, errs := sandbox.UpdateConstraints(sandboxed)
+	for id, err := range errs {
+		byID[id].Error = err.Error()
+	}
+	if len(errs) == len(sandboxed) {
+		return simulation, nil
+	}
+
+	resourcesByGvrk, getErrs := a.entitiesWatcher.GetAllEntitiesByGvrk()
+	if len(getErrs) > 0 {
+		logger.Errorw("error while getting all resources", "error", getErrs)
+	}
+	for _, resources := range resourcesByGvrk {
+		for idx := range resources {
+			resource := resources[idx]
+			simulation.Resources++
+			results, auditErrs := sandbox.Audit(&resource, nil, string(AuditEventTypeSimulation))
+			for _, result := range results {
+				c := byID[*result.ConstraintID]
+				c.Matched++
+				switch result.Status {
+				case agent.AuditResultStatusViolating:
+					c.Violating++
+					if len(c.Samples) < sampleSize {
+						c.Samples = append(c.Samples, agent.SimulationSample{
+							Namespace: resource.GetNamespace(),
+							Kind:      resource.GetKind(),
+							Name:      resource.GetName(),
+							Msg:       stringOrEmpty(result.Msg),
+						})
+					}
+				case agent.AuditResultStatusCompliant:
+					c.Compliant++
+				default:
+					// evaluation failed, the error is in auditErrs
+					c.Errors++
+				}
+			}
+			if len(auditErrs) > 0 {
+				logger.Debugw("errors while simulating constraints", "name", resource.GetName(), "errors", auditErrs)
+			}
+		}
+	}
+	return simulation, nil
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -2,11 +2,11 @@ package client
 
 import "crypto/sha512"
 
-func (client *Client) getAuthorizationToken(question []byte) ([]byte, error) {
+func (client *Client) getAuthorizationToken(question []byte, secret []byte) ([]byte, error) {
 	payload := []byte{}
 
 	payload = append(payload, question...)
-	payload = append(payload, []byte(client.secret)...)
+	payload = append(payload, secret...)
 	payload = append(payload, question...)
 
 	sha := sha512.New()
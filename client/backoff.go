@@ -0,0 +1,51 @@
+package client
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// jitter is seeded per process so agents restarted together don't retry in lockstep
+	jitter  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterM sync.Mutex
+)
+
+// Backoff exponential backoff with full jitter, every delay is random between
+// zero and base doubled on every attempt, capped at max
+type Backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// NewBackoff creates a new backoff
+func NewBackoff(base time.Duration, max time.Duration) *Backoff {
+	if max < base {
+		max = base
+	}
+	return &Backoff{base: base, max: max}
+}
+
+// Next returns the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.max
+	// stop doubling once the cap is reached, it would overflow eventually
+	if shifted := b.base << uint(b.attempt); b.attempt < 62 && shifted > 0 && shifted < b.max {
+		ceiling = shifted
+		b.attempt++
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	jitterM.Lock()
+	defer jitterM.Unlock()
+	return time.Duration(jitter.Int63n(int64(ceiling) + 1))
+}
+
+// Reset starts over from base after a successful attempt
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
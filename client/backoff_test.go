@@ -0,0 +1,48 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	backoff := NewBackoff(100*time.Millisecond, time.Second)
+
+	ceilings := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, ceiling := range ceilings {
+		delay := backoff.Next()
+		if delay < 0 || delay > ceiling {
+			t.Errorf("attempt %d: Next() = %v, want between 0 and %v", i, delay, ceiling)
+		}
+	}
+
+	// the cap holds however many attempts fail
+	for i := 0; i < 100; i++ {
+		if delay := backoff.Next(); delay > time.Second {
+			t.Fatalf("Next() = %v after %d attempts, want at most the cap", delay, i+len(ceilings))
+		}
+	}
+
+	backoff.Reset()
+	if delay := backoff.Next(); delay > 100*time.Millisecond {
+		t.Errorf("Next() = %v after Reset(), want at most the base", delay)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	// full jitter spreads the delays over the whole range
+	distinct := map[time.Duration]struct{}{}
+	for i := 0; i < 20; i++ {
+		distinct[NewBackoff(time.Second, time.Second).Next()] = struct{}{}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("Next() returned the same delay for every backoff, want jitter")
+	}
+}
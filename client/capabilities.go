@@ -0,0 +1,144 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+)
+
+// ErrUnsupportedKind the gateway said it doesn't accept packets of this kind
+var ErrUnsupportedKind = proto.ErrUnsupportedKind
+
+// agentCapabilities what the agent sends and handles, in order of preference,
+// zstd-dict is preferred when the agent is given a zstd dictionary
+var agentCapabilities = proto.Capabilities{
+	Kinds: []proto.PacketKind{
+		proto.PacketKindHello,
+		proto.PacketKindAuthorizationRequest,
+		proto.PacketKindAuthorizationAnswer,
+		proto.PacketKindLogs,
+		proto.PacketKindBye,
+		proto.PacketKindRestart,
+		proto.PacketKindRawStoreRequest,
+		proto.PacketKindLogLevel,
+		proto.PacketKindConstraintsRequest,
+		proto.PacketKindAuditResultRequest,
+		proto.PacketKindAuditCommand,
+		proto.PacketKindPing,
+		proto.PacketKindSyncStatusRequest,
+		proto.PacketKindEntitiesDeltas,
+		proto.PacketKindChunk,
+		proto.PacketKindCommand,
+		proto.PacketKindCommandResult,
+	},
+	Encodings:   []string{proto.EncodingProtobuf, proto.EncodingJSON},
+	Compression: []string{proto.CompressionZstd, proto.CompressionSnappy, proto.CompressionNone},
+	Features: []string{
+		proto.FeaturePacketV2,
+		proto.FeatureEnvelope,
+		proto.FeatureDeltaPatches,
+		proto.FeatureChunking,
+	},
+	ProtobufKinds: proto.ProtobufKinds,
+}
+
+// legacyKinds the packets gateways predating the capabilities exchange handle,
+// they have no entities deltas, sync status, chunks nor commands
+var legacyKinds = []proto.PacketKind{
+	proto.PacketKindHello,
+	proto.PacketKindAuthorizationRequest,
+	proto.PacketKindAuthorizationAnswer,
+	proto.PacketKindLogs,
+	proto.PacketKindBye,
+	proto.PacketKindRestart,
+	proto.PacketKindRawStoreRequest,
+	proto.PacketKindLogLevel,
+	proto.PacketKindConstraintsRequest,
+	proto.PacketKindAuditResultRequest,
+	proto.PacketKindAuditCommand,
+	proto.PacketKindPing,
+}
+
+// legacyCapabilities what gateways predating the capabilities exchange accept,
+// the only features they have are the ones they said hello with
+func legacyCapabilities(hello proto.PacketHello) proto.Capabilities {
+	capabilities := proto.Capabilities{
+		Kinds:       legacyKinds,
+		Encodings:   []string{proto.EncodingJSON},
+		Compression: []string{proto.CompressionSnappy},
+	}
+	if hello.PacketV2Enabled {
+		capabilities.Features = append(capabilities.Features, proto.FeaturePacketV2)
+	}
+	if hello.EnvelopeEnabled {
+		capabilities.Features = append(capabilities.Features, proto.FeatureEnvelope)
+	}
+	return capabilities
+}
+
+// negotiate checks the versions of the gateway and returns the capabilities
+// both sides support, the codec is made of the preferred encoding and compression
+func negotiate(supported proto.Capabilities, hello proto.PacketHello) (proto.Capabilities, proto.Codec, error) {
+	if hello.Major != ProtocolMajorVersion {
+		return proto.Capabilities{}, proto.Codec{}, fmt.Errorf(
+			"unsupported version, gateway protocol is %d.%d, agent protocol is %d.%d",
+			hello.Major, hello.Minor, ProtocolMajorVersion, ProtocolMinorVersion,
+		)
+	}
+
+	server := legacyCapabilities(hello)
+	if hello.Capabilities != nil {
+		server = *hello.Capabilities
+	}
+	negotiated := supported.Negotiate(server)
+	if len(negotiated.Encodings) == 0 {
+		return negotiated, proto.Codec{}, fmt.Errorf("no common encoding, gateway supports %v", server.Encodings)
+	}
+	if len(negotiated.Compression) == 0 {
+		return negotiated, proto.Codec{}, fmt.Errorf("no common compression, gateway supports %v", server.Compression)
+	}
+	codec, err := proto.GetCodec(negotiated.Encodings[0], negotiated.Compression[0])
+	return negotiated, codec, err
+}
+
+// Capabilities returns the capabilities negotiated with the gateway, false
+// until the agent said hello on the current connection
+func (client *Client) Capabilities() (proto.Capabilities, bool) {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	if client.capabilities == nil {
+		return proto.Capabilities{}, false
+	}
+	return *client.capabilities, true
+}
+
+// Accepts returns false if the gateway said it can't handle packets of kind,
+// every kind is accepted until the capabilities are negotiated
+func (client *Client) Accepts(kind proto.PacketKind) bool {
+	capabilities, ok := client.Capabilities()
+	return !ok || capabilities.HasKind(kind)
+}
+
+// HasFeature returns true if the gateway negotiated feature on the current connection
+func (client *Client) HasFeature(feature string) bool {
+	capabilities, ok := client.Capabilities()
+	return ok && capabilities.HasFeature(feature)
+}
+
+// CodecFor returns the codec of packets of kind, json and snappy until the hello
+// which always uses them as it's sent before anything is negotiated. Only the
+// kinds negotiated in ProtobufKinds are encoded as protobuf.
+func (client *Client) CodecFor(kind proto.PacketKind) proto.Codec {
+	if kind == proto.PacketKindHello {
+		return proto.DefaultCodec
+	}
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	if client.capabilities == nil {
+		return proto.DefaultCodec
+	}
+	if client.codec.Encoding.Name() == proto.EncodingProtobuf && !client.capabilities.HasProtobufKind(kind) {
+		return client.codec.JSON()
+	}
+	return client.codec
+}
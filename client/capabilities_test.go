@@ -0,0 +1,159 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+)
+
+func TestNegotiate(t *testing.T) {
+	// gateways predating the exchange keep getting what they always got
+	legacy, codec, err := negotiate(agentCapabilities, proto.PacketHello{Major: ProtocolMajorVersion, Minor: 4, PacketV2Enabled: true})
+	if err != nil {
+		t.Fatalf("negotiate() error = %v", err)
+	}
+	if !legacy.HasKind(proto.PacketKindAuditResultRequest) || codec.String() != "json+snappy" ||
+		!legacy.HasFeature(proto.FeaturePacketV2) || legacy.HasFeature(proto.FeatureEnvelope) {
+		t.Errorf("negotiate() legacy = %+v, codec %s", legacy, codec)
+	}
+	for _, kind := range []proto.PacketKind{
+		proto.PacketKindEntitiesDeltas,
+		proto.PacketKindSyncStatusRequest,
+		proto.PacketKindChunk,
+		proto.PacketKindCommand,
+		proto.PacketKindCommandResult,
+	} {
+		if legacy.HasKind(kind) {
+			t.Errorf("negotiate() legacy gateways should not accept %s", kind)
+		}
+	}
+	if legacy.HasFeature(proto.FeatureDeltaPatches) || legacy.HasFeature(proto.FeatureChunking) {
+		t.Errorf("negotiate() legacy features = %v", legacy.Features)
+	}
+
+	negotiated, codec, err := negotiate(agentCapabilities, proto.PacketHello{
+		Major: ProtocolMajorVersion,
+		Minor: ProtocolMinorVersion,
+		Capabilities: &proto.Capabilities{
+			Kinds:       []proto.PacketKind{proto.PacketKindEntitiesDeltas, proto.PacketKindPing},
+			Encodings:   []string{proto.EncodingJSON},
+			Compression: []string{proto.CompressionNone, proto.CompressionSnappy},
+			Features:    []string{proto.FeatureEnvelope, "unknown"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("negotiate() error = %v", err)
+	}
+	if negotiated.HasKind(proto.PacketKindAuditResultRequest) || !negotiated.HasKind(proto.PacketKindEntitiesDeltas) {
+		t.Errorf("negotiate() kinds = %v", negotiated.Kinds)
+	}
+	// the agent's preference wins
+	if codec.String() != "json+snappy" {
+		t.Errorf("negotiate() codec = %s, want json+snappy", codec)
+	}
+	if len(negotiated.Features) != 1 || !negotiated.HasFeature(proto.FeatureEnvelope) {
+		t.Errorf("negotiate() features = %v", negotiated.Features)
+	}
+
+	// the smallest max packet size wins
+	supported := agentCapabilities
+	supported.MaxPacketSize = 1 << 20
+	for _, server := range []int{0, 512 << 10} {
+		negotiated, _, _ = negotiate(supported, proto.PacketHello{
+			Major:        ProtocolMajorVersion,
+			Capabilities: &proto.Capabilities{Encodings: supported.Encodings, Compression: supported.Compression, MaxPacketSize: server},
+		})
+		want := server
+		if want == 0 {
+			want = supported.MaxPacketSize
+		}
+		if negotiated.MaxPacketSize != want {
+			t.Errorf("negotiate() max packet size = %d, want %d", negotiated.MaxPacketSize, want)
+		}
+	}
+
+	_, _, err = negotiate(agentCapabilities, proto.PacketHello{Major: ProtocolMajorVersion + 1})
+	if err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("negotiate() error = %v, want unsupported version", err)
+	}
+	_, _, err = negotiate(agentCapabilities, proto.PacketHello{
+		Major:        ProtocolMajorVersion,
+		Capabilities: &proto.Capabilities{Encodings: []string{proto.EncodingJSON}, Compression: []string{"lz4"}},
+	})
+	if err == nil {
+		t.Errorf("negotiate() should fail without a common compression")
+	}
+}
+
+// dictionaryCompressor stands for a zstd compressor with a dictionary
+type dictionaryCompressor struct{}
+
+func (dictionaryCompressor) Name() string                           { return proto.CompressionZstdDict }
+func (dictionaryCompressor) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (dictionaryCompressor) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+func TestNegotiate_ZstdDictionary(t *testing.T) {
+	proto.RegisterCompressor(dictionaryCompressor{})
+	supported := agentCapabilities
+	supported.Compression = append([]string{proto.CompressionZstdDict}, supported.Compression...)
+	supported.ZstdDictionaryID = 42
+	server := proto.Capabilities{
+		Kinds:            supported.Kinds,
+		Encodings:        []string{proto.EncodingJSON, proto.EncodingProtobuf},
+		Compression:      []string{proto.CompressionSnappy, proto.CompressionZstd, proto.CompressionZstdDict},
+		ZstdDictionaryID: 42,
+	}
+
+	negotiated, _, err := negotiate(supported, proto.PacketHello{Major: ProtocolMajorVersion, Capabilities: &server})
+	if err != nil {
+		t.Fatalf("negotiate() error = %v", err)
+	}
+	if negotiated.Encodings[0] != proto.EncodingProtobuf || negotiated.Compression[0] != proto.CompressionZstdDict {
+		t.Errorf("negotiate() = %v %v, want protobuf and zstd-dict", negotiated.Encodings, negotiated.Compression)
+	}
+	// the gateway decodes none of the agent's protobuf kinds
+	if len(negotiated.ProtobufKinds) != 0 {
+		t.Errorf("negotiate() protobuf kinds = %v, want none", negotiated.ProtobufKinds)
+	}
+
+	server.ProtobufKinds = []proto.PacketKind{proto.PacketKindEntitiesDeltas, proto.PacketKindLogs}
+	negotiated, _, _ = negotiate(supported, proto.PacketHello{Major: ProtocolMajorVersion, Capabilities: &server})
+	if len(negotiated.ProtobufKinds) != 1 || !negotiated.HasProtobufKind(proto.PacketKindEntitiesDeltas) {
+		t.Errorf("negotiate() protobuf kinds = %v, want only %s", negotiated.ProtobufKinds, proto.PacketKindEntitiesDeltas)
+	}
+
+	// a different dictionary can't be used
+	server.ZstdDictionaryID = 7
+	negotiated, _, err = negotiate(supported, proto.PacketHello{Major: ProtocolMajorVersion, Capabilities: &server})
+	if err != nil {
+		t.Fatalf("negotiate() error = %v", err)
+	}
+	if negotiated.Compression[0] != proto.CompressionZstd || negotiated.ZstdDictionaryID != 0 {
+		t.Errorf("negotiate() compression = %v, dictionary %d, want zstd without dictionary",
+			negotiated.Compression, negotiated.ZstdDictionaryID)
+	}
+}
+
+func TestClient_Accepts(t *testing.T) {
+	client := &Client{}
+	if !client.Accepts(proto.PacketKindAuditResultRequest) || client.CodecFor(proto.PacketKindLogs).String() != "json+snappy" {
+		t.Errorf("every kind should be accepted and sent with json and snappy before the hello")
+	}
+
+	codec, _ := proto.GetCodec(proto.EncodingProtobuf, proto.CompressionZstd)
+	client.capabilities = &proto.Capabilities{
+		Kinds:         []proto.PacketKind{proto.PacketKindLogs, proto.PacketKindEntitiesDeltas},
+		ProtobufKinds: []proto.PacketKind{proto.PacketKindEntitiesDeltas},
+	}
+	client.codec = codec
+	if client.Accepts(proto.PacketKindAuditResultRequest) || !client.Accepts(proto.PacketKindLogs) {
+		t.Errorf("Accepts() doesn't follow the negotiated kinds")
+	}
+	if client.CodecFor(proto.PacketKindEntitiesDeltas) != codec || client.CodecFor(proto.PacketKindHello) != proto.DefaultCodec {
+		t.Errorf("CodecFor() should use the negotiated codec for the protobuf kinds and the default one for hello")
+	}
+	if client.CodecFor(proto.PacketKindLogs).String() != "json+zstd" {
+		t.Errorf("CodecFor() = %s, the kinds without protobuf negotiated should be json", client.CodecFor(proto.PacketKindLogs))
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	// chunkOverhead room left in every chunk for its header
+	chunkOverhead = 256
+	// chunkRetries max number of tries of a single chunk before the whole packet fails
+	chunkRetries = 3
+)
+
+// ErrPacketExpired the packet expired before all its chunks were sent
+var ErrPacketExpired = errors.New("packet expired")
+
+// chunking how a packet is split if it's bigger than the negotiated max packet size
+type chunking struct {
+	// id of the chunks, a new one is used if nil
+	id uuid.UUID
+	// attempt of the package the chunks are sent for
+	attempt int
+	// expiry chunks aren't sent or retried after it, nil if never
+	expiry *time.Time
+}
+
+// chunkSize returns the size of the chunks to split a packet of size into,
+// zero if it doesn't need to be split
+func (client *Client) chunkSize(kind proto.PacketKind, size int) int {
+	capabilities, ok := client.Capabilities()
+	if !ok || kind == proto.PacketKindHello || capabilities.MaxPacketSize <= chunkOverhead ||
+		size <= capabilities.MaxPacketSize {
+		return 0
+	}
+	if !capabilities.HasFeature(proto.FeatureChunking) {
+		logger.Warnw(
+			"packet exceeds the max packet size and the gateway can't reassemble chunks, sending it whole",
+			"kind", kind,
+			"size", size,
+			"max_packet_size", capabilities.MaxPacketSize,
+		)
+		return 0
+	}
+	return capabilities.MaxPacketSize - chunkOverhead
+}
+
+// sendChunks sends an encoded packet in chunks of chunkSize in order, it
+// returns the response to the last chunk which is the response to the packet
+func (client *Client) sendChunks(kind proto.PacketKind, payload []byte, chunkSize int, options chunking) ([]byte, error) {
+	chunks := splitChunks(kind, payload, chunkSize, options)
+	logger.Debugw("sending packet in chunks", "kind", kind, "id", chunks[0].ID, "size", len(payload), "chunks", len(chunks))
+
+	var res []byte
+	for _, chunk := range chunks {
+		req, err := proto.ChunkCodec.Encode(chunk)
+		if err != nil {
+			return nil, err
+		}
+		res, err = client.sendChunk(req, options.expiry)
+		if err != nil {
+			return nil, fmt.Errorf("unable to send chunk %d of %d of %s packet, error: %w", chunk.Index+1, chunk.Count, kind, err)
+		}
+	}
+	return res, nil
+}
+
+// encodingID returns the id of the chunks of an encoding of a package, every
+// attempt is encoded again, possibly with another codec after a reconnect, so
+// the gateway must never reassemble chunks of different attempts together
+func (options chunking) encodingID(codec proto.Codec) chunking {
+	if !options.id.IsNil() {
+		options.id = uuid.NewV5(options.id, fmt.Sprintf("%d/%s", options.attempt, codec))
+	}
+	return options
+}
+
+// splitChunks splits payload in ordered chunks sharing the same id
+func splitChunks(kind proto.PacketKind, payload []byte, chunkSize int, options chunking) []proto.PacketChunk {
+	id := options.id
+	if id.IsNil() {
+		id = uuid.NewV4()
+	}
+	count := (len(payload) + chunkSize - 1) / chunkSize
+	chunks := make([]proto.PacketChunk, 0, count)
+	for index := 0; index < count; index++ {
+		end := (index + 1) * chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunks = append(chunks, proto.PacketChunk{
+			ID:     id,
+			Kind:   kind,
+			Index:  index,
+			Count:  count,
+			Size:   len(payload),
+			Expiry: options.expiry,
+			Data:   payload[index*chunkSize : end],
+		})
+	}
+	return chunks
+}
+
+// sendChunk sends a chunk with its own retries so a failed chunk doesn't
+// resend the whole packet, it's given up once the packet expires
+func (client *Client) sendChunk(req []byte, expiry *time.Time) ([]byte, error) {
+	backoff := NewBackoff(client.timeouts.protoBackoff, client.timeouts.protoBackoffMax)
+	var err error
+	for try := 0; try < chunkRetries; try++ {
+		if try > 0 {
+			time.Sleep(backoff.Next())
+		}
+		if expiry != nil && time.Now().After(*expiry) {
+			return nil, ErrPacketExpired
+		}
+
+		var res []byte
+		res, err = client.sendRequest(proto.PacketKindChunk.String(), req)
+		if err == nil {
+			return res, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+func TestClient_ChunkSize(t *testing.T) {
+	client := &Client{}
+	if size := client.chunkSize(proto.PacketKindAuditResultRequest, 10<<20); size != 0 {
+		t.Errorf("chunkSize() = %d before the hello, want 0", size)
+	}
+
+	client.capabilities = &proto.Capabilities{MaxPacketSize: 1024}
+	if size := client.chunkSize(proto.PacketKindAuditResultRequest, 4096); size != 0 {
+		t.Errorf("chunkSize() = %d without chunking, want the packet sent whole", size)
+	}
+
+	client.capabilities.Features = []string{proto.FeatureChunking}
+	tests := []struct {
+		kind proto.PacketKind
+		size int
+		want int
+	}{
+		{proto.PacketKindAuditResultRequest, 1024, 0},
+		{proto.PacketKindAuditResultRequest, 4096, 1024 - chunkOverhead},
+		{proto.PacketKindHello, 4096, 0},
+	}
+	for _, tt := range tests {
+		if got := client.chunkSize(tt.kind, tt.size); got != tt.want {
+			t.Errorf("chunkSize(%s, %d) = %d, want %d", tt.kind, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 25)
+	expiry := time.Now().Add(time.Minute)
+	id := uuid.NewV4()
+
+	chunks := splitChunks(proto.PacketKindEntitiesDeltas, payload, 100, chunking{id: id, expiry: &expiry})
+	if len(chunks) != 3 {
+		t.Fatalf("splitChunks() = %d chunks, want 3", len(chunks))
+	}
+	var reassembled []byte
+	for i, chunk := range chunks {
+		if chunk.ID != id || chunk.Index != i || chunk.Count != 3 || chunk.Size != len(payload) ||
+			chunk.Kind != proto.PacketKindEntitiesDeltas || chunk.Expiry != &expiry {
+			t.Errorf("splitChunks() chunk %d = %+v", i, chunk)
+		}
+		reassembled = append(reassembled, chunk.Data...)
+	}
+	if !bytes.Equal(reassembled, payload) {
+		t.Errorf("chunks don't reassemble into the packet")
+	}
+
+	// every attempt and codec of a package gets its own chunks id
+	options := chunking{id: id, attempt: 1}
+	first := options.encodingID(proto.DefaultCodec)
+	if first.id == id || first.id != options.encodingID(proto.DefaultCodec).id {
+		t.Errorf("encodingID() = %s, want a stable id derived from %s", first.id, id)
+	}
+	retried := chunking{id: id, attempt: 2}.encodingID(proto.DefaultCodec)
+	if retried.id == first.id || options.encodingID(proto.ChunkCodec).id == first.id {
+		t.Errorf("encodingID() should differ between attempts and codecs")
+	}
+	if !(chunking{}).encodingID(proto.DefaultCodec).id.IsNil() {
+		t.Errorf("encodingID() of packets sent without a package should stay nil")
+	}
+
+	// packets sent without a package get a new id
+	chunks = splitChunks(proto.PacketKindEntitiesDeltas, payload, 300, chunking{})
+	if len(chunks) != 1 || chunks[0].ID.IsNil() {
+		t.Errorf("splitChunks() = %+v, want a single chunk with an id", chunks)
+	}
+}
@@ -1,20 +1,19 @@
 package client
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
-	"net/url"
 	"sync"
 	"time"
 
 	"github.com/MagalixCorp/magalix-agent/v3/proto"
-	"github.com/MagalixTechnologies/channel"
 	"github.com/MagalixTechnologies/core/logger"
-	"github.com/MagalixTechnologies/uuid-go"
 )
 
 const (
 	ProtocolMajorVersion = 2
-	ProtocolMinorVersion = 4
+	ProtocolMinorVersion = 5
 )
 
 type timeouts struct {
@@ -23,24 +22,58 @@ type timeouts struct {
 	protoRead      time.Duration
 	protoReconnect time.Duration
 	protoBackoff   time.Duration
+	// protoBackoffMax cap of the reconnect and retry backoffs
+	protoBackoffMax time.Duration
 }
 
 // Client agent gateway client
 // Client agent gateway client
 type Client struct {
-	address          string
 	version          string
 	startID          string
-	AccountID        uuid.UUID
-	ClusterID        uuid.UUID
-	secret           []byte
 	ServerVersion    string
 	AgentPermissions string
 	ClusterProvider  string
 
-	channel    *channel.Client
-	connected  bool
-	authorized bool
+	endpoints *endpoints
+	proxy     *ProxyConfig
+	tlsConfig *tls.Config
+
+	// state of the connection, the live connection to the gateway, status of the last connection attempt
+	statusM            sync.Mutex
+	state              ConnectionState
+	nextRetry          time.Time
+	wake               chan struct{}
+	reauthorization    chan struct{}
+	suspended          bool
+	capabilities       *proto.Capabilities
+	codec              proto.Codec
+	peer               *peer
+	proxyAddr          string
+	lastError          error
+	lastErrorTime      time.Time
+	lastErrorFromProxy bool
+
+	// suspendedRecheck interval between retries while the gateway doesn't know the cluster
+	suspendedRecheck time.Duration
+	onSuspend        func(suspended bool)
+
+	// credentials and the previous ones accepted until previousExpiry after a rotation
+	credentialsM           sync.Mutex
+	credentials            Credentials
+	previousCredentials    *Credentials
+	previousExpiry         time.Time
+	credentialsDir         string
+	credentialsGracePeriod time.Duration
+	// authorized credentials the live connection was authorized with
+	authorized Credentials
+
+	// supported capabilities advertised in the hello
+	supported proto.Capabilities
+
+	// listeners of the endpoints the gateway sends requests to
+	listenersM sync.RWMutex
+	listeners  map[string]listener
 
 	shouldSendLogs bool
 	logBuffer      proto.PacketLogs
@@ -57,56 +90,71 @@ type Client struct {
 	pipe       *Pipe
 	pipeStatus *Pipe
 
+	watchdog       *watchdog
 	watchdogTicker *time.Ticker
 }
 
 // newClient creates a new client
-func newClient(
-	address string,
-	version string,
-	startID string,
-	accountID uuid.UUID,
-	clusterID uuid.UUID,
-	secret []byte,
-	serverVersion string,
-	agentPermissions string,
-	clusterProvider string,
-	timeouts timeouts,
-	shouldSendLogs bool,
-) *Client {
-	gwUrl, err := url.Parse(address)
+func newClient(options Options) *Client {
+	endpoints, err := ParseEndpoints(options.GatewayURL)
 	if err != nil {
 		panic(err)
 	}
 
-	address = gwUrl.String()
-
 	client := &Client{
-		address:          address,
-		version:          version,
-		startID:          startID,
-		AccountID:        accountID,
-		ClusterID:        clusterID,
-		secret:           secret,
-		ServerVersion:    serverVersion,
-		shouldSendLogs:   shouldSendLogs,
-		AgentPermissions: agentPermissions,
-		ClusterProvider:  clusterProvider,
-		channel: channel.NewClient(*gwUrl, channel.ChannelOptions{
-			ProtoHandshake: timeouts.protoHandshake,
-			ProtoWrite:     timeouts.protoWrite,
-			ProtoRead:      timeouts.protoRead,
-			ProtoReconnect: timeouts.protoReconnect,
-		}),
-		logBuffer: make(proto.PacketLogs, 0, 10),
-		blocked:   sync.Map{},
-		blockedM:  sync.Mutex{},
-		logM:      sync.Mutex{},
-
-		timeouts: timeouts,
-	}
+		version:          options.Version,
+		startID:          options.StartID,
+		ServerVersion:    options.ServerVersion,
+		shouldSendLogs:   options.SendLogs,
+		AgentPermissions: options.AgentPermissions,
+		ClusterProvider:  options.ClusterProvider,
+		endpoints:        newEndpoints(endpoints, options.FailoverThreshold, options.FailbackCooldown),
+		proxy:            options.Proxy,
+		tlsConfig:        options.TLSConfig,
+		listeners:        make(map[string]listener),
+		state:            StateDisconnected,
+		wake:             make(chan struct{}, 1),
+		reauthorization:  make(chan struct{}, 1),
+		logBuffer:        make(proto.PacketLogs, 0, 10),
+		blocked:          sync.Map{},
+		blockedM:         sync.Mutex{},
+		logM:             sync.Mutex{},
+
+		timeouts: options.timeouts(),
+
+		credentials: Credentials{
+			AccountID: options.AccountID,
+			ClusterID: options.ClusterID,
+			Secret:    options.Secret,
+		},
+		credentialsDir:         options.CredentialsDir,
+		credentialsGracePeriod: options.CredentialsGracePeriod,
+		suspendedRecheck:       options.SuspendedRecheck,
 
-	client.pipe = NewPipe(client)
+		watchdog: newWatchdog(options.WatchdogInterval, options.WatchdogMaxFailures, options.WatchdogSlowPong),
+
+		supported: agentCapabilities,
+	}
+	if len(options.ZstdDictionary) > 0 {
+		compressor, err := proto.NewZstdCompressor(options.ZstdDictionary)
+		if err != nil {
+			panic(err)
+		}
+		proto.RegisterCompressor(compressor)
+		client.supported.Compression = append([]string{compressor.Name()}, agentCapabilities.Compression...)
+		client.supported.ZstdDictionaryID = compressor.DictionaryID()
+	}
+	client.supported.MaxPacketSize = options.MaxPacketSize
+
+	client.pipe = NewPipeWithStore(client, NewBoundedPipeStore(options.PipeMaxBytes))
+	if options.PipeStoreDir != "" {
+		store, err := NewDiskPipeStore(options.PipeStoreDir, options.PipeMaxBytes)
+		if err != nil {
+			logger.Errorw("unable to open pipe store, pending packets will be kept in memory", "error", err)
+		} else {
+			client.pipe = NewPipeWithStore(client, store)
+		}
+	}
 	client.pipeStatus = NewPipe(client)
 
 	return client
@@ -119,7 +167,7 @@ func newClient(
 // Example:
 //   WaitForConnection(time.Second * 10)
 func (client *Client) WaitForConnection(timeout time.Duration) bool {
-	if client.authorized {
+	if client.IsReady() {
 		return true
 	}
 	c := make(chan struct{})
@@ -146,17 +194,15 @@ func (client *Client) WithBackoff(fn func() error) {
 
 func (client *Client) WithBackoffLimit(fn func() error, limit int) error {
 	var err error
+	backoff := NewBackoff(client.timeouts.protoBackoff, client.timeouts.protoBackoffMax)
 	for try := 0; try < limit; try++ {
 		err = fn()
 		if err == nil {
 			break
 		}
 
-		// 300ms -> 600ms -> [...] -> 3000ms -> 300ms
-		timeout := client.timeouts.protoBackoff * time.Duration(try%10+1)
-
 		if try+1 < limit {
-			time.Sleep(timeout)
+			time.Sleep(backoff.Next())
 		}
 	}
 	if err != nil {
@@ -166,19 +212,30 @@ func (client *Client) WithBackoffLimit(fn func() error, limit int) error {
 }
 
 // send sends a packet to the agent-gateway
-// it uses the default proto encoding to encode and decode in/out parameters
+// it uses the negotiated codec to encode and decode in/out parameters
 func (client *Client) send(kind proto.PacketKind, in interface{}, out interface{}) error {
+	return client.sendChunked(kind, in, out, chunking{})
+}
+
+// sendChunked sends a packet, split in chunks if it's bigger than the max packet size
+func (client *Client) sendChunked(kind proto.PacketKind, in interface{}, out interface{}, options chunking) error {
 	var (
 		req []byte
+		res []byte
 		err error
 	)
 
-	req, err = proto.EncodeSnappy(in)
+	codec := client.CodecFor(kind)
+	req, err = codec.Encode(in)
 	if err != nil {
 		return err
 	}
 
-	res, err := client.channel.Send(kind.String(), req)
+	if chunkSize := client.chunkSize(kind, len(req)); chunkSize > 0 {
+		res, err = client.sendChunks(kind, req, chunkSize, options.encodingID(codec))
+	} else {
+		res, err = client.sendRequest(kind.String(), req)
+	}
 	if err != nil {
 		return err
 	}
@@ -191,7 +248,7 @@ func (client *Client) send(kind proto.PacketKind, in interface{}, out interface{
 		return nil
 	}
 
-	return proto.DecodeSnappy(res, out)
+	return codec.Decode(res, out)
 }
 
 // Send sends a packet to the agent-gateway if there is an established connection it internally uses client.send
@@ -208,15 +265,65 @@ func (client *Client) Send(kind proto.PacketKind, in interface{}, out interface{
 	return nil
 }
 
+// SendPackage sends a piped package, it's wrapped in an envelope and must be
+// acknowledged by the gateway if it negotiated envelopes in its hello
+func (client *Client) SendPackage(pack *Package) error {
+	client.WaitForConnection(time.Minute)
+	if !client.Accepts(pack.Kind) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedKind, pack.Kind)
+	}
+	if !client.HasFeature(proto.FeatureEnvelope) {
+		return client.Send(pack.Kind, pack.Data, nil)
+	}
+
+	logger.Debugw("sending package", "kind", pack.Kind, "id", pack.id, "attempt", pack.attempts)
+	envelope := proto.PacketEnvelope{
+		ID:       pack.id,
+		Stream:   pack.stream,
+		Sequence: pack.sequence,
+		Attempt:  pack.attempts,
+	}
+	// packages restored from the disk store get their types back so they're protobuf too
+	message, ok := pack.Data.(proto.ProtoMarshaler)
+	if ok && client.CodecFor(pack.Kind).Encoding.Name() == proto.EncodingProtobuf {
+		data, err := message.MarshalProto()
+		if err != nil {
+			return fmt.Errorf("unable to encode package data, error: %w", err)
+		}
+		envelope.Proto = data
+	} else {
+		data, err := json.Marshal(pack.Data)
+		if err != nil {
+			return fmt.Errorf("unable to encode package data, error: %w", err)
+		}
+		envelope.Data = data
+	}
+
+	var ack proto.PacketAck
+	err := client.sendChunked(pack.Kind, envelope, &ack, chunking{id: pack.id, attempt: pack.attempts, expiry: pack.ExpiryTime})
+	if err != nil {
+		logger.Errorw("sending package failed", "kind", pack.Kind, "id", pack.id)
+		return err
+	}
+	if ack.ID != pack.id {
+		return fmt.Errorf("gateway acknowledged package %s instead of %s", ack.ID, pack.id)
+	}
+	if ack.Duplicate {
+		logger.Infow("gateway already processed the package", "kind", pack.Kind, "id", pack.id, "attempt", pack.attempts)
+	}
+	logger.Debugw("package sent", "kind", pack.Kind, "id", pack.id)
+	return nil
+}
+
 // PipeStatus send status packages to the agent-gateway with defined priorities and expiration rules
 // TODO remove
 func (client *Client) PipeStatus(pack Package) {
 	if client.pipeStatus == nil {
 		panic("client pipeStatus not defined")
 	}
-	i := client.pipeStatus.Send(pack)
-	if i > 0 {
-		logger.Errorw("discarded packets to agent-gateway", "#packets", i)
+	dropped := client.pipeStatus.Send(pack)
+	if dropped.Packets() > 0 {
+		logger.Errorw("discarded packets to agent-gateway", "#packets", dropped.Packets())
 	}
 }
 
@@ -225,55 +332,40 @@ func (client *Client) Pipe(pack Package) error {
 	if client.pipe == nil {
 		panic("client pipe not defined")
 	}
-	i := client.pipe.Send(pack)
-	if i > 0 {
-		return fmt.Errorf("dropped %d packets", i)
+	dropped := client.pipe.Send(pack)
+	if dropped.Packets() > 0 {
+		return fmt.Errorf(
+			"dropped %d packets (%d bytes), %d expired and %d evicted to stay within the pipe size limit",
+			dropped.Packets(), dropped.Bytes(), dropped.Expired, dropped.Evicted,
+		)
 	}
 	return nil
 }
 
+// PipeStats gets the pending and dropped packages of the pipe
+func (client *Client) PipeStats() PipeStats {
+	return client.pipe.Stats()
+}
+
 // AddListener adds a listener for a specific packet kind
 func (client *Client) AddListener(kind proto.PacketKind, listener func(in []byte) ([]byte, error)) {
-	if err := client.channel.AddListener(kind.String(), listener); err != nil {
-		panic(err)
+	client.listenersM.Lock()
+	defer client.listenersM.Unlock()
+	if _, ok := client.listeners[kind.String()]; ok {
+		panic(fmt.Sprintf("listener already exists for %s", kind))
 	}
+	client.listeners[kind.String()] = listener
+}
+
+// listener returns the listener of an endpoint
+func (client *Client) listener(endpoint string) (listener, bool) {
+	client.listenersM.RLock()
+	defer client.listenersM.RUnlock()
+	listener, ok := client.listeners[endpoint]
+	return listener, ok
 }
 
 // InitClient inits client
-func InitClient(
-	version string,
-	startID string,
-	accountID, clusterID uuid.UUID,
-	secret []byte,
-	serverVersion string,
-	agentPermissions string,
-	clusterProvider string,
-	gatewayUrl string,
-	protoHandshake time.Duration,
-	protoWrite time.Duration,
-	protoRead time.Duration,
-	protoReconnect time.Duration,
-	protoBackoff time.Duration,
-	sendLogs bool,
-) *Client {
-	client := newClient(
-		gatewayUrl,
-		version,
-		startID,
-		accountID,
-		clusterID,
-		secret,
-		serverVersion,
-		agentPermissions,
-		clusterProvider,
-		timeouts{
-			protoHandshake: protoHandshake,
-			protoWrite:     protoWrite,
-			protoRead:      protoRead,
-			protoReconnect: protoReconnect,
-			protoBackoff:   protoBackoff,
-		},
-		sendLogs,
-	)
-	return client
+func InitClient(options Options) *Client {
+	return newClient(options)
 }
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	// names of the credentials files, the keys of the agent secret when it's mounted
+	AccountIDFileName = "ACCOUNT_ID"
+	ClusterIDFileName = "CLUSTER_ID"
+	SecretFileName    = "SECRET"
+
+	credentialsPollInterval = 10 * time.Second
+)
+
+// Credentials identify and authenticate the agent with the gateway
+type Credentials struct {
+	AccountID uuid.UUID
+	ClusterID uuid.UUID
+	Secret    []byte
+}
+
+func (c Credentials) sameIdentity(other Credentials) bool {
+	return c.AccountID == other.AccountID && c.ClusterID == other.ClusterID
+}
+
+func (c Credentials) equal(other Credentials) bool {
+	return c.sameIdentity(other) && bytes.Equal(c.Secret, other.Secret)
+}
+
+// ReadCredentials reads the credentials from the files of a mounted secret,
+// the secret file holds the base64 encoded secret like the SECRET env var
+func ReadCredentials(dir string) (Credentials, error) {
+	read := func(name string) (string, error) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", fmt.Errorf("unable to read credentials file, error: %w", err)
+		}
+		return string(bytes.TrimSpace(data)), nil
+	}
+
+	var credentials Credentials
+	accountID, err := read(AccountIDFileName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	credentials.AccountID, err = uuid.FromString(accountID)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid account id in %s, error: %w", AccountIDFileName, err)
+	}
+
+	clusterID, err := read(ClusterIDFileName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	credentials.ClusterID, err = uuid.FromString(clusterID)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid cluster id in %s, error: %w", ClusterIDFileName, err)
+	}
+
+	secret, err := read(SecretFileName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	credentials.Secret, err = base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to decode base64 secret in %s, error: %w", SecretFileName, err)
+	}
+
+	return credentials, nil
+}
+
+// getCredentials returns the current credentials, and the previous ones if
+// the last rotation is still in its grace period
+func (client *Client) getCredentials() (Credentials, *Credentials) {
+	client.credentialsM.Lock()
+	defer client.credentialsM.Unlock()
+	if client.previousCredentials != nil && time.Now().Before(client.previousExpiry) {
+		previous := *client.previousCredentials
+		return client.credentials, &previous
+	}
+	return client.credentials, nil
+}
+
+// UpdateCredentials replaces the credentials, the live connection is authorized
+// again by the connection loop and dropped if they're refused. The previous
+// credentials are still tried for the grace period in case the gateway doesn't
+// accept the new ones yet.
+func (client *Client) UpdateCredentials(credentials Credentials) error {
+	client.credentialsM.Lock()
+	current := client.credentials
+	if current.equal(credentials) {
+		client.credentialsM.Unlock()
+		return nil
+	}
+	client.previousCredentials = &current
+	client.previousExpiry = time.Now().Add(client.credentialsGracePeriod)
+	client.credentials = credentials
+	client.credentialsM.Unlock()
+
+	logger.Infow(
+		"credentials changed",
+		"accountID", credentials.AccountID,
+		"clusterID", credentials.ClusterID,
+		"grace_period", client.credentialsGracePeriod,
+	)
+	if !client.IsReady() {
+		// the next connection is authorized with them, a suspended agent retries right away
+		client.wakeUp()
+	}
+	// the connection may become ready with the previous ones meanwhile
+	select {
+	case client.reauthorization <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// reauthorize authorizes the live connection again with the current credentials,
+// it's back to authorizing meanwhile so nothing else is sent on it
+func (client *Client) reauthorize() error {
+	credentials, _ := client.getCredentials()
+	client.credentialsM.Lock()
+	authorized := client.authorized
+	client.credentialsM.Unlock()
+	if authorized.equal(credentials) {
+		return nil
+	}
+
+	if !authorized.sameIdentity(credentials) {
+		client.setState(StateHello, time.Time{})
+		err := client.hello(credentials)
+		if err != nil {
+			return fmt.Errorf("unable to say hello with the new credentials, error: %w", err)
+		}
+	}
+	client.setState(StateAuthorizing, time.Time{})
+	err := client.authorizeRotating(credentials)
+	if err != nil {
+		return client.authorizationError(err)
+	}
+	return nil
+}
+
+// authorizeRotating authorizes with the current credentials, hello must have
+// been said with them. If they're rejected during the grace period of a rotation
+// the previous credentials are tried.
+func (client *Client) authorizeRotating(current Credentials) error {
+	err := client.authorize(current)
+	if err == nil {
+		client.setAuthorized(current)
+		return nil
+	}
+
+	_, previous := client.getCredentials()
+	if previous == nil {
+		return err
+	}
+	logger.Warnw(
+		"current credentials rejected, authorizing with the previous ones during the grace period",
+		"error", err,
+	)
+	if !previous.sameIdentity(current) {
+		helloErr := client.hello(*previous)
+		if helloErr != nil {
+			return helloErr
+		}
+	}
+	err = client.authorize(*previous)
+	if err != nil {
+		return err
+	}
+	client.setAuthorized(*previous)
+	return nil
+}
+
+func (client *Client) setAuthorized(credentials Credentials) {
+	client.credentialsM.Lock()
+	defer client.credentialsM.Unlock()
+	client.authorized = credentials
+}
+
+// WatchCredentials reloads the credentials from dir whenever they change until ctx is done
+func (client *Client) WatchCredentials(ctx context.Context, dir string) error {
+	ticker := time.NewTicker(credentialsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		credentials, err := ReadCredentials(dir)
+		if err != nil {
+			// the secret may be half written while it rotates
+			logger.Warnw("unable to reload credentials", "dir", dir, "error", err)
+			continue
+		}
+		err = client.UpdateCredentials(credentials)
+		if err != nil {
+			logger.Errorw("unable to apply new credentials", "error", err)
+		}
+	}
+}
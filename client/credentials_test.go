@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+func writeCredentials(t *testing.T, dir string, accountID, clusterID, secret string) {
+	files := map[string]string{
+		AccountIDFileName: accountID,
+		ClusterIDFileName: clusterID,
+		SecretFileName:    secret,
+	}
+	for name, value := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0o600)
+		if err != nil {
+			t.Fatalf("unable to write %s, error: %v", name, err)
+		}
+	}
+}
+
+func TestReadCredentials(t *testing.T) {
+	accountID := uuid.NewV4()
+	clusterID := uuid.NewV4()
+
+	dir := t.TempDir()
+	writeCredentials(t, dir, accountID.String(), clusterID.String()+"\n", "c2VjcmV0\n")
+	credentials, err := ReadCredentials(dir)
+	if err != nil {
+		t.Fatalf("ReadCredentials() error = %v", err)
+	}
+	if credentials.AccountID != accountID || credentials.ClusterID != clusterID ||
+		!bytes.Equal(credentials.Secret, []byte("secret")) {
+		t.Errorf("ReadCredentials() = %+v", credentials)
+	}
+
+	writeCredentials(t, dir, accountID.String(), clusterID.String(), "not base64!")
+	_, err = ReadCredentials(dir)
+	if err == nil {
+		t.Errorf("ReadCredentials() should reject a secret that isn't base64")
+	}
+
+	_, err = ReadCredentials(t.TempDir())
+	if err == nil {
+		t.Errorf("ReadCredentials() should fail without credentials files")
+	}
+}
+
+func TestClient_UpdateCredentials(t *testing.T) {
+	old := Credentials{AccountID: uuid.NewV4(), ClusterID: uuid.NewV4(), Secret: []byte("old")}
+	rotated := Credentials{AccountID: old.AccountID, ClusterID: old.ClusterID, Secret: []byte("new")}
+
+	client := &Client{credentials: old, credentialsGracePeriod: time.Hour, reauthorization: make(chan struct{}, 1)}
+	err := client.UpdateCredentials(old)
+	if err != nil {
+		t.Fatalf("UpdateCredentials() error = %v", err)
+	}
+	if _, previous := client.getCredentials(); previous != nil {
+		t.Errorf("unchanged credentials shouldn't start a grace period")
+	}
+
+	err = client.UpdateCredentials(rotated)
+	if err != nil {
+		t.Fatalf("UpdateCredentials() error = %v", err)
+	}
+	current, previous := client.getCredentials()
+	if !current.equal(rotated) {
+		t.Errorf("current credentials = %+v, want the rotated ones", current)
+	}
+	if previous == nil || !previous.equal(old) {
+		t.Errorf("previous credentials = %+v, want the old ones during the grace period", previous)
+	}
+	select {
+	case <-client.reauthorization:
+	default:
+		t.Errorf("the connection loop should be asked to authorize again")
+	}
+	// the connection became ready with the rotated credentials meanwhile
+	client.setAuthorized(rotated)
+	if err := client.reauthorize(); err != nil {
+		t.Errorf("reauthorize() error = %v, want nothing to do", err)
+	}
+
+	client.previousExpiry = time.Now().Add(-time.Second)
+	if _, previous := client.getCredentials(); previous != nil {
+		t.Errorf("previous credentials = %+v, want none after the grace period", previous)
+	}
+}
@@ -0,0 +1,493 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	// diskLogName name of the log of the packages in the pipe store directory
+	diskLogName = "pipe.log"
+	// diskSyncInterval max time a record waits in the page cache before it's synced,
+	// records written since the last sync can be lost if the host crashes
+	diskSyncInterval = time.Second
+	// diskCompactMinRecords the log is compacted once it has this many records
+	// and more than twice as many as pending packages
+	diskCompactMinRecords = 1024
+)
+
+// diskPackage is the on-disk form of a package, the data is kept encoded as json
+type diskPackage struct {
+	Kind        proto.PacketKind `json:"kind"`
+	ExpiryTime  *time.Time       `json:"expiry_time,omitempty"`
+	ExpiryCount int              `json:"expiry_count,omitempty"`
+	Priority    int              `json:"priority"`
+	Retries     int              `json:"retries,omitempty"`
+	Tries       int              `json:"tries,omitempty"`
+	Time        time.Time        `json:"time"`
+	ID          uuid.UUID        `json:"id"`
+	Stream      uuid.UUID        `json:"stream"`
+	Sequence    uint64           `json:"sequence"`
+	Attempts    int              `json:"attempts,omitempty"`
+	Data        json.RawMessage  `json:"data"`
+}
+
+// diskRecord a line of the log, it adds or replaces the package with seq or removes it
+type diskRecord struct {
+	Seq     uint64       `json:"seq"`
+	Remove  bool         `json:"remove,omitempty"`
+	Package *diskPackage `json:"package,omitempty"`
+}
+
+// DiskPipeStore is a PipeStore that keeps the pending packages in an append-only
+// log so they survive agent restarts. Ordering and expiry are delegated to a
+// DefaultPipeStore, the log only mirrors its content.
+// Every add and remove appends a line to the log, the log is synced at most
+// every diskSyncInterval instead of on every write and it's rewritten with the
+// pending packages only once removed ones make most of it.
+// A package that can't be written, e.g. when the disk is full, is still
+// queued in memory and is only lost if the agent restarts before sending it.
+type DiskPipeStore struct {
+	sync.Mutex
+
+	dir string
+	mem *DefaultPipeStore
+
+	log *os.File
+	// size of the log, a failed write is truncated back to it
+	size int64
+	// records number of lines of the log
+	records int
+	// syncTimer pending sync of the log, nil if everything is synced
+	syncTimer *time.Timer
+
+	// seq of the record of every persisted package
+	files map[*Package]uint64
+	// popped packages are kept on disk until they're acked or added back
+	inflight map[*Package]struct{}
+	nextSeq  uint64
+}
+
+// NewDiskPipeStore creates a store persisting packages in dir, packages left
+// in dir by a previous run are loaded back unless they've expired since.
+// maxBytes is the byte budget of the pending packages, 0 means unbounded.
+func NewDiskPipeStore(dir string, maxBytes int) (*DiskPipeStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create pipe store directory, error: %w", err)
+	}
+
+	s := &DiskPipeStore{
+		dir:      dir,
+		mem:      NewBoundedPipeStore(maxBytes),
+		files:    map[*Package]uint64{},
+		inflight: map[*Package]struct{}{},
+	}
+	s.mem.onRemove = s.onRemove
+
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *DiskPipeStore) logPath() string {
+	return filepath.Join(s.dir, diskLogName)
+}
+
+// load replays the log left by a previous run then compacts it
+func (s *DiskPipeStore) load() error {
+	stored, err := readDiskLog(s.logPath())
+	if err != nil {
+		return err
+	}
+
+	seqs := make([]uint64, 0, len(stored))
+	for seq := range stored {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	dropped := DropStats{}
+	for _, seq := range seqs {
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+		pack, err := stored[seq].pack()
+		if err != nil {
+			logger.Warnw("discarding unreadable pipe store package", "seq", seq, "error", err)
+			continue
+		}
+		s.files[pack] = seq
+		drops := s.mem.Add(pack)
+		dropped.Expired += drops.Expired
+		dropped.Evicted += drops.Evicted
+	}
+
+	err = s.rewrite(stored)
+	if err != nil {
+		return err
+	}
+
+	if len(seqs) > 0 {
+		logger.Infow(
+			"loaded pending packages from pipe store",
+			"dir", s.dir,
+			"pending", s.mem.Len(),
+			"dropped", dropped.Packets(),
+		)
+	}
+	return nil
+}
+
+// readDiskLog returns the last record of every package still in the log,
+// unreadable lines, e.g. the last one after a crash, are skipped
+func readDiskLog(path string) (map[uint64]*diskPackage, error) {
+	stored := map[uint64]*diskPackage{}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return stored, nil
+		}
+		return nil, fmt.Errorf("unable to open pipe store log, error: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	skipped := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record diskRecord
+			if json.Unmarshal(line, &record) != nil || (!record.Remove && record.Package == nil) {
+				skipped++
+			} else if record.Remove {
+				delete(stored, record.Seq)
+			} else {
+				stored[record.Seq] = record.Package
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pipe store log, error: %w", err)
+		}
+	}
+	if skipped > 0 {
+		logger.Warnw("skipped unreadable pipe store records", "path", path, "count", skipped)
+	}
+	return stored, nil
+}
+
+// rewrite replaces the log with the records of the persisted packages, it's
+// replaced atomically so a crash never leaves a partial log behind
+func (s *DiskPipeStore) rewrite(stored map[uint64]*diskPackage) error {
+	seqs := make([]uint64, 0, len(s.files))
+	for _, seq := range s.files {
+		if stored[seq] != nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	path := s.logPath()
+	file, err := ioutil.TempFile(s.dir, diskLogName+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create pipe store log, error: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	var size int64
+	for _, seq := range seqs {
+		line, err := encodeDiskRecord(diskRecord{Seq: seq, Package: stored[seq]})
+		if err != nil {
+			return err
+		}
+		n, err := writer.Write(line)
+		if err != nil {
+			return fmt.Errorf("unable to write pipe store log, error: %w", err)
+		}
+		size += int64(n)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("unable to write pipe store log, error: %w", err)
+	}
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync pipe store log, error: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write pipe store log, error: %w", err)
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("unable to replace pipe store log, error: %w", err)
+	}
+
+	log, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open pipe store log, error: %w", err)
+	}
+	if s.log != nil {
+		s.log.Close()
+	}
+	s.log = log
+	s.size = size
+	s.records = len(seqs)
+	return nil
+}
+
+// compact rewrites the log once removed packages make most of it
+func (s *DiskPipeStore) compact() {
+	if s.records < diskCompactMinRecords || s.records <= 2*len(s.files) {
+		return
+	}
+	stored, err := readDiskLog(s.logPath())
+	if err == nil {
+		err = s.rewrite(stored)
+	}
+	if err != nil {
+		logger.Warnw("unable to compact pipe store log", "dir", s.dir, "error", err)
+	}
+}
+
+func encodeDiskRecord(record diskRecord) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode package, error: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// append writes a record at the end of the log, it's synced by syncLog later
+func (s *DiskPipeStore) append(record diskRecord) error {
+	if s.log == nil {
+		return errors.New("pipe store log isn't open")
+	}
+	line, err := encodeDiskRecord(record)
+	if err != nil {
+		return err
+	}
+	n, err := s.log.Write(line)
+	if err != nil {
+		// a partial line would hide the next record
+		if n > 0 {
+			_ = s.log.Truncate(s.size)
+		}
+		return fmt.Errorf("unable to write pipe store log, error: %w", err)
+	}
+	s.size += int64(n)
+	s.records++
+	if s.syncTimer == nil {
+		s.syncTimer = time.AfterFunc(diskSyncInterval, s.syncLog)
+	}
+	return nil
+}
+
+func (s *DiskPipeStore) syncLog() {
+	s.Lock()
+	defer s.Unlock()
+	s.syncTimer = nil
+	if s.log == nil {
+		return
+	}
+	err := s.log.Sync()
+	if err != nil {
+		logger.Warnw("unable to sync pipe store log", "dir", s.dir, "error", err)
+	}
+}
+
+// Close syncs and closes the log, the store must not be used afterwards
+func (s *DiskPipeStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.syncTimer != nil {
+		s.syncTimer.Stop()
+		s.syncTimer = nil
+	}
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Sync()
+	if err == nil {
+		err = s.log.Close()
+	} else {
+		s.log.Close()
+	}
+	s.log = nil
+	return err
+}
+
+// pack turns a stored package back into a package, the packets of kinds that
+// have a protobuf definition get their type back so they're encoded as protobuf
+func (stored *diskPackage) pack() (*Package, error) {
+	data, err := proto.UnmarshalPacketJSON(stored.Kind, stored.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Package{
+		Kind:        stored.Kind,
+		ExpiryTime:  stored.ExpiryTime,
+		ExpiryCount: stored.ExpiryCount,
+		Priority:    stored.Priority,
+		Retries:     stored.Retries,
+		retries:     stored.Tries,
+		time:        stored.Time,
+		id:          stored.ID,
+		stream:      stored.Stream,
+		sequence:    stored.Sequence,
+		attempts:    stored.Attempts,
+		Data:        data,
+	}, nil
+}
+
+func newDiskPackage(pack *Package) (*diskPackage, error) {
+	data, err := json.Marshal(pack.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode package data, error: %w", err)
+	}
+	return &diskPackage{
+		Kind:        pack.Kind,
+		ExpiryTime:  pack.ExpiryTime,
+		ExpiryCount: pack.ExpiryCount,
+		Priority:    pack.Priority,
+		Retries:     pack.Retries,
+		Tries:       pack.retries,
+		Time:        pack.time,
+		ID:          pack.id,
+		Stream:      pack.stream,
+		Sequence:    pack.sequence,
+		Attempts:    pack.attempts,
+		Data:        data,
+	}, nil
+}
+
+// write appends the record of pack
+func (s *DiskPipeStore) write(seq uint64, pack *Package) error {
+	stored, err := newDiskPackage(pack)
+	if err != nil {
+		return err
+	}
+	return s.append(diskRecord{Seq: seq, Package: stored})
+}
+
+// onRemove is called by the memory store with s locked
+func (s *DiskPipeStore) onRemove(pack *Package) {
+	if _, ok := s.inflight[pack]; ok {
+		return
+	}
+	s.forget(pack)
+}
+
+func (s *DiskPipeStore) forget(pack *Package) {
+	delete(s.inflight, pack)
+	seq, ok := s.files[pack]
+	if !ok {
+		return
+	}
+	delete(s.files, pack)
+	// the log is only open once it's loaded, packages dropped while loading
+	// are left out of it by the rewrite
+	if s.log == nil {
+		return
+	}
+	err := s.append(diskRecord{Seq: seq, Remove: true})
+	if err != nil {
+		logger.Warnw("unable to remove pipe store package", "seq", seq, "error", err)
+		return
+	}
+	s.compact()
+}
+
+func (s *DiskPipeStore) Add(pack *Package) DropStats {
+	if pack == nil {
+		panic("programming error, make sure you don't pass nil package")
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if (pack.time == time.Time{}) {
+		pack.time = time.Now()
+	}
+	delete(s.inflight, pack)
+
+	// retried packages are written again to keep their priority and tries
+	seq, ok := s.files[pack]
+	if !ok {
+		seq = s.nextSeq
+		s.nextSeq++
+	}
+	err := s.write(seq, pack)
+	if err != nil {
+		logger.Warnw(
+			"unable to persist package, keeping it in memory only",
+			"kind", pack.Kind,
+			"error", err,
+		)
+		if ok {
+			s.forget(pack)
+		}
+	} else {
+		s.files[pack] = seq
+	}
+
+	return s.mem.Add(pack)
+}
+
+func (s *DiskPipeStore) Peek() *Package {
+	s.Lock()
+	defer s.Unlock()
+	return s.mem.Peek()
+}
+
+// Ack removes the package from the log, it is also used to ack popped packages once sent
+func (s *DiskPipeStore) Ack(pack *Package) {
+	s.Lock()
+	defer s.Unlock()
+	s.mem.Ack(pack)
+	s.forget(pack)
+}
+
+// Pop removes the first package from the queue but keeps it in the log until
+// it is acked, so a package is not lost if the agent stops while sending it
+func (s *DiskPipeStore) Pop() *Package {
+	s.Lock()
+	defer s.Unlock()
+	pack := s.mem.Peek()
+	if pack != nil {
+		s.inflight[pack] = struct{}{}
+		s.mem.Ack(pack)
+	}
+	return pack
+}
+
+func (s *DiskPipeStore) Len() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.mem.Len()
+}
+
+func (s *DiskPipeStore) Stats() PipeStats {
+	s.Lock()
+	defer s.Unlock()
+	return s.mem.Stats()
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/uuid-go"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiskPipeStore_Restart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskPipeStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskPipeStore() error = %v", err)
+	}
+
+	s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 2, Data: map[string]string{"name": "low"}})
+	s.Add(&Package{Kind: proto.PacketKindHello, Priority: 1, Data: map[string]string{"name": "acked"}})
+	inflight := &Package{Kind: proto.PacketKindHello, Priority: 1, id: uuid.NewV4(), sequence: 7, attempts: 1, Data: map[string]string{"name": "in-flight"}}
+	s.Add(inflight)
+	s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 1, ExpiryTime: after(50 * time.Millisecond), Data: "expires"})
+
+	s.Ack(s.Pop())
+	// popped but never acked, e.g. the agent stopped while sending it
+	if pack := s.Pop(); pack == nil {
+		t.Fatalf("Pop() = nil")
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.Close()
+
+	restarted, err := NewDiskPipeStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskPipeStore() error = %v", err)
+	}
+	if got := restarted.Len(); got != 2 {
+		t.Fatalf("Len() after restart = %v, want 2", got)
+	}
+
+	for _, want := range []string{"in-flight", "low"} {
+		pack := restarted.Pop()
+		if pack == nil {
+			t.Fatalf("Pop() = nil, want %s", want)
+		}
+		var data map[string]string
+		err := json.Unmarshal(pack.Data.(json.RawMessage), &data)
+		if err != nil {
+			t.Fatalf("unable to decode package data, error: %v", err)
+		}
+		if data["name"] != want {
+			t.Errorf("Pop() = %v, want %s", data, want)
+		}
+		// retries after a restart are still recognized by the gateway
+		if want == "in-flight" && (pack.id != inflight.id || pack.sequence != 7 || pack.attempts != 1) {
+			t.Errorf("Pop() id = %s, sequence = %d, attempts = %d, want them kept", pack.id, pack.sequence, pack.attempts)
+		}
+		restarted.Ack(pack)
+	}
+	restarted.Close()
+
+	restarted, err = NewDiskPipeStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskPipeStore() error = %v", err)
+	}
+	if got := restarted.Len(); got != 0 {
+		t.Errorf("Len() after acking every package = %v, want 0", got)
+	}
+	restarted.Close()
+}
+
+// newDiskPipeStore opens a store in dir that is closed when the test ends
+func newDiskPipeStore(t *testing.T, dir string) *DiskPipeStore {
+	s, err := NewDiskPipeStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDiskPipeStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDiskPipeStore_RestoreTypes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	deltas := &proto.PacketEntitiesDeltasRequest{
+		Items: []proto.PacketEntityDelta{{
+			Gvrk: proto.GroupVersionResourceKind{
+				GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Kind:                 "Pod",
+			},
+			DeltaKind: proto.EntityEventTypeUpsert,
+			Namespace: "default",
+			Name:      "web",
+			Timestamp: now,
+			Data:      map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(2)}},
+		}},
+		Timestamp: now,
+	}
+	audit := &proto.PacketAuditResultRequest{
+		Items:     []*proto.PacketAuditResultItem{{Id: "result", Status: proto.AuditResultStatusViolating, Controls: []string{"c1"}}},
+		Timestamp: now,
+	}
+
+	s := newDiskPipeStore(t, dir)
+	s.Add(&Package{Kind: proto.PacketKindEntitiesDeltas, Priority: 1, Data: deltas})
+	s.Add(&Package{Kind: proto.PacketKindAuditResultRequest, Priority: 2, Data: audit})
+	s.Close()
+
+	restarted := newDiskPipeStore(t, dir)
+	for _, want := range []interface{}{deltas, audit} {
+		pack := restarted.Pop()
+		if pack == nil {
+			t.Fatalf("Pop() = nil, want %T", want)
+		}
+		// restored packets are still encoded as protobuf and decode on the gateway
+		message, ok := pack.Data.(proto.ProtoMarshaler)
+		if !ok {
+			t.Fatalf("Pop() data = %T, want %T", pack.Data, want)
+		}
+		data, err := message.MarshalProto()
+		if err != nil {
+			t.Fatalf("MarshalProto() error = %v", err)
+		}
+		got := reflect.New(reflect.TypeOf(want).Elem()).Interface().(proto.ProtoUnmarshaler)
+		err = got.UnmarshalProto(data)
+		if err != nil {
+			t.Fatalf("UnmarshalProto() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("restored %s = %+v, want %+v", pack.Kind, got, want)
+		}
+		restarted.Ack(pack)
+	}
+}
+
+func TestDiskPipeStore_TruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	s := newDiskPipeStore(t, dir)
+	s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 1, Data: "kept"})
+	s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 1, Data: "cut"})
+	s.Close()
+
+	// the host crashed in the middle of the last record
+	path := filepath.Join(dir, diskLogName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unable to stat log, error: %v", err)
+	}
+	err = os.Truncate(path, info.Size()-10)
+	if err != nil {
+		t.Fatalf("unable to truncate log, error: %v", err)
+	}
+
+	restarted := newDiskPipeStore(t, dir)
+	if got := restarted.Len(); got != 1 {
+		t.Fatalf("Len() after restart = %v, want 1", got)
+	}
+	// the log is usable again after the partial record
+	restarted.Add(&Package{Kind: proto.PacketKindLogs, Priority: 1, Data: "added"})
+	restarted.Close()
+
+	restarted = newDiskPipeStore(t, dir)
+	for _, want := range []string{"kept", "added"} {
+		pack := restarted.Pop()
+		if pack == nil || string(pack.Data.(json.RawMessage)) != fmt.Sprintf("%q", want) {
+			t.Fatalf("Pop() = %+v, want %s", pack, want)
+		}
+	}
+}
+
+func TestDiskPipeStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+	s := newDiskPipeStore(t, dir)
+	pending := &Package{Kind: proto.PacketKindLogs, Priority: 1, Data: "pending"}
+	s.Add(pending)
+	for i := 0; i < 4*diskCompactMinRecords; i++ {
+		// the pending package keeps being retried while the others are sent
+		retry := s.Pop()
+		s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 2, Data: i})
+		s.Ack(s.Pop())
+		s.Add(retry)
+	}
+
+	s.Lock()
+	records := s.records
+	s.Unlock()
+	if records > 2*diskCompactMinRecords {
+		t.Errorf("log has %d records, want it compacted", records)
+	}
+	s.Close()
+
+	restarted := newDiskPipeStore(t, dir)
+	if got := restarted.Len(); got != 1 {
+		t.Fatalf("Len() after restart = %v, want 1", got)
+	}
+	if pack := restarted.Pop(); string(pack.Data.(json.RawMessage)) != `"pending"` {
+		t.Errorf("Pop() = %s, want the pending package", pack.Data)
+	}
+}
+
+// BenchmarkDiskPipeStore measures the throughput of packages going through the
+// store, every package is written and removed from the log once
+func BenchmarkDiskPipeStore(b *testing.B) {
+	s, err := NewDiskPipeStore(b.TempDir(), 0)
+	if err != nil {
+		b.Fatalf("NewDiskPipeStore() error = %v", err)
+	}
+	defer s.Close()
+	data := map[string]string{"message": "a log line of a usual size for the agent to send"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Add(&Package{Kind: proto.PacketKindLogs, Priority: 1, Data: data})
+		s.Ack(s.Pop())
+	}
+}
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencySmoothing weight of the latest ping in the moving average of the latency
+const latencySmoothing = 0.3
+
+// Endpoint an agent gateway url, endpoints are weighted if any of them has a weight
+type Endpoint struct {
+	URL    *url.URL
+	Weight int
+}
+
+// ParseEndpoints parses a comma separated list of gateway urls in order of
+// preference, each may have a weight, e.g. wss://a/;weight=3,wss://b/;weight=1
+func ParseEndpoints(spec string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ";")
+		u, err := url.Parse(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway url %q, error: %w", parts[0], err)
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return nil, fmt.Errorf("invalid gateway url %q, expected a ws or wss scheme", parts[0])
+		}
+
+		endpoint := Endpoint{URL: u}
+		for _, option := range parts[1:] {
+			option = strings.TrimSpace(option)
+			weight, err := strconv.Atoi(strings.TrimPrefix(option, "weight="))
+			if !strings.HasPrefix(option, "weight=") || err != nil || weight < 1 {
+				return nil, fmt.Errorf("invalid gateway option %q, expected weight=<positive number>", option)
+			}
+			endpoint.Weight = weight
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no gateway url specified")
+	}
+	return endpoints, nil
+}
+
+// EndpointStatus health of a gateway endpoint
+type EndpointStatus struct {
+	URL    string
+	Weight int
+	Active bool
+	// Failures consecutive connection failures, reset when it's in cool-down
+	Failures int
+	// CooldownUntil the endpoint is avoided until then after too many failures
+	CooldownUntil time.Time
+	// Latency moving average of the ping round trips
+	Latency       time.Duration
+	LastError     string
+	LastErrorTime time.Time
+}
+
+type endpointState struct {
+	Endpoint
+	failures      int
+	cooldownUntil time.Time
+	latency       time.Duration
+	lastError     error
+	lastErrorTime time.Time
+}
+
+func (e *endpointState) available(now time.Time) bool {
+	return !now.Before(e.cooldownUntil)
+}
+
+// endpoints picks the gateway endpoint to connect to. Ordered endpoints are
+// preferred in order and failed back to once their cool-down is over, weighted
+// endpoints are picked at random by weight when the current one fails.
+type endpoints struct {
+	mutex     sync.Mutex
+	list      []*endpointState
+	current   int
+	weighted  bool
+	threshold int
+	cooldown  time.Duration
+}
+
+func newEndpoints(list []Endpoint, threshold int, cooldown time.Duration) *endpoints {
+	e := &endpoints{current: -1, threshold: threshold, cooldown: cooldown}
+	for _, endpoint := range list {
+		if endpoint.Weight > 0 {
+			e.weighted = true
+		}
+	}
+	for _, endpoint := range list {
+		if e.weighted && endpoint.Weight == 0 {
+			endpoint.Weight = 1
+		}
+		e.list = append(e.list, &endpointState{Endpoint: endpoint})
+	}
+	return e
+}
+
+// next selects the endpoint to connect to
+func (e *endpoints) next() *endpointState {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := time.Now()
+	if e.weighted {
+		if e.current < 0 || !e.list[e.current].available(now) {
+			e.current = e.pickWeighted(now)
+		}
+	} else {
+		e.current = e.preferred(now)
+	}
+	return e.list[e.current]
+}
+
+// preferred returns the first available endpoint, or the one whose cool-down ends first
+func (e *endpoints) preferred(now time.Time) int {
+	soonest := 0
+	for i, endpoint := range e.list {
+		if endpoint.available(now) {
+			return i
+		}
+		if endpoint.cooldownUntil.Before(e.list[soonest].cooldownUntil) {
+			soonest = i
+		}
+	}
+	return soonest
+}
+
+func (e *endpoints) pickWeighted(now time.Time) int {
+	total := 0
+	for _, endpoint := range e.list {
+		if endpoint.available(now) {
+			total += endpoint.Weight
+		}
+	}
+	if total == 0 {
+		return e.preferred(now)
+	}
+
+	jitterM.Lock()
+	n := jitter.Intn(total)
+	jitterM.Unlock()
+	for i, endpoint := range e.list {
+		if !endpoint.available(now) {
+			continue
+		}
+		if n < endpoint.Weight {
+			return i
+		}
+		n -= endpoint.Weight
+	}
+	return e.preferred(now)
+}
+
+// failed records a transport failure of an endpoint, it returns true if the
+// endpoint is put in cool-down and another one should be tried
+func (e *endpoints) failed(endpoint *endpointState, err error) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	endpoint.lastError = err
+	endpoint.lastErrorTime = time.Now()
+	endpoint.failures++
+	if endpoint.failures < e.threshold || len(e.list) < 2 {
+		return false
+	}
+	endpoint.failures = 0
+	endpoint.cooldownUntil = time.Now().Add(e.cooldown)
+	return true
+}
+
+// connected resets the failures of an endpoint once the agent is authorized on it
+func (e *endpoints) connected(endpoint *endpointState) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	endpoint.failures = 0
+}
+
+// observePing records the round trip of a ping on the current endpoint
+func (e *endpoints) observePing(latency time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.current < 0 {
+		return
+	}
+	endpoint := e.list[e.current]
+	if endpoint.latency == 0 {
+		endpoint.latency = latency
+		return
+	}
+	endpoint.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(endpoint.latency))
+}
+
+// active returns the current endpoint, nil before the first connection
+func (e *endpoints) active() *endpointState {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.current < 0 {
+		return nil
+	}
+	return e.list[e.current]
+}
+
+// shouldFailBack returns true if a preferred endpoint is available again
+// while connected to another one, weighted endpoints are never failed back
+func (e *endpoints) shouldFailBack() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.weighted || e.current < 0 {
+		return false
+	}
+	return e.preferred(time.Now()) < e.current
+}
+
+func (e *endpoints) statuses() []EndpointStatus {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	statuses := make([]EndpointStatus, 0, len(e.list))
+	for i, endpoint := range e.list {
+		status := EndpointStatus{
+			URL:           endpoint.URL.String(),
+			Weight:        endpoint.Weight,
+			Active:        i == e.current,
+			Failures:      endpoint.failures,
+			CooldownUntil: endpoint.cooldownUntil,
+			Latency:       endpoint.latency,
+			LastErrorTime: endpoint.lastErrorTime,
+		}
+		if endpoint.lastError != nil {
+			status.LastError = endpoint.lastError.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints("wss://a.example.com/;weight=3, wss://b.example.com/")
+	if err != nil {
+		t.Fatalf("ParseEndpoints() error = %v", err)
+	}
+	if len(endpoints) != 2 || endpoints[0].URL.Host != "a.example.com" || endpoints[0].Weight != 3 ||
+		endpoints[1].URL.Host != "b.example.com" || endpoints[1].Weight != 0 {
+		t.Errorf("ParseEndpoints() = %+v", endpoints)
+	}
+
+	for _, spec := range []string{"", "https://a.example.com/", "wss://a/;weight=0", "wss://a/;priority=1"} {
+		if _, err := ParseEndpoints(spec); err == nil {
+			t.Errorf("ParseEndpoints(%q) should fail", spec)
+		}
+	}
+}
+
+func TestEndpoints_FailoverAndFailback(t *testing.T) {
+	list, _ := ParseEndpoints("wss://primary/,wss://secondary/")
+	endpoints := newEndpoints(list, 2, time.Hour)
+	transportErr := errors.New("connection refused")
+
+	primary := endpoints.next()
+	if primary.URL.Host != "primary" {
+		t.Fatalf("next() = %s, want primary", primary.URL.Host)
+	}
+	if endpoints.failed(primary, transportErr) {
+		t.Errorf("failed() failed over before the threshold")
+	}
+	if !endpoints.failed(primary, transportErr) {
+		t.Errorf("failed() didn't fail over at the threshold")
+	}
+
+	secondary := endpoints.next()
+	if secondary.URL.Host != "secondary" {
+		t.Fatalf("next() = %s after failover, want secondary", secondary.URL.Host)
+	}
+	endpoints.connected(secondary)
+	if endpoints.shouldFailBack() {
+		t.Errorf("shouldFailBack() = true during the cool-down")
+	}
+
+	primary.cooldownUntil = time.Now().Add(-time.Second)
+	if !endpoints.shouldFailBack() {
+		t.Errorf("shouldFailBack() = false after the cool-down")
+	}
+	if next := endpoints.next(); next.URL.Host != "primary" {
+		t.Errorf("next() = %s after the cool-down, want primary", next.URL.Host)
+	}
+}
+
+func TestEndpoints_Weighted(t *testing.T) {
+	list, _ := ParseEndpoints("wss://a/;weight=1,wss://b/;weight=1,wss://c/;weight=1")
+	endpoints := newEndpoints(list, 1, time.Hour)
+
+	current := endpoints.next()
+	if endpoints.next() != current {
+		t.Errorf("next() switched from a healthy weighted endpoint")
+	}
+	endpoints.failed(current, errors.New("timeout"))
+	for i := 0; i < 20; i++ {
+		endpoints.current = -1
+		if endpoints.next() == current {
+			t.Fatalf("next() picked an endpoint in cool-down")
+		}
+	}
+	if endpoints.shouldFailBack() {
+		t.Errorf("weighted endpoints should never fail back")
+	}
+}
+
+func TestEndpoints_ObservePing(t *testing.T) {
+	list, _ := ParseEndpoints("wss://a/")
+	endpoints := newEndpoints(list, 3, time.Minute)
+	endpoints.next()
+
+	endpoints.observePing(100 * time.Millisecond)
+	endpoints.observePing(200 * time.Millisecond)
+	latency := endpoints.statuses()[0].Latency
+	if latency <= 100*time.Millisecond || latency >= 200*time.Millisecond {
+		t.Errorf("latency = %v, want a moving average between the pings", latency)
+	}
+
+	// a single endpoint is never put in cool-down
+	for i := 0; i < 5; i++ {
+		if endpoints.failed(endpoints.active(), errors.New("timeout")) {
+			t.Fatalf("failed() failed over without another endpoint")
+		}
+	}
+}
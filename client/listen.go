@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/channel"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/gorilla/websocket"
+)
+
+// ConnectionStatus state of the connection to the agent gateway
+type ConnectionStatus struct {
+	State      ConnectionState
+	Connected  bool
+	Authorized bool
+	// Suspended whether the gateway refused the agent, it stays set while retrying
+	Suspended bool
+	// NextRetry when the gateway is connected to again if disconnected or suspended
+	NextRetry time.Time
+	// Proxy the connection goes through without credentials, empty if direct
+	Proxy         string
+	LastError     string
+	LastErrorTime time.Time
+	// ProxyError whether the last error was caused by the proxy
+	ProxyError bool
+	// Endpoint the gateway url connected to or tried last
+	Endpoint  string
+	Endpoints []EndpointStatus
+	// Capabilities negotiated with the gateway, nil until the agent said hello
+	Capabilities *proto.Capabilities
+}
+
+// listen connects to the gateway and reconnects whenever the connection drops until ctx is done
+func (client *Client) listen(ctx context.Context, connected chan bool) {
+	reconnect := NewBackoff(client.timeouts.protoReconnect, client.timeouts.protoBackoffMax)
+	for {
+		endpoint := client.endpoints.next()
+		err := client.listenOnce(ctx, connected, endpoint)
+		if ctx.Err() != nil {
+			client.setState(StateDisconnected, time.Time{})
+			return
+		}
+
+		state := StateDisconnected
+		var delay time.Duration
+		var suspend *suspendError
+		switch {
+		case errors.As(err, &suspend):
+			reconnect.Reset()
+			state = StateSuspended
+			delay = suspend.retryAfter
+			logger.Errorw(
+				"agent gateway refused the agent, suspending the agent",
+				"reason", suspend.reason,
+				"retry_after", delay,
+				"error", suspend.err,
+			)
+		case err == nil:
+			// the connection was ready before it dropped
+			reconnect.Reset()
+			delay = reconnect.Next()
+		default:
+			if client.endpoints.failed(endpoint, err) {
+				logger.Warnw(
+					"too many failures, failing over to another gateway endpoint",
+					"endpoint", endpoint.URL.String(),
+					"cooldown", client.endpoints.cooldown,
+				)
+				reconnect.Reset()
+			}
+			delay = reconnect.Next()
+		}
+
+		// a suspended agent without a retry time waits to be woken up
+		var retry <-chan time.Time
+		nextRetry := time.Time{}
+		if state != StateSuspended || delay > 0 {
+			retry = time.After(delay)
+			nextRetry = time.Now().Add(delay)
+		}
+		client.setState(state, nextRetry)
+
+		if !client.waitRetry(ctx, retry) {
+			client.setState(StateDisconnected, time.Time{})
+			return
+		}
+	}
+}
+
+// waitRetry waits for the retry time or to be woken up, false if ctx is done
+func (client *Client) waitRetry(ctx context.Context, retry <-chan time.Time) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-retry:
+	case <-client.wake:
+	}
+	return true
+}
+
+// listenOnce connects to a gateway endpoint and blocks until the connection is
+// closed, it returns nil if the connection was ready before it was closed
+func (client *Client) listenOnce(ctx context.Context, connected chan bool, endpoint *endpointState) error {
+	client.setState(StateConnecting, time.Time{})
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: client.timeouts.protoHandshake,
+		TLSClientConfig:  client.tlsConfig,
+	}
+
+	proxyURL, err := client.proxy.ProxyFor(endpoint.URL)
+	if err != nil {
+		client.setConnectionError(err, "")
+		logger.Errorw("unable to resolve proxy for the agent gateway", "error", err)
+		return err
+	}
+	proxy := ""
+	if proxyURL != nil {
+		proxy = proxyURL.Redacted()
+		pd := &proxyDialer{
+			proxy:       proxyURL,
+			bearerToken: client.proxy.BearerToken,
+			timeout:     client.timeouts.protoHandshake,
+		}
+		dialer.NetDialContext = pd.DialContext
+	}
+
+	conn, _, err := dialer.DialContext(ctx, endpoint.URL.String(), nil)
+	if err != nil {
+		client.setConnectionError(err, proxy)
+		var proxyErr *ProxyError
+		if errors.As(err, &proxyErr) {
+			logger.Errorw(
+				"unable to connect to the agent gateway through the proxy",
+				"endpoint", endpoint.URL.String(),
+				"proxy", proxyErr.Proxy,
+				"status", proxyErr.StatusCode,
+				"error", proxyErr.Err,
+			)
+		} else {
+			logger.Errorw(
+				"unable to connect to the agent gateway",
+				"endpoint", endpoint.URL.String(),
+				"proxy", proxy,
+				"error", err,
+			)
+		}
+		return err
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-closed:
+		}
+	}()
+
+	client.setConnectionError(nil, proxy)
+
+	peer := newPeer(conn, client.timeouts.protoWrite, client.timeouts.protoRead, client.listener)
+	client.setPeer(peer)
+	defer client.setPeer(nil)
+	go peer.run()
+
+	handshake := make(chan error, 1)
+	go func() {
+		handshake <- client.handshake()
+	}()
+
+	select {
+	case err = <-handshake:
+	case <-peer.done:
+		err = errors.New("connection closed during the handshake")
+	}
+	if err != nil {
+		client.setConnectionError(err, proxy)
+		logger.Errorw("unable to handshake with the agent gateway", "error", err)
+		conn.Close()
+		<-peer.done
+		return err
+	}
+
+	client.endpoints.connected(endpoint)
+	logger.Infow("connected to the agent gateway", "endpoint", endpoint.URL.String())
+	client.setReady(connected, closed)
+	for {
+		select {
+		case <-peer.done:
+			client.setState(StateDisconnected, time.Time{})
+			logger.Warn("connection to the agent gateway closed")
+			return nil
+		case <-client.reauthorization:
+		}
+
+		err = client.reauthorize()
+		if err != nil {
+			client.setConnectionError(err, proxy)
+			logger.Errorw("unable to authorize with the new credentials, dropping the connection", "error", err)
+			conn.Close()
+			<-peer.done
+			return err
+		}
+		logger.Infow("authorized with the new credentials")
+		client.setReady(connected, closed)
+	}
+}
+
+func (client *Client) setPeer(peer *peer) {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	client.peer = peer
+}
+
+// dropConnection closes the current connection, the gateway is connected to again
+func (client *Client) dropConnection() {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	if client.peer != nil {
+		client.peer.close()
+	}
+}
+
+// sendRequest sends a request to the gateway endpoint over the current connection
+func (client *Client) sendRequest(endpoint string, body []byte) ([]byte, error) {
+	client.statusM.Lock()
+	peer := client.peer
+	client.statusM.Unlock()
+	if peer == nil {
+		return nil, channel.ApplyReason(channel.ClientNotConnected, "not connected to the agent gateway", nil)
+	}
+	return peer.send(endpoint, body)
+}
+
+func (client *Client) setConnectionError(err error, proxy string) {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	client.proxyAddr = proxy
+	if err == nil {
+		return
+	}
+	var proxyErr *ProxyError
+	client.lastError = err
+	client.lastErrorTime = time.Now()
+	client.lastErrorFromProxy = errors.As(err, &proxyErr)
+}
+
+// ConnectionStatus returns the state of the connection to the gateway
+func (client *Client) ConnectionStatus() ConnectionStatus {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	status := ConnectionStatus{
+		State:         client.state,
+		Connected:     client.state == StateHello || client.state == StateAuthorizing || client.state == StateReady,
+		Authorized:    client.state == StateReady,
+		Suspended:     client.suspended,
+		NextRetry:     client.nextRetry,
+		Proxy:         client.proxyAddr,
+		LastErrorTime: client.lastErrorTime,
+		ProxyError:    client.lastErrorFromProxy,
+		Capabilities:  client.capabilities,
+	}
+	if client.lastError != nil {
+		status.LastError = client.lastError.Error()
+	}
+	if client.endpoints != nil {
+		if active := client.endpoints.active(); active != nil {
+			status.Endpoint = active.URL.String()
+		}
+		status.Endpoints = client.endpoints.statuses()
+	}
+	return status
+}
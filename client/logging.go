@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -14,6 +15,8 @@ const (
 	logExpiryCount  = 2
 	logPriority     = 9
 	logRetryCount   = 4
+	// logsSyncTimeout max time the logger waits for logs to be sent on sync
+	logsSyncTimeout = 10 * time.Second
 )
 
 func (client *Client) Write(p []byte) (n int, err error) {
@@ -34,6 +37,9 @@ func (client *Client) Write(p []byte) (n int, err error) {
 }
 
 func (client *Client) flushLogs() error {
+	if len(client.logBuffer) == 0 {
+		return nil
+	}
 	payload := make(proto.PacketLogs, len(client.logBuffer))
 	copy(payload, client.logBuffer)
 	client.logBuffer = make(proto.PacketLogs, 0, logBatchSize)
@@ -53,7 +59,24 @@ func (client *Client) flushLogs() error {
 	return nil
 }
 
+// Sync sends the buffered logs and waits for them to be sent, it's called by the logger
 func (client *Client) Sync() error {
-	// TODO: Should actually wait till logs are sent
-	return client.flushLogs()
+	ctx, cancel := context.WithTimeout(context.Background(), logsSyncTimeout)
+	defer cancel()
+	return client.Drain(ctx)
+}
+
+// Drain sends the buffered logs and waits until every piped package is sent or ctx is done
+func (client *Client) Drain(ctx context.Context) error {
+	client.logM.Lock()
+	err := client.flushLogs()
+	client.logM.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !client.IsReady() {
+		return fmt.Errorf("not connected to the agent gateway, %d packages are pending", client.pipe.Len())
+	}
+	return client.pipe.Drain(ctx)
 }
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+// Options of the client, zero values disable the optional features
+type Options struct {
+	// GatewayURL comma separated urls of the gateway, optionally weighted
+	GatewayURL string
+
+	Version          string
+	StartID          string
+	AccountID        uuid.UUID
+	ClusterID        uuid.UUID
+	Secret           []byte
+	ServerVersion    string
+	AgentPermissions string
+	ClusterProvider  string
+
+	ProtoHandshake time.Duration
+	ProtoWrite     time.Duration
+	ProtoRead      time.Duration
+	ProtoReconnect time.Duration
+	ProtoBackoff   time.Duration
+	// ProtoBackoffMax cap of the reconnect and retry backoffs
+	ProtoBackoffMax time.Duration
+
+	SendLogs bool
+
+	// PipeStoreDir directory to keep pending packets in, they're kept in memory if empty
+	PipeStoreDir string
+	PipeMaxBytes int
+
+	// Proxy the gateway is connected to through, nil if direct
+	Proxy     *ProxyConfig
+	TLSConfig *tls.Config
+
+	// CredentialsDir directory the credentials are reloaded from, empty if they're not
+	CredentialsDir         string
+	CredentialsGracePeriod time.Duration
+	SuspendedRecheck       time.Duration
+
+	FailoverThreshold int
+	FailbackCooldown  time.Duration
+
+	WatchdogInterval    time.Duration
+	WatchdogMaxFailures int
+	WatchdogSlowPong    time.Duration
+
+	// ZstdDictionary enables the zstd-dict compression if set
+	ZstdDictionary []byte
+	// MaxPacketSize bigger packets are sent in chunks, zero if unlimited
+	MaxPacketSize int
+}
+
+func (options Options) timeouts() timeouts {
+	return timeouts{
+		protoHandshake:  options.ProtoHandshake,
+		protoWrite:      options.ProtoWrite,
+		protoRead:       options.ProtoRead,
+		protoReconnect:  options.ProtoReconnect,
+		protoBackoff:    options.ProtoBackoff,
+		protoBackoffMax: options.ProtoBackoffMax,
+	}
+}
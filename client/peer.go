@@ -0,0 +1,202 @@
+package client
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MagalixTechnologies/channel"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/gorilla/websocket"
+)
+
+// packet a message of the channel protocol, each one is gob encoded in its
+// own binary websocket message. Requests sent by the agent have even ids and
+// the ones sent by the gateway have odd ids, a response has the id of its request.
+type packet struct {
+	ID       int
+	Endpoint string
+	Body     []byte
+	Error    *channel.ProtocolError
+}
+
+// listener handles the requests the gateway sends to an endpoint
+type listener func(in []byte) ([]byte, error)
+
+// peer the agent side of a connection to the gateway, the channel protocol is
+// spoken here so the connection can be dialed with the agent's own dialer
+type peer struct {
+	conn         *websocket.Conn
+	writeTimeout time.Duration
+	readTimeout  time.Duration
+	listeners    func(endpoint string) (listener, bool)
+
+	writeM sync.Mutex
+
+	pendingM sync.Mutex
+	nextID   int
+	pending  map[int]chan packet
+	closed   bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPeer(
+	conn *websocket.Conn,
+	writeTimeout, readTimeout time.Duration,
+	listeners func(endpoint string) (listener, bool),
+) *peer {
+	return &peer{
+		conn:         conn,
+		writeTimeout: writeTimeout,
+		readTimeout:  readTimeout,
+		listeners:    listeners,
+		pending:      make(map[int]chan packet),
+		done:         make(chan struct{}),
+	}
+}
+
+// run reads the packets of the connection until it's closed
+func (p *peer) run() {
+	defer p.close()
+	for {
+		_, r, err := p.conn.NextReader()
+		if err != nil {
+			return
+		}
+		var in packet
+		err = gob.NewDecoder(r).Decode(&in)
+		if err != nil {
+			p.write(packet{
+				ID:       in.ID,
+				Endpoint: in.Endpoint,
+				Error:    channel.ApplyReason(channel.BadRequest, "bad request", err),
+			})
+			continue
+		}
+		if in.ID%2 == 0 {
+			p.received(in)
+		} else {
+			go p.handle(in)
+		}
+	}
+}
+
+// received passes a response to the request waiting for it
+func (p *peer) received(in packet) {
+	p.pendingM.Lock()
+	receiver, ok := p.pending[in.ID]
+	delete(p.pending, in.ID)
+	p.pendingM.Unlock()
+	if ok {
+		receiver <- in
+	}
+}
+
+// handle answers a request of the gateway with the listener of its endpoint
+func (p *peer) handle(in packet) {
+	out := packet{ID: in.ID, Endpoint: in.Endpoint}
+	handler, ok := p.listeners(in.Endpoint)
+	if !ok {
+		out.Error = channel.ApplyReason(channel.NotFound, fmt.Sprintf("api not found: %s", in.Endpoint), nil)
+		p.write(out)
+		return
+	}
+
+	var err error
+	out.Body, err = handler(in.Body)
+	if err != nil {
+		switch e := err.(type) {
+		case channel.ProtocolError:
+			out.Error = &e
+		case *channel.ProtocolError:
+			out.Error = e
+		default:
+			out.Error = channel.ApplyReason(channel.InternalError, "internal error", err)
+		}
+	}
+	p.write(out)
+}
+
+// send sends a request to the gateway endpoint and waits for its response
+func (p *peer) send(endpoint string, body []byte) ([]byte, error) {
+	receiver := make(chan packet, 1)
+	p.pendingM.Lock()
+	if p.closed {
+		p.pendingM.Unlock()
+		return nil, channel.ApplyReason(channel.ClientNotConnected, "connection already closed", nil)
+	}
+	p.nextID += 2
+	id := p.nextID
+	p.pending[id] = receiver
+	p.pendingM.Unlock()
+
+	err := p.write(packet{ID: id, Endpoint: endpoint, Body: body})
+	if err != nil {
+		p.forget(id)
+		return nil, channel.ApplyReason(channel.ClientNotConnected, "unable to send the request", err)
+	}
+
+	select {
+	case res := <-receiver:
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		return res.Body, nil
+	case <-time.After(p.readTimeout):
+		p.forget(id)
+		return nil, channel.ApplyReason(
+			channel.Timeout,
+			fmt.Sprintf("timeout while receiving response with endpoint: %s, id: %d", endpoint, id),
+			nil,
+		)
+	}
+}
+
+func (p *peer) forget(id int) {
+	p.pendingM.Lock()
+	defer p.pendingM.Unlock()
+	delete(p.pending, id)
+}
+
+// write writes a packet, the connection supports a single writer at a time
+func (p *peer) write(out packet) error {
+	p.writeM.Lock()
+	defer p.writeM.Unlock()
+	err := p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+	if err != nil {
+		return err
+	}
+	w, err := p.conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(w).Encode(out)
+	if err != nil {
+		w.Close()
+		logger.Errorw("unable to encode packet", "endpoint", out.Endpoint, "error", err)
+		return err
+	}
+	return w.Close()
+}
+
+// close closes the connection and fails the requests still waiting for a response
+func (p *peer) close() {
+	p.closeOnce.Do(func() {
+		p.conn.Close()
+		p.pendingM.Lock()
+		p.closed = true
+		pending := p.pending
+		p.pending = make(map[int]chan packet)
+		p.pendingM.Unlock()
+		for id, receiver := range pending {
+			receiver <- packet{
+				ID:    id,
+				Error: channel.ApplyReason(channel.ClientNotConnected, "connection closed", nil),
+			}
+		}
+		close(p.done)
+	})
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MagalixTechnologies/channel"
+	"github.com/MagalixTechnologies/uuid-go"
+	"github.com/gorilla/websocket"
+)
+
+// gatewayPacket the packet as the gateway encodes it with the channel library
+type gatewayPacket struct {
+	ID       int                    `json:"id"`
+	Endpoint string                 `json:"endpoint"`
+	Body     []byte                 `json:"body,omitempty"`
+	Error    *channel.ProtocolError `json:"error,omitempty"`
+}
+
+// startGateway accepts a single websocket connection and returns it
+func startGateway(t *testing.T) (string, <-chan *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("unable to upgrade, error: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), conns
+}
+
+func gatewayWrite(t *testing.T, conn *websocket.Conn, packet gatewayPacket) {
+	t.Helper()
+	w, err := conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		t.Fatalf("unable to write, error: %v", err)
+	}
+	if err := gob.NewEncoder(w).Encode(packet); err != nil {
+		t.Fatalf("unable to encode, error: %v", err)
+	}
+	w.Close()
+}
+
+func gatewayRead(t *testing.T, conn *websocket.Conn) gatewayPacket {
+	t.Helper()
+	_, r, err := conn.NextReader()
+	if err != nil {
+		t.Fatalf("unable to read, error: %v", err)
+	}
+	var packet gatewayPacket
+	if err := gob.NewDecoder(r).Decode(&packet); err != nil {
+		t.Fatalf("unable to decode, error: %v", err)
+	}
+	return packet
+}
+
+// notFoundCode the code the channel library sends for missing endpoints, it isn't channel.NotFoundCode
+var notFoundCode = channel.NotFound("", nil).Code
+
+func TestPeer(t *testing.T) {
+	url, conns := startGateway(t)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("unable to dial, error: %v", err)
+	}
+	listeners := map[string]listener{
+		"echo": func(in []byte) ([]byte, error) { return in, nil },
+		"fail": func(in []byte) ([]byte, error) { return nil, errors.New("failed") },
+	}
+	p := newPeer(conn, time.Second, time.Second, func(endpoint string) (listener, bool) {
+		l, ok := listeners[endpoint]
+		return l, ok
+	})
+	go p.run()
+	gateway := <-conns
+	defer gateway.Close()
+
+	// requests of the agent get the response with their id
+	responses := make(chan []byte, 1)
+	go func() {
+		res, err := p.send("hello", []byte("ping"))
+		if err != nil {
+			t.Errorf("send() error = %v", err)
+		}
+		responses <- res
+	}()
+	request := gatewayRead(t, gateway)
+	if request.ID%2 != 0 || request.Endpoint != "hello" || string(request.Body) != "ping" {
+		t.Fatalf("request = %+v, want an even id to hello", request)
+	}
+	gatewayWrite(t, gateway, gatewayPacket{ID: request.ID, Endpoint: "hello", Body: []byte("pong")})
+	if res := <-responses; string(res) != "pong" {
+		t.Errorf("send() = %q, want %q", res, "pong")
+	}
+
+	// requests of the gateway are answered by the listeners
+	tests := []struct {
+		endpoint string
+		body     string
+		code     channel.ErrorCode
+	}{
+		{endpoint: "echo", body: "data"},
+		{endpoint: "fail", code: channel.InternalErrorCode},
+		{endpoint: "missing", code: notFoundCode},
+	}
+	for i, tt := range tests {
+		id := 2*i + 1
+		gatewayWrite(t, gateway, gatewayPacket{ID: id, Endpoint: tt.endpoint, Body: []byte("data")})
+		res := gatewayRead(t, gateway)
+		if res.ID != id {
+			t.Errorf("%s: response id = %d, want %d", tt.endpoint, res.ID, id)
+		}
+		if string(res.Body) != tt.body {
+			t.Errorf("%s: response body = %q, want %q", tt.endpoint, res.Body, tt.body)
+		}
+		if tt.code == 0 && res.Error != nil {
+			t.Errorf("%s: response error = %v, want none", tt.endpoint, res.Error)
+		}
+		if tt.code != 0 && (res.Error == nil || res.Error.Code != tt.code) {
+			t.Errorf("%s: response error = %v, want code %d", tt.endpoint, res.Error, tt.code)
+		}
+	}
+
+	// requests waiting for a response fail once the connection is closed
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.send("hello", nil)
+		errs <- err
+	}()
+	gatewayRead(t, gateway)
+	gateway.Close()
+	var protocolErr *channel.ProtocolError
+	if err := <-errs; !errors.As(err, &protocolErr) || protocolErr.Code != channel.ClientNotConnectedCode {
+		t.Errorf("send() error = %v, want client not connected", err)
+	}
+	<-p.done
+	if _, err := p.send("hello", nil); err == nil {
+		t.Errorf("send() on a closed peer error = nil")
+	}
+}
+
+// TestPeer_ChannelServer checks the protocol spoken by the peer against the
+// server of the channel library the gateway runs
+func TestPeer_ChannelServer(t *testing.T) {
+	// the server registers its path on the default mux, every run needs its own
+	path := "/peer-test/" + uuid.NewV4().String()
+	server := channel.NewServer("", path, channel.ChannelOptions{
+		ProtoWrite: time.Second,
+		ProtoRead:  time.Second,
+	})
+	go server.Channel.Init()
+	connected := make(chan uuid.UUID, 1)
+	onConnect := func(id uuid.UUID, uri string, remoteAddr string) error {
+		connected <- id
+		return nil
+	}
+	server.SetHooks(&onConnect, nil)
+	err := server.AddListener("hello", func(ctx context.Context, client uuid.UUID, in []byte) ([]byte, error) {
+		return append([]byte("hello "), in...), nil
+	})
+	if err != nil {
+		t.Fatalf("AddListener() error = %v", err)
+	}
+	err = server.AddListener("fail", func(ctx context.Context, client uuid.UUID, in []byte) ([]byte, error) {
+		return nil, errors.New("failed")
+	})
+	if err != nil {
+		t.Fatalf("AddListener() error = %v", err)
+	}
+	httpServer := httptest.NewServer(http.DefaultServeMux)
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("unable to dial, error: %v", err)
+	}
+	listeners := map[string]listener{
+		"echo": func(in []byte) ([]byte, error) { return in, nil },
+		"fail": func(in []byte) ([]byte, error) { return nil, errors.New("failed") },
+	}
+	p := newPeer(conn, time.Second, time.Second, func(endpoint string) (listener, bool) {
+		l, ok := listeners[endpoint]
+		return l, ok
+	})
+	go p.run()
+	defer p.close()
+
+	var client uuid.UUID
+	select {
+	case client = <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the peer didn't connect to the server")
+	}
+
+	// requests of the agent
+	res, err := p.send("hello", []byte("agent"))
+	if err != nil || string(res) != "hello agent" {
+		t.Errorf("send(hello) = %q, %v, want %q", res, err, "hello agent")
+	}
+	var protocolErr *channel.ProtocolError
+	if _, err := p.send("fail", nil); !errors.As(err, &protocolErr) || protocolErr.Code != channel.InternalErrorCode {
+		t.Errorf("send(fail) error = %v, want an internal error", err)
+	}
+	if _, err := p.send("missing", nil); !errors.As(err, &protocolErr) || protocolErr.Code != notFoundCode {
+		t.Errorf("send(missing) error = %v, want not found", err)
+	}
+
+	// requests of the gateway
+	res, err = server.Send(client, "echo", []byte("data"))
+	if err != nil || string(res) != "data" {
+		t.Errorf("server.Send(echo) = %q, %v, want %q", res, err, "data")
+	}
+	if _, err := server.Send(client, "fail", nil); !errors.As(err, &protocolErr) || protocolErr.Code != channel.InternalErrorCode {
+		t.Errorf("server.Send(fail) error = %v, want an internal error", err)
+	}
+	if _, err := server.Send(client, "missing", nil); !errors.As(err, &protocolErr) || protocolErr.Code != notFoundCode {
+		t.Errorf("server.Send(missing) error = %v, want not found", err)
+	}
+}
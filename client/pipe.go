@@ -1,11 +1,16 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MagalixCorp/magalix-agent/v3/proto"
 	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
 )
 
 // PipeSender interface for sender
@@ -13,32 +18,69 @@ type PipeSender interface {
 	Send(kind proto.PacketKind, in interface{}, out interface{}) error
 }
 
+// PipeEnvelopeSender a sender that wraps packages in an envelope carrying their
+// id, sequence and attempt so the receiver can drop retries it already processed
+type PipeEnvelopeSender interface {
+	SendPackage(pack *Package) error
+}
+
+// drainPollInterval interval between checks of a draining pipe
+const drainPollInterval = 100 * time.Millisecond
+
 // Pipe pipe
 type Pipe struct {
 	cond *sync.Cond
 
 	sender  PipeSender
 	storage PipeStore
+
+	// sending number of packages popped by workers and not sent yet
+	sending int32
+
+	// stream identifies the packages numbered by this pipe, sequences
+	// start over for every pipe, i.e. every agent start
+	stream     uuid.UUID
+	sequencesM sync.Mutex
+	sequences  map[proto.PacketKind]uint64
 }
 
 // NewPipe creates a new pipe
 func NewPipe(sender PipeSender) *Pipe {
+	return NewPipeWithStore(sender, NewDefaultPipeStore())
+}
+
+// NewPipeWithStore creates a new pipe keeping pending packages in storage
+func NewPipeWithStore(sender PipeSender, storage PipeStore) *Pipe {
 	return &Pipe{
 		cond: sync.NewCond(&sync.Mutex{}),
 
 		sender:  sender,
-		storage: NewDefaultPipeStore(),
+		storage: storage,
+
+		stream:    uuid.NewV4(),
+		sequences: map[proto.PacketKind]uint64{},
 	}
 }
 
-// Send pushes a packet to the pipe to be sent
-func (p *Pipe) Send(pack Package) int {
+// Send pushes a packet to the pipe to be sent, returns the packages dropped to make room for it
+func (p *Pipe) Send(pack Package) DropStats {
 	pack.time = time.Now()
+	pack.id = uuid.NewV4()
+	pack.stream = p.stream
+	pack.sequence = p.nextSequence(pack.Kind)
 	ret := p.storage.Add(&pack)
 	p.cond.Broadcast()
 	return ret
 }
 
+// nextSequence numbers the packages of a kind in the order they are piped
+func (p *Pipe) nextSequence(kind proto.PacketKind) uint64 {
+	p.sequencesM.Lock()
+	defer p.sequencesM.Unlock()
+	p.sequences[kind]++
+	return p.sequences[kind]
+}
+
 // Start start multiple workers for sending packages
 func (p *Pipe) Start(workers int) {
 	for i := 0; i < workers; i++ {
@@ -57,22 +99,46 @@ func (p *Pipe) start() {
 				p.cond.L.Unlock()
 				continue
 			}
+			atomic.AddInt32(&p.sending, 1)
 			p.cond.L.Unlock()
 
+			pack.attempts++
 			logFields := logger.With(
 				"kind", pack.Kind,
+				"id", pack.id,
+				"attempt", pack.attempts,
 				"diff", time.Since(pack.time),
 				"remaining", p.storage.Len(),
 			)
 			logFields.Debugf("sending packet %s ....", pack.Kind.String())
 
-			err := p.sender.Send(pack.Kind, pack.Data, nil)
-			if err != nil {
+			var err error
+			if sender, ok := p.sender.(PipeEnvelopeSender); ok {
+				err = sender.SendPackage(pack)
+			} else {
+				err = p.sender.Send(pack.Kind, pack.Data, nil)
+			}
+			switch {
+			case errors.Is(err, ErrUnsupportedKind):
+				// retrying won't help until the gateway is upgraded
+				p.storage.Ack(pack)
+				pack.done(false)
+				logFields.Warnw("dropped packet not accepted by the agent gateway", "error", err)
+			case errors.Is(err, ErrPacketExpired):
+				p.storage.Ack(pack)
+				pack.done(false)
+				logFields.Warnw("dropped packet expired while sending its chunks", "error", err)
+			case err != nil:
 				p.storage.Add(pack)
 				logFields.Errorw("error sending packet", "error", err, "remaining", p.storage.Len())
-			} else {
+			default:
+				// popped packages are out of the queue already, stores keeping
+				// them until they're sent drop them on ack
+				p.storage.Ack(pack)
+				pack.done(true)
 				logFields.Debugw("completed sending packet", "remaining", p.storage.Len())
 			}
+			atomic.AddInt32(&p.sending, -1)
 		}
 	}()
 }
@@ -81,3 +147,25 @@ func (p *Pipe) start() {
 func (p *Pipe) Len() int {
 	return p.storage.Len()
 }
+
+// Drain waits until every pending package is sent or ctx is done
+func (p *Pipe) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := p.storage.Len() + int(atomic.LoadInt32(&p.sending))
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d packages are still pending, error: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats gets the pending and dropped packages
+func (p *Pipe) Stats() PipeStats {
+	return p.storage.Stats()
+}
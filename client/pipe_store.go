@@ -2,10 +2,12 @@ package client
 
 import (
 	"container/heap"
+	"encoding/json"
 	"sync"
 	"time"
 
 	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/uuid-go"
 )
 
 // Package structure used to send packages over the channel
@@ -30,14 +32,89 @@ type Package struct {
 	index int
 	// time used internally to manage priority queue
 	time time.Time
+	// size estimated size of the package in bytes
+	size int
+	// id, stream and sequence are assigned once by the pipe so retries
+	// of the package can be recognized by the gateway
+	id       uuid.UUID
+	stream   uuid.UUID
+	sequence uint64
+	// attempts number of times the package was handed to the sender
+	attempts int
 	// Data data to be sent
 	Data interface{}
+	// OnDone is called once the package is delivered or dropped, it's not
+	// persisted so packages restored after a restart don't have it
+	OnDone func(delivered bool)
+}
+
+// done calls OnDone at most once
+func (pack *Package) done(delivered bool) {
+	if pack.OnDone == nil {
+		return
+	}
+	onDone := pack.OnDone
+	pack.OnDone = nil
+	onDone(delivered)
+}
+
+// packageOverhead estimated size of a package without its data
+const packageOverhead = 128
+
+// kindEvictionOrder packages of kinds with a lower order are evicted first
+// when packages with the same priority and age compete for the byte budget
+var kindEvictionOrder = map[proto.PacketKind]int{
+	proto.PacketKindLogs:               0,
+	proto.PacketKindSyncStatusRequest:  1,
+	proto.PacketKindEntitiesDeltas:     2,
+	proto.PacketKindAuditResultRequest: 3,
+}
+
+// defaultKindEvictionOrder order of the kinds not listed in kindEvictionOrder
+const defaultKindEvictionOrder = 1
+
+// DropStats number and estimated size of dropped packages
+type DropStats struct {
+	// Expired packages dropped because of their ExpiryTime or ExpiryCount
+	Expired      int `json:"expired"`
+	ExpiredBytes int `json:"expired_bytes"`
+	// Evicted packages dropped to keep the store within its byte budget
+	Evicted      int `json:"evicted"`
+	EvictedBytes int `json:"evicted_bytes"`
+}
+
+// Packets total number of dropped packages
+func (d DropStats) Packets() int {
+	return d.Expired + d.Evicted
+}
+
+// Bytes total estimated size of dropped packages
+func (d DropStats) Bytes() int {
+	return d.ExpiredBytes + d.EvictedBytes
+}
+
+func (d *DropStats) add(pack *Package, evicted bool) {
+	if evicted {
+		d.Evicted++
+		d.EvictedBytes += pack.size
+	} else {
+		d.Expired++
+		d.ExpiredBytes += pack.size
+	}
+}
+
+// PipeStats pending and dropped packages of a store, drops are counted since the store was created
+type PipeStats struct {
+	Pending      int                            `json:"pending"`
+	PendingBytes int                            `json:"pending_bytes"`
+	MaxBytes     int                            `json:"max_bytes"`
+	Dropped      map[proto.PacketKind]DropStats `json:"dropped"`
 }
 
 // PipeStore store interface for packageges
 type PipeStore interface {
-	// Add adds a package to be sent, returns the number of dropped packages since the last add
-	Add(*Package) int
+	// Add adds a package to be sent, returns the packages dropped since the last add
+	Add(*Package) DropStats
 	// Peek gets the first available package
 	// returns the same if called multiple times without ack unless a package expires
 	// returns nil if nothing in the queue
@@ -49,21 +126,55 @@ type PipeStore interface {
 	Pop() *Package
 	// Len gets the number of pending packets
 	Len() int
+	// Stats gets the pending and dropped packages
+	Stats() PipeStats
 }
 
+// estimatePackageSize estimates the memory held by a package from the size of its encoded data
+func estimatePackageSize(pack *Package) int {
+	switch data := pack.Data.(type) {
+	case nil:
+		return packageOverhead
+	case json.RawMessage:
+		return packageOverhead + len(data)
+	case []byte:
+		return packageOverhead + len(data)
+	case string:
+		return packageOverhead + len(data)
+	}
+	encoded, err := json.Marshal(pack.Data)
+	if err != nil {
+		return packageOverhead
+	}
+	return packageOverhead + len(encoded)
+}
+
+// DefaultPipeStore keeps packages in memory. If it has a byte budget, the
+// least urgent packages are evicted once the estimated size of the pending
+// packages exceeds it: the lowest priority first, then the oldest, then by kind.
 type DefaultPipeStore struct {
 	sync.Mutex
 
 	// items removed since last add
-	removed int
+	removed DropStats
+	// items removed since the store was created, by kind
+	dropped map[proto.PacketKind]DropStats
+
+	// maxBytes byte budget of pending packages, 0 means unbounded
+	maxBytes int
+	// bytes estimated size of pending packages
+	bytes int
 
 	// items sorted by priority then time
 	pq *PriorityQueue
 	// to keep track of counts
 	kinds map[proto.PacketKind][]*Package
+
+	// onRemove is called for every package leaving the queue, acked or expired
+	onRemove func(*Package)
 }
 
-func (s *DefaultPipeStore) Add(pack *Package) int {
+func (s *DefaultPipeStore) Add(pack *Package) DropStats {
 	if pack == nil {
 		panic("programming error, make sure you don't pass nil package")
 	}
@@ -72,8 +183,12 @@ func (s *DefaultPipeStore) Add(pack *Package) int {
 	if (pack.time == time.Time{}) {
 		pack.time = time.Now()
 	}
+	if pack.size == 0 {
+		pack.size = estimatePackageSize(pack)
+	}
 	heap.Push(s.pq, pack)
 	heap.Fix(s.pq, pack.index)
+	s.bytes += pack.size
 
 	// expire count
 	kind, ok := s.kinds[pack.Kind]
@@ -89,7 +204,7 @@ func (s *DefaultPipeStore) Add(pack *Package) int {
 	for i < len(kind) {
 		if (kind[i].ExpiryCount > 0 && kind[i].ExpiryCount < len(kind)) ||
 			(kind[i].ExpiryTime != nil && now.After(*kind[i].ExpiryTime)) {
-			s.removed++
+			s.drop(kind[i], false)
 			s.removeKind(kind[i], i)
 			kind = s.kinds[pack.Kind]
 		} else {
@@ -97,11 +212,59 @@ func (s *DefaultPipeStore) Add(pack *Package) int {
 		}
 	}
 
+	s.evict()
+
 	removed := s.removed
-	s.removed = 0
+	s.removed = DropStats{}
 	return removed
 }
 
+// evict removes the least urgent packages until the pending ones fit in the byte budget
+func (s *DefaultPipeStore) evict() {
+	if s.maxBytes <= 0 {
+		return
+	}
+	for s.bytes > s.maxBytes && s.pq.Len() > 0 {
+		// a linear scan, the queue is sorted for sending not for eviction
+		// and evictions only happen while the gateway is unreachable
+		victim := (*s.pq)[0]
+		for _, pack := range (*s.pq)[1:] {
+			if evictsBefore(pack, victim) {
+				victim = pack
+			}
+		}
+		s.drop(victim, true)
+		s.remove(victim)
+	}
+}
+
+// evictsBefore reports whether a should be evicted before b
+func evictsBefore(a, b *Package) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if !a.time.Equal(b.time) {
+		return a.time.Before(b.time)
+	}
+	return kindOrder(a.Kind) < kindOrder(b.Kind)
+}
+
+func kindOrder(kind proto.PacketKind) int {
+	order, ok := kindEvictionOrder[kind]
+	if !ok {
+		return defaultKindEvictionOrder
+	}
+	return order
+}
+
+func (s *DefaultPipeStore) drop(pack *Package, evicted bool) {
+	pack.done(false)
+	s.removed.add(pack, evicted)
+	stats := s.dropped[pack.Kind]
+	stats.add(pack, evicted)
+	s.dropped[pack.Kind] = stats
+}
+
 func (s *DefaultPipeStore) Pop() *Package {
 	s.Lock()
 	defer s.Unlock()
@@ -127,7 +290,7 @@ func (s *DefaultPipeStore) peek() *Package {
 
 		// check expiry time
 		if pack.ExpiryTime != nil && time.Now().After(*pack.ExpiryTime) {
-			s.removed++
+			s.drop(pack, false)
 			s.remove(pack)
 		}
 		break
@@ -159,6 +322,8 @@ func (s *DefaultPipeStore) ack(pack *Package) {
 
 func (s *DefaultPipeStore) remove(pack *Package) {
 	heap.Remove(s.pq, pack.index)
+	s.bytes -= pack.size
+	s.notifyRemove(pack)
 	kind, ok := s.kinds[pack.Kind]
 	if ok {
 		// the loop will be executed only once most of the time
@@ -175,6 +340,8 @@ func (s *DefaultPipeStore) remove(pack *Package) {
 
 func (s *DefaultPipeStore) removeKind(pack *Package, index int) {
 	heap.Remove(s.pq, pack.index)
+	s.bytes -= pack.size
+	s.notifyRemove(pack)
 	kind, ok := s.kinds[pack.Kind]
 	if ok {
 		kind = append(kind[:index], kind[index+1:]...)
@@ -182,18 +349,48 @@ func (s *DefaultPipeStore) removeKind(pack *Package, index int) {
 	}
 }
 
+func (s *DefaultPipeStore) notifyRemove(pack *Package) {
+	if s.onRemove != nil {
+		s.onRemove(pack)
+	}
+}
+
 func (s *DefaultPipeStore) Len() int {
 	s.Lock()
 	defer s.Unlock()
 	return s.pq.Len()
 }
 
+func (s *DefaultPipeStore) Stats() PipeStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := PipeStats{
+		Pending:      s.pq.Len(),
+		PendingBytes: s.bytes,
+		MaxBytes:     s.maxBytes,
+		Dropped:      make(map[proto.PacketKind]DropStats, len(s.dropped)),
+	}
+	for kind, dropped := range s.dropped {
+		stats.Dropped[kind] = dropped
+	}
+	return stats
+}
+
+// NewDefaultPipeStore creates an unbounded memory store
 func NewDefaultPipeStore() *DefaultPipeStore {
+	return NewBoundedPipeStore(0)
+}
+
+// NewBoundedPipeStore creates a memory store evicting packages once their
+// estimated size exceeds maxBytes, 0 means unbounded
+func NewBoundedPipeStore(maxBytes int) *DefaultPipeStore {
 	pq := PriorityQueue{}
 	heap.Init(&pq)
 	return &DefaultPipeStore{
-		pq:    &pq,
-		kinds: map[proto.PacketKind][]*Package{},
+		pq:       &pq,
+		kinds:    map[proto.PacketKind][]*Package{},
+		dropped:  map[proto.PacketKind]DropStats{},
+		maxBytes: maxBytes,
 	}
 }
 
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +13,39 @@ func after(d time.Duration) *time.Time {
 	return &t
 }
 
-func TestDefaultPipeStore_Add(t *testing.T) {
+// clonePackage copies a test case package so every store starts from the same state
+func clonePackage(pack *Package) *Package {
+	clone := *pack
+	return &clone
+}
+
+type pipeStoreFactory struct {
+	name string
+	new  func(t *testing.T) PipeStore
+}
+
+// pipeStoreFactories every PipeStore implementation the suite runs against
+var pipeStoreFactories = []pipeStoreFactory{
+	{
+		name: "memory",
+		new: func(t *testing.T) PipeStore {
+			return NewDefaultPipeStore()
+		},
+	},
+	{
+		name: "disk",
+		new: func(t *testing.T) PipeStore {
+			s, err := NewDiskPipeStore(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("NewDiskPipeStore() error = %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	},
+}
+
+func TestPipeStore_Add(t *testing.T) {
 	type Inp struct {
 		pack *Package
 		want int
@@ -178,19 +211,22 @@ func TestDefaultPipeStore_Add(t *testing.T) {
 			},
 		},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := NewDefaultPipeStore()
-			for i, inp := range tt.inps {
-				if got := s.Add(inp.pack); got != inp.want {
-					t.Errorf("case %d (%dth) DefaultPipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
+	for _, factory := range pipeStoreFactories {
+		for _, tt := range tests {
+			factory, tt := factory, tt
+			t.Run(factory.name+"/"+tt.name, func(t *testing.T) {
+				s := factory.new(t)
+				for i, inp := range tt.inps {
+					if got := s.Add(clonePackage(inp.pack)).Packets(); got != inp.want {
+						t.Errorf("case %d (%dth) PipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
+					}
 				}
-			}
-		})
+			})
+		}
 	}
 }
 
-func TestDefaultPipeStore_Peek(t *testing.T) {
+func TestPipeStore_Peek(t *testing.T) {
 	type Inp struct {
 		pack  *Package
 		want  int
@@ -285,34 +321,38 @@ func TestDefaultPipeStore_Peek(t *testing.T) {
 			},
 		},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := NewDefaultPipeStore()
-			out := make([]*Package, 0)
-			for i, inp := range tt.inps {
-				for _, order := range inp.order {
-					if order >= 0 {
-						needed := order - len(out) + 1
-						if needed > 0 {
-							out = append(out, make([]*Package, needed)...)
+	for _, factory := range pipeStoreFactories {
+		for _, tt := range tests {
+			factory, tt := factory, tt
+			t.Run(factory.name+"/"+tt.name, func(t *testing.T) {
+				s := factory.new(t)
+				out := make([]*Package, 0)
+				for i, inp := range tt.inps {
+					pack := clonePackage(inp.pack)
+					for _, order := range inp.order {
+						if order >= 0 {
+							needed := order - len(out) + 1
+							if needed > 0 {
+								out = append(out, make([]*Package, needed)...)
+							}
+							out[order] = pack
 						}
-						out[order] = inp.pack
+					}
+					if got := s.Add(pack).Packets(); got != inp.want {
+						t.Errorf("case %d (%dth) PipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
 					}
 				}
-				if got := s.Add(inp.pack); got != inp.want {
-					t.Errorf("case %d (%dth) DefaultPipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
-				}
-			}
-			for i, o := range out {
-				if got := s.Peek(); got != o {
-					t.Errorf("case %d (%dth) DefaultPipeStore.Peek() = %v, want %v", i, i+1, got, o)
+				for i, o := range out {
+					if got := s.Peek(); got != o {
+						t.Errorf("case %d (%dth) PipeStore.Peek() = %v, want %v", i, i+1, got, o)
+					}
 				}
-			}
-		})
+			})
+		}
 	}
 }
 
-func TestDefaultPipeStore_Peek_Ack(t *testing.T) {
+func TestPipeStore_Peek_Ack(t *testing.T) {
 	type Inp struct {
 		pack  *Package
 		want  int
@@ -490,24 +530,99 @@ func TestDefaultPipeStore_Peek_Ack(t *testing.T) {
 			},
 		},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := NewDefaultPipeStore()
-			out := make([]*Package, len(tt.inps))
-			for i, inp := range tt.inps {
-				if inp.order >= 0 {
-					out[inp.order] = inp.pack
+	for _, factory := range pipeStoreFactories {
+		for _, tt := range tests {
+			factory, tt := factory, tt
+			t.Run(factory.name+"/"+tt.name, func(t *testing.T) {
+				s := factory.new(t)
+				out := make([]*Package, len(tt.inps))
+				for i, inp := range tt.inps {
+					pack := clonePackage(inp.pack)
+					if inp.order >= 0 {
+						out[inp.order] = pack
+					}
+					if got := s.Add(pack).Packets(); got != inp.want {
+						t.Errorf("case %d (%dth) PipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
+					}
+				}
+				for i, o := range out {
+					got := s.Peek()
+					if got != o {
+						t.Errorf("case %d (%dth) PipeStore.Add() = %v, want %v", i, i+1, got, o)
+					} else if got != nil {
+						s.Ack(got)
+					}
 				}
-				if got := s.Add(inp.pack); got != inp.want {
-					t.Errorf("case %d (%dth) DefaultPipeStore.Add() = %v, want %v", i, i+1, got, inp.want)
+			})
+		}
+	}
+}
+
+func TestBoundedPipeStore_Evict(t *testing.T) {
+	// every package is packageOverhead + 100 bytes, the budget fits three of them
+	data := strings.Repeat("a", 100)
+	packageSize := packageOverhead + len(data)
+
+	stores := []pipeStoreFactory{
+		{
+			name: "memory",
+			new: func(t *testing.T) PipeStore {
+				return NewBoundedPipeStore(3 * packageSize)
+			},
+		},
+		{
+			name: "disk",
+			new: func(t *testing.T) PipeStore {
+				s, err := NewDiskPipeStore(t.TempDir(), 3*packageSize)
+				if err != nil {
+					t.Fatalf("NewDiskPipeStore() error = %v", err)
 				}
+				t.Cleanup(func() { s.Close() })
+				return s
+			},
+		},
+	}
+	for _, factory := range stores {
+		factory := factory
+		t.Run(factory.name, func(t *testing.T) {
+			s := factory.new(t)
+			now := time.Now()
+			add := func(kind proto.PacketKind, priority int, age time.Duration) (*Package, DropStats) {
+				pack := &Package{Kind: kind, Priority: priority, Data: data, time: now.Add(-age)}
+				return pack, s.Add(pack)
+			}
+
+			urgent, _ := add(proto.PacketKindAuditResultRequest, 1, time.Minute)
+			add(proto.PacketKindLogs, 5, 2*time.Minute)
+			add(proto.PacketKindLogs, 5, time.Minute)
+
+			// the least urgent priority goes first, the oldest of it
+			status, dropped := add(proto.PacketKindSyncStatusRequest, 1, 0)
+			if dropped.Evicted != 1 || dropped.EvictedBytes != packageSize || dropped.Expired != 0 {
+				t.Errorf("Add() dropped = %+v, want a single eviction", dropped)
+			}
+			// same priority and age, logs go before audit results
+			add(proto.PacketKindAuditResultRequest, 5, time.Minute)
+			// then the audit result is the least urgent one
+			critical, dropped := add(proto.PacketKindLogs, 0, 0)
+			if dropped.Evicted != 1 {
+				t.Errorf("Add() dropped = %+v, want a single eviction", dropped)
 			}
-			for i, o := range out {
-				got := s.Peek()
-				if got != o {
-					t.Errorf("case %d (%dth) DefaultPipeStore.Add() = %v, want %v", i, i+1, got, o)
-				} else if got != nil {
-					s.Ack(got)
+
+			stats := s.Stats()
+			if logs := stats.Dropped[proto.PacketKindLogs]; logs.Evicted != 2 || logs.EvictedBytes != 2*packageSize {
+				t.Errorf("Stats() dropped logs = %+v, want 2 evictions", logs)
+			}
+			if audit := stats.Dropped[proto.PacketKindAuditResultRequest]; audit.Evicted != 1 {
+				t.Errorf("Stats() dropped audit results = %+v, want 1 eviction", audit)
+			}
+			if stats.Pending != 3 || stats.PendingBytes != 3*packageSize {
+				t.Errorf("Stats() = %+v, want 3 pending packages", stats)
+			}
+
+			for i, want := range []*Package{critical, urgent, status} {
+				if got := s.Pop(); got != want {
+					t.Errorf("Pop() %d = %+v, want %+v", i, got, want)
 				}
 			}
 		})
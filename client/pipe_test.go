@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+type failingSender struct {
+	failures int32
+	sent     int32
+}
+
+func (s *failingSender) Send(kind proto.PacketKind, in interface{}, out interface{}) error {
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("gateway unreachable")
+	}
+	atomic.AddInt32(&s.sent, 1)
+	return nil
+}
+
+func TestPipe_Drain(t *testing.T) {
+	sender := &failingSender{failures: 3}
+	pipe := NewPipe(sender)
+	for i := 0; i < 5; i++ {
+		pipe.Send(Package{Kind: proto.PacketKindLogs, Data: i})
+	}
+	pipe.Start(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := pipe.Drain(ctx)
+	if err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if sent := atomic.LoadInt32(&sender.sent); sent != 5 {
+		t.Errorf("sent %d packages, want 5", sent)
+	}
+
+	sender = &failingSender{failures: 1 << 30}
+	pipe = NewPipe(sender)
+	pipe.Send(Package{Kind: proto.PacketKindLogs, Data: "never sent"})
+	pipe.Start(1)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = pipe.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain() error = %v, want deadline exceeded", err)
+	}
+}
+
+type envelopeSender struct {
+	failingSender
+	mutex    sync.Mutex
+	attempts map[uuid.UUID][]int
+	packages []*Package
+}
+
+func (s *envelopeSender) SendPackage(pack *Package) error {
+	s.mutex.Lock()
+	s.attempts[pack.id] = append(s.attempts[pack.id], pack.attempts)
+	s.packages = append(s.packages, pack)
+	s.mutex.Unlock()
+	return s.Send(pack.Kind, pack.Data, nil)
+}
+
+func TestPipe_Envelope(t *testing.T) {
+	sender := &envelopeSender{failingSender: failingSender{failures: 2}, attempts: map[uuid.UUID][]int{}}
+	pipe := NewPipe(sender)
+	pipe.Send(Package{Kind: proto.PacketKindAuditResultRequest, Data: 1})
+	pipe.Send(Package{Kind: proto.PacketKindLogs, Data: 2})
+	pipe.Send(Package{Kind: proto.PacketKindAuditResultRequest, Data: 3})
+	pipe.Start(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pipe.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	if len(sender.attempts) != 3 {
+		t.Fatalf("sent %d distinct packages, want 3", len(sender.attempts))
+	}
+	// retries keep the id and count the attempts
+	for id, attempts := range sender.attempts {
+		for i, attempt := range attempts {
+			if attempt != i+1 {
+				t.Errorf("package %s attempts = %v", id, attempts)
+				break
+			}
+		}
+	}
+
+	sequences := map[int]uint64{}
+	for _, pack := range sender.packages {
+		if pack.stream != pipe.stream {
+			t.Errorf("package stream = %s, want %s", pack.stream, pipe.stream)
+		}
+		sequences[pack.Data.(int)] = pack.sequence
+	}
+	if sequences[1] != 1 || sequences[2] != 1 || sequences[3] != 2 {
+		t.Errorf("sequences = %v, want 1 and 2 for audit results and 1 for logs", sequences)
+	}
+}
+
+func TestPipe_OnDone(t *testing.T) {
+	done := make(chan bool, 3)
+	onDone := func(delivered bool) { done <- delivered }
+
+	pipe := NewPipe(&failingSender{failures: 1})
+	expired := time.Now().Add(-time.Second)
+	pipe.Send(Package{Kind: proto.PacketKindLogs, Data: "expired", ExpiryTime: &expired, OnDone: onDone})
+	// the expired package is dropped when the next one is added
+	pipe.Send(Package{Kind: proto.PacketKindLogs, Data: "retried", OnDone: onDone})
+	if delivered := <-done; delivered {
+		t.Errorf("OnDone(true) for an expired package, want false")
+	}
+	pipe.Start(1)
+
+	select {
+	case delivered := <-done:
+		if !delivered {
+			t.Errorf("OnDone(false) for a retried package, want true once it's sent")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDone wasn't called for the sent package")
+	}
+	select {
+	case <-done:
+		t.Errorf("OnDone called more than once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
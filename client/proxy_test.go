@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// startConnectProxy starts a proxy tunneling CONNECT requests authorized with auth
+func startConnectProxy(t *testing.T, auth string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen, error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != auth {
+					_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(upstream, conn) }()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen, error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestProxyDialer(t *testing.T) {
+	echo := startEchoServer(t)
+	tests := []struct {
+		name        string
+		proxyAuth   string
+		user        *url.Userinfo
+		bearerToken string
+		wantStatus  int
+	}{
+		{
+			name:      "basic auth",
+			proxyAuth: "Basic dXNlcjpwYXNzd29yZA==",
+			user:      url.UserPassword("user", "password"),
+		},
+		{
+			name:        "bearer auth",
+			proxyAuth:   "Bearer token",
+			user:        url.UserPassword("user", "password"),
+			bearerToken: "token",
+		},
+		{
+			name:       "rejected credentials",
+			proxyAuth:  "Bearer token",
+			user:       url.UserPassword("user", "wrong"),
+			wantStatus: http.StatusProxyAuthRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &url.URL{Scheme: "http", Host: startConnectProxy(t, tt.proxyAuth), User: tt.user}
+			dialer := &proxyDialer{proxy: proxy, bearerToken: tt.bearerToken, timeout: 5 * time.Second}
+
+			conn, err := dialer.DialContext(context.Background(), "tcp", echo)
+			if tt.wantStatus != 0 {
+				var proxyErr *ProxyError
+				if !errors.As(err, &proxyErr) || proxyErr.StatusCode != tt.wantStatus {
+					t.Fatalf("DialContext() error = %v, want proxy error with status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DialContext() error = %v", err)
+			}
+			defer conn.Close()
+
+			_, _ = io.WriteString(conn, "ping")
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			if err != nil || string(buf) != "ping" {
+				t.Errorf("tunnel read %q, error = %v", buf, err)
+			}
+		})
+	}
+
+	t.Run("unreachable proxy", func(t *testing.T) {
+		dialer := &proxyDialer{proxy: &url.URL{Scheme: "http", Host: "127.0.0.1:1"}, timeout: time.Second}
+		_, err := dialer.DialContext(context.Background(), "tcp", echo)
+		var proxyErr *ProxyError
+		if !errors.As(err, &proxyErr) || proxyErr.StatusCode != 0 {
+			t.Errorf("DialContext() error = %v, want proxy error without status", err)
+		}
+	})
+}
+
+func TestProxyConfig_ProxyFor(t *testing.T) {
+	gateway, _ := url.Parse("wss://gateway.example.com/")
+	internal, _ := url.Parse("wss://gateway.internal/")
+
+	config := &ProxyConfig{fromEnvironment: (&httpproxy.Config{
+		HTTPSProxy: "http://proxy:3128",
+		NoProxy:    ".internal",
+	}).ProxyFunc()}
+	proxy, err := config.ProxyFor(gateway)
+	if err != nil || proxy == nil || proxy.Host != "proxy:3128" {
+		t.Errorf("ProxyFor() = %v, %v, want the https proxy", proxy, err)
+	}
+	proxy, err = config.ProxyFor(internal)
+	if err != nil || proxy != nil {
+		t.Errorf("ProxyFor() = %v, %v, want no proxy for NO_PROXY hosts", proxy, err)
+	}
+
+	config, err = NewProxyConfig("http://explicit:8080", "")
+	if err != nil {
+		t.Fatalf("NewProxyConfig() error = %v", err)
+	}
+	proxy, _ = config.ProxyFor(internal)
+	if proxy == nil || proxy.Host != "explicit:8080" {
+		t.Errorf("ProxyFor() = %v, want the explicit proxy", proxy)
+	}
+
+	_, err = NewProxyConfig("socks5://proxy:1080", "")
+	if err == nil {
+		t.Errorf("NewProxyConfig() should reject unsupported schemes")
+	}
+}
@@ -10,40 +10,53 @@ import (
 )
 
 // hello Sends hello package
-func (client *Client) hello() error {
+func (client *Client) hello(credentials Credentials) error {
 	var hello proto.PacketHello
 	err := client.send(proto.PacketKindHello, proto.PacketHello{
 		Major:            ProtocolMajorVersion,
 		Minor:            ProtocolMinorVersion,
 		Build:            client.version,
 		StartID:          client.startID,
-		AccountID:        client.AccountID,
-		ClusterID:        client.ClusterID,
-		PacketV2Enabled:  true,
+		AccountID:        credentials.AccountID,
+		ClusterID:        credentials.ClusterID,
+		PacketV2Enabled:  client.supported.HasFeature(proto.FeaturePacketV2),
 		ServerVersion:    client.ServerVersion,
 		AgentPermissions: client.AgentPermissions,
 		ClusterProvider:  client.ClusterProvider,
+		EnvelopeEnabled:  client.supported.HasFeature(proto.FeatureEnvelope),
+		Capabilities:     &client.supported,
 	}, &hello)
 	if err != nil {
 		return err
 	}
 
+	capabilities, codec, err := negotiate(client.supported, hello)
+	if err != nil {
+		return err
+	}
+	client.statusM.Lock()
+	client.capabilities = &capabilities
+	client.codec = codec
+	client.statusM.Unlock()
+
 	logger.Infow("hello phase has been finished",
 		"client/protocol/major", ProtocolMajorVersion,
 		"client/protocol/minor", ProtocolMinorVersion,
 		"server/protocol/major", hello.Major,
 		"server/protocol/minor", hello.Minor,
+		"capabilities", capabilities,
+		"codec", codec.String(),
 	)
 
 	return nil
 }
 
 // authorize authorizes the client
-func (client *Client) authorize() error {
+func (client *Client) authorize(credentials Credentials) error {
 	var question proto.PacketAuthorizationQuestion
 	err := client.send(proto.PacketKindAuthorizationRequest, proto.PacketAuthorizationRequest{
-		AccountID: client.AccountID,
-		ClusterID: client.ClusterID,
+		AccountID: credentials.AccountID,
+		ClusterID: credentials.ClusterID,
 	}, &question)
 	if err != nil {
 		return err
@@ -58,7 +71,7 @@ func (client *Client) authorize() error {
 		)
 	}
 
-	token, err := client.getAuthorizationToken(question.Token)
+	token, err := client.getAuthorizationToken(question.Token, credentials.Secret)
 	if err != nil {
 		return err
 	}
@@ -78,23 +91,23 @@ func (client *Client) authorize() error {
 
 	logger.Infow(
 		"client is authorized",
-		"accountID", client.AccountID,
-		"clusterID", client.ClusterID,
+		"accountID", credentials.AccountID,
+		"clusterID", credentials.ClusterID,
 	)
 
 	return nil
 }
 
-// ping pings the client
-func (client *Client) ping() error {
+// ping pings the client and returns the round trip
+func (client *Client) ping() (time.Duration, error) {
 	started := time.Now().UTC()
 
 	var pong proto.PacketPong
-	err := client.Send(proto.PacketKindPing, proto.PacketPing{
+	err := client.send(proto.PacketKindPing, proto.PacketPing{
 		Started: started,
 	}, &pong)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	now := time.Now().UTC()
@@ -105,5 +118,23 @@ func (client *Client) ping() error {
 		"latency/server-client", now.Sub(pong.Started).String(),
 	)
 
+	return now.Sub(started), nil
+}
+
+// Bye tells the gateway that the agent is going away, it's sent directly
+// as the pipe is drained and stopped at this point
+func (client *Client) Bye(reason string) error {
+	if !client.IsReady() {
+		return errors.New("not connected to the agent gateway")
+	}
+
+	err := client.send(proto.PacketKindBye, proto.PacketBye{
+		Reason: reason,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	logger.Infow("bye sent to the agent gateway", "reason", reason)
 	return nil
 }
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MagalixTechnologies/channel"
+	"github.com/MagalixTechnologies/core/logger"
+)
+
+// ConnectionState state of the connection to the agent gateway
+type ConnectionState string
+
+const (
+	StateDisconnected ConnectionState = "disconnected"
+	StateConnecting   ConnectionState = "connecting"
+	StateHello        ConnectionState = "hello"
+	StateAuthorizing  ConnectionState = "authorizing"
+	StateReady        ConnectionState = "ready"
+	// StateSuspended the gateway refused the agent, it isn't retried until
+	// the next retry time if any
+	StateSuspended ConnectionState = "suspended"
+)
+
+// authRetryInterval time before retrying when the account or the credentials are refused
+const authRetryInterval = 2 * time.Hour
+
+// suspendError the gateway refused the agent, reconnecting right away won't help
+type suspendError struct {
+	reason string
+	// retryAfter zero if the agent stays suspended until it's restarted
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *suspendError) Error() string {
+	return fmt.Sprintf("%s, error: %s", e.reason, e.err)
+}
+
+func (e *suspendError) Unwrap() error {
+	return e.err
+}
+
+// handshake says hello and authorizes on a new connection
+func (client *Client) handshake() error {
+	credentials, _ := client.getCredentials()
+
+	client.statusM.Lock()
+	client.capabilities = nil
+	client.statusM.Unlock()
+
+	client.setState(StateHello, time.Time{})
+	err := client.hello(credentials)
+	if err != nil {
+		if strings.Contains(err.Error(), "unsupported version") {
+			return &suspendError{reason: "unsupported protocol version", err: err}
+		}
+		return fmt.Errorf("unable to verify protocol version with remote server, error: %w", err)
+	}
+
+	client.setState(StateAuthorizing, time.Time{})
+	err = client.authorizeRotating(credentials)
+	if err != nil {
+		return client.authorizationError(err)
+	}
+	return nil
+}
+
+// authorizationError suspends the agent if the gateway refused its credentials
+func (client *Client) authorizationError(err error) error {
+	var protocolErr *channel.ProtocolError
+	if errors.As(err, &protocolErr) {
+		switch protocolErr.Code {
+		case 404:
+			return &suspendError{reason: "cluster not found", retryAfter: client.suspendedRecheck, err: err}
+		case 403:
+			return &suspendError{reason: "account not authorized", retryAfter: authRetryInterval, err: err}
+		case 401:
+			return &suspendError{reason: "cluster credentials invalid", retryAfter: authRetryInterval, err: err}
+		}
+	}
+	return fmt.Errorf("unable to authorize client, error: %w", err)
+}
+
+// setReady unblocks everything waiting for the connection
+func (client *Client) setReady(connected chan bool, done <-chan struct{}) {
+	client.setState(StateReady, time.Time{})
+
+	go func() {
+		select {
+		case connected <- true:
+		case <-done:
+		}
+	}()
+
+	client.blockedM.Lock()
+	defer client.blockedM.Unlock()
+	client.blocked.Range(func(k, v interface{}) bool {
+		k.(chan struct{}) <- struct{}{}
+		return true
+	})
+
+	client.blocked = sync.Map{}
+}
+
+// setState moves to state, the suspend handler is notified when the agent is
+// first suspended and when it's ready again, not on every retry in between
+func (client *Client) setState(state ConnectionState, nextRetry time.Time) {
+	client.statusM.Lock()
+	client.state = state
+	client.nextRetry = nextRetry
+	changed := false
+	switch {
+	case state == StateSuspended && !client.suspended:
+		client.suspended, changed = true, true
+	case state == StateReady && client.suspended:
+		client.suspended, changed = false, true
+	}
+	suspended, onSuspend := client.suspended, client.onSuspend
+	client.statusM.Unlock()
+
+	if changed && onSuspend != nil {
+		onSuspend(suspended)
+	}
+}
+
+// SetSuspendHandler sets the function called when the agent is suspended and resumed
+func (client *Client) SetSuspendHandler(handler func(suspended bool)) {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	client.onSuspend = handler
+}
+
+// Retry connects to the gateway right away if the client is suspended or waiting to reconnect
+func (client *Client) Retry() error {
+	state, _ := client.State()
+	if state != StateSuspended && state != StateDisconnected {
+		return fmt.Errorf("not waiting to reconnect, state: %s", state)
+	}
+	logger.Infow("retrying to connect to the agent gateway", "state", state)
+	client.wakeUp()
+	return nil
+}
+
+// State returns the state of the connection and when it's retried next,
+// the retry time is zero unless the client is disconnected or suspended
+func (client *Client) State() (ConnectionState, time.Time) {
+	client.statusM.Lock()
+	defer client.statusM.Unlock()
+	return client.state, client.nextRetry
+}
+
+// wakeUp retries the connection right away if the client is waiting to reconnect
+func (client *Client) wakeUp() {
+	select {
+	case client.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_SuspendHandler(t *testing.T) {
+	client := &Client{state: StateDisconnected, wake: make(chan struct{}, 1)}
+	var calls []bool
+	client.SetSuspendHandler(func(suspended bool) {
+		calls = append(calls, suspended)
+	})
+
+	// refused, retried and refused again, then accepted
+	states := []ConnectionState{
+		StateConnecting, StateHello, StateAuthorizing, StateSuspended,
+		StateConnecting, StateHello, StateAuthorizing, StateSuspended,
+		StateConnecting, StateHello, StateAuthorizing, StateReady,
+		StateDisconnected,
+	}
+	for _, state := range states {
+		client.setState(state, time.Time{})
+		if state == StateSuspended && !client.ConnectionStatus().Suspended {
+			t.Errorf("ConnectionStatus().Suspended = false while suspended")
+		}
+	}
+	if len(calls) != 2 || !calls[0] || calls[1] {
+		t.Errorf("suspend handler calls = %v, want [true false]", calls)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	client := &Client{state: StateSuspended, wake: make(chan struct{}, 1)}
+	if err := client.Retry(); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	select {
+	case <-client.wake:
+	default:
+		t.Errorf("Retry() didn't wake up the reconnect loop")
+	}
+
+	client.setState(StateReady, time.Time{})
+	if err := client.Retry(); err == nil {
+		t.Errorf("Retry() should fail while connected")
+	}
+}
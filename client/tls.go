@@ -0,0 +1,163 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MagalixTechnologies/core/logger"
+)
+
+// spkiPinPrefix optional prefix of pins, e.g. sha256/AAAA...=
+const spkiPinPrefix = "sha256/"
+
+// GatewayTLS how the connection to the gateway is secured, the zero value
+// trusts the system roots and presents no client certificate
+type GatewayTLS struct {
+	// CAFile bundle of the CAs trusted instead of the system roots
+	CAFile string
+	// Pins base64 sha256 hashes of the SubjectPublicKeyInfo of trusted certificates,
+	// one of the certificates of the verified chain must match if set
+	Pins []string
+	// CertFile and KeyFile client certificate presented to the gateway, they're
+	// reloaded when changed so a rotated secret is picked up on the next connection
+	CertFile string
+	KeyFile  string
+}
+
+// Config builds the tls config of the gateway connection, nil if the defaults are used
+func (g GatewayTLS) Config() (*tls.Config, error) {
+	if g.CAFile == "" && len(g.Pins) == 0 && g.CertFile == "" && g.KeyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if g.CAFile != "" {
+		pem, err := ioutil.ReadFile(g.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gateway CA bundle, error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in gateway CA bundle %s", g.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(g.Pins) > 0 {
+		pins := map[string]struct{}{}
+		for _, pin := range g.Pins {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), spkiPinPrefix)
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid gateway certificate pin %q, expected a base64 sha256 hash", pin)
+			}
+			pins[pin] = struct{}{}
+		}
+		config.VerifyConnection = verifyPins(pins)
+	}
+
+	if g.CertFile != "" || g.KeyFile != "" {
+		if g.CertFile == "" || g.KeyFile == "" {
+			return nil, errors.New("both the client certificate and key must be specified")
+		}
+		reloader := &certReloader{certFile: g.CertFile, keyFile: g.KeyFile}
+		_, err := reloader.GetClientCertificate(nil)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	return config, nil
+}
+
+// SPKIPin returns the pin of a certificate
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyPins runs after the chain is verified against the trusted roots
+func verifyPins(pins map[string]struct{}) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				if _, ok := pins[SPKIPin(cert)]; ok {
+					return nil
+				}
+			}
+		}
+		leaf := ""
+		if len(state.PeerCertificates) > 0 {
+			leaf = SPKIPin(state.PeerCertificates[0])
+		}
+		return fmt.Errorf("gateway certificate doesn't match any pin, leaf pin: %s", leaf)
+	}
+}
+
+// certReloader loads a key pair again whenever one of its files changes
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			logger.Warnw("unable to check client certificate, using the loaded one", "error", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("unable to read client certificate, error: %w", err)
+	}
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// the secret may be half written while it rotates
+			logger.Warnw("unable to reload client certificate, using the loaded one", "error", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("unable to load client certificate, error: %w", err)
+	}
+	if r.cert != nil {
+		logger.Infow("client certificate reloaded", "file", r.certFile)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
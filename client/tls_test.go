@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write %s, error: %v", path, err)
+	}
+}
+
+// writeKeyPair writes a self signed certificate and its key
+func writeKeyPair(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key, error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate, error: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key, error: %v", err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+}
+
+func TestGatewayTLS_Pins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{name: "no pins"},
+		{name: "matching pin", pins: []string{"sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", spkiPinPrefix + SPKIPin(server.Certificate())}},
+		{name: "mismatching pin", pins: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := GatewayTLS{CAFile: caFile, Pins: tt.pins}.Config()
+			if err != nil {
+				t.Fatalf("Config() error = %v", err)
+			}
+			config.ServerName = "example.com"
+			conn, err := tls.Dial("tcp", addr, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tls.Dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+
+	_, err := GatewayTLS{Pins: []string{"not a hash"}}.Config()
+	if err == nil {
+		t.Errorf("Config() should reject invalid pins")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeKeyPair(t, certFile, keyFile, "first")
+
+	config, err := GatewayTLS{CertFile: certFile, KeyFile: keyFile}.Config()
+	if err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+	commonName := func() string {
+		cert, err := config.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetClientCertificate() error = %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("unable to parse certificate, error: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if name := commonName(); name != "first" {
+		t.Errorf("client certificate = %s, want first", name)
+	}
+
+	// a half written secret keeps the loaded certificate
+	future := time.Now().Add(time.Minute)
+	err = ioutil.WriteFile(keyFile, []byte("partial"), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write key, error: %v", err)
+	}
+	_ = os.Chtimes(keyFile, future, future)
+	if name := commonName(); name != "first" {
+		t.Errorf("client certificate = %s, want first", name)
+	}
+
+	writeKeyPair(t, certFile, keyFile, "rotated")
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	if name := commonName(); name != "rotated" {
+		t.Errorf("client certificate = %s, want rotated", name)
+	}
+}
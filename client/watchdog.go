@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MagalixTechnologies/core/logger"
+)
+
+// latencyWindow number of latest pongs the latency histogram is computed over
+const latencyWindow = 60
+
+// latencyBuckets upper bounds of the latency histogram buckets, pongs slower than
+// the last one are counted in an unbounded bucket
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBucket pongs at most as slow as UpperBound, zero for the unbounded bucket
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      int
+}
+
+// WatchdogStats liveness of the connection to the gateway as seen by the watchdog
+type WatchdogStats struct {
+	// Healthy false once the connection is found dead until a pong is received again
+	Healthy             bool
+	Pings               int64
+	Failures            int64
+	SlowPongs           int64
+	DeadConnections     int64
+	ConsecutiveFailures int
+	LastPing            time.Time
+	LastLatency         time.Duration
+	// P50, P90 and P99 latencies of the pongs in the window
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Buckets []LatencyBucket
+}
+
+// watchdog pings the gateway and declares the connection dead after maxFailures
+// consecutive pings failed or were slower than slowPong
+type watchdog struct {
+	interval    time.Duration
+	maxFailures int
+	slowPong    time.Duration
+
+	mutex       sync.Mutex
+	latencies   []time.Duration
+	next        int
+	dead        bool
+	pings       int64
+	failures    int64
+	slowPongs   int64
+	deadConns   int64
+	consecutive int
+	lastPing    time.Time
+	lastLatency time.Duration
+}
+
+func newWatchdog(interval time.Duration, maxFailures int, slowPong time.Duration) *watchdog {
+	return &watchdog{
+		interval:    interval,
+		maxFailures: maxFailures,
+		slowPong:    slowPong,
+		latencies:   make([]time.Duration, 0, latencyWindow),
+	}
+}
+
+// observe records the result of a ping, it returns true if the connection is dead
+func (w *watchdog) observe(latency time.Duration, err error) (bool, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pings++
+	w.lastPing = time.Now()
+	if err == nil {
+		w.lastLatency = latency
+		if len(w.latencies) < latencyWindow {
+			w.latencies = append(w.latencies, latency)
+		} else {
+			w.latencies[w.next] = latency
+			w.next = (w.next + 1) % latencyWindow
+		}
+		if w.slowPong > 0 && latency > w.slowPong {
+			w.slowPongs++
+			err = fmt.Errorf("pong took %s, more than %s", latency, w.slowPong)
+		}
+	}
+
+	if err == nil {
+		w.consecutive = 0
+		w.dead = false
+		return false, nil
+	}
+
+	w.failures++
+	w.consecutive++
+	if w.consecutive < w.maxFailures {
+		return false, err
+	}
+	w.consecutive = 0
+	w.dead = true
+	w.deadConns++
+	return true, err
+}
+
+func (w *watchdog) stats() WatchdogStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	stats := WatchdogStats{
+		Healthy:             !w.dead,
+		Pings:               w.pings,
+		Failures:            w.failures,
+		SlowPongs:           w.slowPongs,
+		DeadConnections:     w.deadConns,
+		ConsecutiveFailures: w.consecutive,
+		LastPing:            w.lastPing,
+		LastLatency:         w.lastLatency,
+	}
+
+	buckets := make([]LatencyBucket, len(latencyBuckets)+1)
+	for i, bound := range latencyBuckets {
+		buckets[i].UpperBound = bound
+	}
+	sorted := make([]time.Duration, len(w.latencies))
+	copy(sorted, w.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, latency := range sorted {
+		i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+		buckets[i].Count++
+	}
+	stats.Buckets = buckets
+
+	if len(sorted) > 0 {
+		percentile := func(p int) time.Duration {
+			return sorted[(len(sorted)-1)*p/100]
+		}
+		stats.P50, stats.P90, stats.P99 = percentile(50), percentile(90), percentile(99)
+	}
+	return stats
+}
+
+// StartWatchdog pings the gateway every interval until ctx is done
+func (client *Client) StartWatchdog(ctx context.Context) error {
+	client.watchdogTicker = time.NewTicker(client.watchdog.interval)
+	defer client.watchdogTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.watchdogTicker.C:
+			client.checkConnection()
+		}
+	}
+}
+
+// checkConnection pings the gateway, the connection is dropped to connect again
+// if it's dead, if the endpoint keeps failing or if a preferred one is available again
+func (client *Client) checkConnection() {
+	if !client.IsReady() {
+		return
+	}
+
+	endpoint := client.endpoints.active()
+	latency, err := client.ping()
+	dead, err := client.watchdog.observe(latency, err)
+	if err == nil {
+		client.endpoints.observePing(latency)
+		if client.endpoints.shouldFailBack() {
+			logger.Infow("preferred gateway endpoint is available again, failing back", "from", endpoint.URL.String())
+			client.dropConnection()
+		}
+		return
+	}
+
+	logger.Errorw("failed to ping gateway", "error", err)
+	failover := endpoint != nil && client.endpoints.failed(endpoint, err)
+	switch {
+	case dead:
+		logger.Errorw(
+			"connection to the agent gateway is dead, reconnecting",
+			"max_failures", client.watchdog.maxFailures,
+			"error", err,
+		)
+		client.dropConnection()
+	case failover:
+		logger.Warnw("gateway endpoint isn't healthy, failing over", "endpoint", endpoint.URL.String())
+		client.dropConnection()
+	}
+}
+
+// WatchdogStats returns the liveness of the connection and the latency of the gateway
+func (client *Client) WatchdogStats() WatchdogStats {
+	return client.watchdog.stats()
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchdog_Observe(t *testing.T) {
+	w := newWatchdog(time.Minute, 3, time.Second)
+	timeout := errors.New("timeout")
+
+	results := []struct {
+		latency  time.Duration
+		err      error
+		wantDead bool
+	}{
+		{latency: 10 * time.Millisecond},
+		{err: timeout},
+		// a slow pong counts as a failure
+		{latency: 2 * time.Second},
+		{err: timeout, wantDead: true},
+		{err: timeout},
+		{latency: 20 * time.Millisecond},
+	}
+	for i, result := range results {
+		dead, err := w.observe(result.latency, result.err)
+		if dead != result.wantDead {
+			t.Errorf("observe() #%d dead = %v, want %v", i, dead, result.wantDead)
+		}
+		if dead && w.stats().Healthy {
+			t.Errorf("stats().Healthy = true after a dead connection")
+		}
+		if result.latency > time.Second && err == nil {
+			t.Errorf("observe() #%d should report the slow pong", i)
+		}
+	}
+
+	stats := w.stats()
+	if !stats.Healthy || stats.Pings != 6 || stats.Failures != 4 || stats.SlowPongs != 1 ||
+		stats.DeadConnections != 1 || stats.ConsecutiveFailures != 0 {
+		t.Errorf("stats() = %+v", stats)
+	}
+}
+
+func TestWatchdog_Histogram(t *testing.T) {
+	w := newWatchdog(time.Minute, 3, 0)
+	for i := 0; i < latencyWindow+40; i++ {
+		latency := 5 * time.Millisecond
+		if i >= 40 && i%10 == 0 {
+			latency = 300 * time.Millisecond
+		}
+		_, _ = w.observe(latency, nil)
+	}
+
+	stats := w.stats()
+	if len(stats.Buckets) != len(latencyBuckets)+1 {
+		t.Fatalf("stats() has %d buckets, want %d", len(stats.Buckets), len(latencyBuckets)+1)
+	}
+	total := 0
+	for _, bucket := range stats.Buckets {
+		total += bucket.Count
+	}
+	// only the window is kept, the first pongs are rolled out
+	if total != latencyWindow {
+		t.Errorf("histogram holds %d pongs, want %d", total, latencyWindow)
+	}
+	if stats.Buckets[0].Count != latencyWindow-6 || stats.Buckets[4].Count != 6 {
+		t.Errorf("buckets = %+v", stats.Buckets)
+	}
+	if stats.P50 != 5*time.Millisecond || stats.P99 != 300*time.Millisecond {
+		t.Errorf("P50 = %v, P99 = %v", stats.P50, stats.P99)
+	}
+}
@@ -0,0 +1,123 @@
+package entities
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// coalesceDeltas merges a newer delta of an entity into an older queued one.
+// The base of the older delta is kept since it's the version known by the backend,
+// if the older delta isn't an update the newer delta has no usable base.
+func coalesceDeltas(older, newer agent.Delta) agent.Delta {
+	if newer.Kind != agent.EntityDeltaKindUpsert || newer.Base == nil {
+		return newer
+	}
+	if older.Kind == agent.EntityDeltaKindUpsert && older.Base != nil {
+		newer.Base = older.Base
+	} else {
+		newer.Base = nil
+	}
+	return newer
+}
+
+// diffDelta turns an update into a json merge patch from its base when the patch
+// is smaller than the full entity, otherwise the full entity is sent
+func diffDelta(delta *agent.Delta) error {
+	if delta.Kind != agent.EntityDeltaKindUpsert || delta.Base == nil {
+		return nil
+	}
+	base := delta.Base
+	delta.Base = nil
+
+	original, err := base.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("unable to marshal base entity, error: %w", err)
+	}
+	modified, err := delta.Data.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("unable to marshal entity, error: %w", err)
+	}
+	patch, err := jsonpatch.CreateMergePatch(original, modified)
+	if err != nil {
+		return fmt.Errorf("unable to create merge patch, error: %w", err)
+	}
+	if len(patch) >= len(modified) {
+		return nil
+	}
+
+	delta.Kind = agent.EntityDeltaKindPatch
+	delta.Patch = patch
+	delta.BaseResourceVersion = base.GetResourceVersion()
+	return nil
+}
+
+func deltaKey(delta *agent.Delta) string {
+	return fmt.Sprintf("%s:%s:%s", delta.Data.GetNamespace(), delta.Data.GetKind(), delta.Data.GetName())
+}
+
+// deltaBases tracks the version of every entity the gateway is known to have.
+// Deltas are delivered by concurrent workers and can expire or be evicted, so
+// a patch is only sent when its base was delivered and no earlier delta of the
+// entity is still pending, otherwise the full entity is sent.
+type deltaBases struct {
+	mutex sync.Mutex
+	// delivered resource version of the last delivered delta of each entity
+	delivered map[string]string
+	// pending number of deltas of each entity not delivered or dropped yet
+	pending map[string]int
+}
+
+func newDeltaBases() *deltaBases {
+	return &deltaBases{
+		delivered: map[string]string{},
+		pending:   map[string]int{},
+	}
+}
+
+// prepare turns the patches without a delivered base back into full entities
+// and marks the deltas pending, the returned func must be called once they're
+// delivered or dropped
+func (b *deltaBases) prepare(deltas []*agent.Delta) agent.DeltasDone {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	keys := make([]string, 0, len(deltas))
+	for _, delta := range deltas {
+		key := deltaKey(delta)
+		if delta.Kind == agent.EntityDeltaKindPatch {
+			version, ok := b.delivered[key]
+			if b.pending[key] > 0 || !ok || version != delta.BaseResourceVersion {
+				delta.Kind = agent.EntityDeltaKindUpsert
+				delta.Patch = nil
+				delta.BaseResourceVersion = ""
+			}
+		}
+		b.pending[key]++
+		keys = append(keys, key)
+	}
+
+	var once sync.Once
+	return func(delivered bool) {
+		once.Do(func() { b.done(keys, deltas, delivered) })
+	}
+}
+
+func (b *deltaBases) done(keys []string, deltas []*agent.Delta, delivered bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i, key := range keys {
+		b.pending[key]--
+		if b.pending[key] <= 0 {
+			delete(b.pending, key)
+		}
+		if delivered && deltas[i].Kind != agent.EntityDeltaKindDelete {
+			b.delivered[key] = deltas[i].Data.GetResourceVersion()
+		} else {
+			delete(b.delivered, key)
+		}
+	}
+}
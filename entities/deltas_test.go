@@ -0,0 +1,143 @@
+package entities
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newDeltaTestPod(resourceVersion string, phase string) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":            "web",
+			"namespace":       "default",
+			"resourceVersion": resourceVersion,
+			"labels":          map[string]interface{}{"app": "web", "tier": "frontend"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "nginx:1.21"},
+			},
+		},
+		"status": map[string]interface{}{"phase": phase},
+	}}
+}
+
+func TestDiffDelta(t *testing.T) {
+	base := newDeltaTestPod("1", "Pending")
+	delta := agent.Delta{
+		Kind: agent.EntityDeltaKindUpsert,
+		Data: newDeltaTestPod("2", "Running"),
+		Base: &base,
+	}
+
+	if err := diffDelta(&delta); err != nil {
+		t.Fatalf("diffDelta() error = %v", err)
+	}
+	if delta.Kind != agent.EntityDeltaKindPatch || delta.BaseResourceVersion != "1" || delta.Base != nil {
+		t.Fatalf("diffDelta() = %+v, want a patch from resource version 1", delta)
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(delta.Patch, &patch); err != nil {
+		t.Fatalf("invalid patch %s, error: %v", delta.Patch, err)
+	}
+	if _, ok := patch["spec"]; ok {
+		t.Errorf("patch should contain only the changed fields, got %s", delta.Patch)
+	}
+	if !strings.Contains(string(delta.Patch), `"phase":"Running"`) {
+		t.Errorf("patch should contain the new phase, got %s", delta.Patch)
+	}
+}
+
+func TestDiffDelta_FallbackToFullEntity(t *testing.T) {
+	// every field changed and the removed ones are nulled by the patch
+	base := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Pod",
+		"deprecated": map[string]interface{}{"field": "value"},
+	}}
+	delta := agent.Delta{
+		Kind: agent.EntityDeltaKindUpsert,
+		Data: newDeltaTestPod("2", "Running"),
+		Base: &base,
+	}
+
+	if err := diffDelta(&delta); err != nil {
+		t.Fatalf("diffDelta() error = %v", err)
+	}
+	if delta.Kind != agent.EntityDeltaKindUpsert || delta.Patch != nil {
+		t.Errorf("diffDelta() = %+v, want the full entity when the patch isn't smaller", delta)
+	}
+}
+
+func TestCoalesceDeltas(t *testing.T) {
+	base := newDeltaTestPod("1", "Pending")
+	middle := newDeltaTestPod("2", "Running")
+	update := agent.Delta{Kind: agent.EntityDeltaKindUpsert, Data: middle, Base: &base}
+	next := agent.Delta{Kind: agent.EntityDeltaKindUpsert, Data: newDeltaTestPod("3", "Succeeded"), Base: &middle}
+
+	if merged := coalesceDeltas(update, next); merged.Base != &base {
+		t.Errorf("coalesced update should keep the oldest base")
+	}
+
+	add := agent.Delta{Kind: agent.EntityDeltaKindUpsert, Data: base}
+	if merged := coalesceDeltas(add, next); merged.Base != nil {
+		t.Errorf("an update coalesced with an unsent add should be sent in full")
+	}
+}
+
+func TestEntitiesWatcher_FlushDeltasAfterDrop(t *testing.T) {
+	var (
+		sent  []agent.Delta
+		dones []agent.DeltasDone
+	)
+	ew := NewEntitiesWatcher(nil, 0)
+	ew.SetDeltasHandler(func(deltas []*agent.Delta, done agent.DeltasDone) error {
+		for _, delta := range deltas {
+			sent = append(sent, *delta)
+		}
+		dones = append(dones, done)
+		return nil
+	})
+	update := func(from, to string) *agent.Delta {
+		base := newDeltaTestPod(from, "Pending")
+		delta := &agent.Delta{Kind: agent.EntityDeltaKindUpsert, Data: newDeltaTestPod(to, "Running"), Base: &base}
+		if err := diffDelta(delta); err != nil {
+			t.Fatalf("diffDelta() error = %v", err)
+		}
+		return delta
+	}
+
+	ew.flushDeltas([]*agent.Delta{{Kind: agent.EntityDeltaKindUpsert, Data: newDeltaTestPod("1", "Pending")}})
+	dones[0](true)
+
+	ew.flushDeltas([]*agent.Delta{update("1", "2")})
+	if sent[1].Kind != agent.EntityDeltaKindPatch {
+		t.Fatalf("an update of a delivered version should be a patch, got %s", sent[1].Kind)
+	}
+	// pending deltas may be delivered after the next one
+	ew.flushDeltas([]*agent.Delta{update("2", "3")})
+	if sent[2].Kind != agent.EntityDeltaKindUpsert || sent[2].Patch != nil {
+		t.Errorf("an update while the previous one is pending should be sent in full, got %s", sent[2].Kind)
+	}
+	dones[2](true)
+	dones[1](false)
+
+	// the dropped patch leaves the gateway with an unknown version
+	ew.flushDeltas([]*agent.Delta{update("3", "4")})
+	if sent[3].Kind != agent.EntityDeltaKindUpsert || sent[3].Patch != nil || sent[3].Data.GetResourceVersion() != "4" {
+		t.Errorf("an update after a dropped delta should be sent in full, got %+v", sent[3])
+	}
+	dones[3](true)
+	dones[3](false)
+
+	ew.flushDeltas([]*agent.Delta{update("4", "5")})
+	if sent[4].Kind != agent.EntityDeltaKindPatch || sent[4].BaseResourceVersion != "4" {
+		t.Errorf("an update of a delivered full entity should be a patch again, got %s", sent[4].Kind)
+	}
+}
@@ -2,6 +2,7 @@ package entities
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,6 +18,9 @@ const (
 	resyncInterval   = 4 * time.Hour
 	snapshotInterval = 3 * time.Hour
 
+	syncStatusCheckInterval  = 30 * time.Second
+	syncStatusReportInterval = time.Hour
+
 	deltasBufferChanSize       = 1024
 	deltasPacketFlushAfterSize = 100
 	deltasPacketFlushAfterTime = time.Second * 10
@@ -62,6 +66,12 @@ type ResourceEventsHandler interface {
 	OnCacheSync()
 }
 
+// SecretFindingsEventsHandler can be implemented by a ResourceEventsHandler to be
+// notified of the hardcoded secrets found in added and updated resources
+type SecretFindingsEventsHandler interface {
+	OnResourceSecretFindings(gvrk kuber.GroupVersionResourceKind, obj unstructured.Unstructured, findings []kuber.SecretFinding)
+}
+
 type EntitiesWatcher struct {
 	observer *kuber.Observer
 
@@ -69,6 +79,9 @@ type EntitiesWatcher struct {
 	watchersByKind        map[string]kuber.Watcher
 	deltasQueue           chan agent.Delta
 	resourceEventHandlers map[ResourceEventsHandler]struct{}
+	sendSyncStatus        agent.SyncStatusHandler
+	sendDeltas            agent.DeltasHandler
+	bases                 *deltaBases
 
 	cancelWorker context.CancelFunc
 }
@@ -87,6 +100,7 @@ func NewEntitiesWatcher(
 		watchersByKind:        map[string]kuber.Watcher{},
 		deltasQueue:           make(chan agent.Delta, deltasBufferChanSize),
 		resourceEventHandlers: make(map[ResourceEventsHandler]struct{}),
+		bases:                 newDeltaBases(),
 	}
 	return ew
 }
@@ -95,17 +109,28 @@ func (ew *EntitiesWatcher) AddResourceEventsHandler(handler ResourceEventsHandle
 	ew.resourceEventHandlers[handler] = struct{}{}
 }
 
+func (ew *EntitiesWatcher) SetSyncStatusHandler(handler agent.SyncStatusHandler) {
+	ew.sendSyncStatus = handler
+}
+
+func (ew *EntitiesWatcher) SetDeltasHandler(handler agent.DeltasHandler) {
+	ew.sendDeltas = handler
+}
+
 func (ew *EntitiesWatcher) Start(ctx context.Context) error {
 	// this method should be called only once
 
-	// TODO: if a packet expires or failed to be sent
-	// 	we need to force a full resync to get all new updates
-
 	for _, gvrk := range watchedResources {
 		w := ew.observer.Watch(gvrk)
 		ew.watchers[gvrk] = w
 		ew.watchersByKind[gvrk.Kind] = w
 	}
+	// inventoried by their metadata only, their payload is never cached or sent
+	for _, gvrk := range kuber.MetadataOnlyResources {
+		w := ew.observer.WatchMetadata(gvrk)
+		ew.watchers[gvrk] = w
+		ew.watchersByKind[gvrk.Kind] = w
+	}
 
 	ew.WaitForCacheSync()
 
@@ -120,6 +145,10 @@ func (ew *EntitiesWatcher) Start(ctx context.Context) error {
 		ew.deltasWorker(egCtx)
 		return nil
 	})
+	eg.Go(func() error {
+		ew.syncStatusWorker(egCtx)
+		return nil
+	})
 	return eg.Wait()
 }
 
@@ -132,6 +161,18 @@ func (ew *EntitiesWatcher) Stop() error {
 	return nil
 }
 
+// Pause stops watching the cluster, the workers keep running with nothing to send
+func (ew *EntitiesWatcher) Pause() {
+	logger.Info("pausing resource watchers")
+	ew.observer.Pause()
+}
+
+// Resume watches the cluster again, the current state of every resource is listed and sent as deltas
+func (ew *EntitiesWatcher) Resume() {
+	logger.Info("resuming resource watchers")
+	ew.observer.Resume()
+}
+
 func (ew *EntitiesWatcher) WatcherFor(gvrk kuber.GroupVersionResourceKind) (kuber.Watcher, error) {
 	w, ok := ew.watchers[gvrk]
 	if !ok {
@@ -144,16 +185,93 @@ func (ew *EntitiesWatcher) WatcherFor(gvrk kuber.GroupVersionResourceKind) (kube
 }
 
 func (ew *EntitiesWatcher) WaitForCacheSync() {
-	// missing permissions cause a timeout, we ignore it so the agent is not blocked when permissions are missing
+	// resources with missing permissions are reported as blind, we ignore them so the agent is not blocked
 	err := ew.observer.WaitForCacheSync()
 	if err != nil {
-		logger.Warnf("timeout due to missing permissions with error %s ", err.Error())
+		var syncErr *kuber.CacheSyncError
+		if errors.As(err, &syncErr) {
+			for _, status := range syncErr.Statuses {
+				logger.Warnw(
+					"resource is not synced",
+					"resource", status.String(),
+					"state", status.State,
+					"error", status.LastError,
+				)
+			}
+		} else {
+			logger.Warnw("failed to wait for cache sync", "error", err)
+		}
 	}
 	for handler := range ew.resourceEventHandlers {
 		handler.OnCacheSync()
 	}
 }
 
+// SyncStatuses returns the sync status of every watched resource
+func (ew *EntitiesWatcher) SyncStatuses() []kuber.SyncStatus {
+	return ew.observer.SyncStatuses()
+}
+
+func (ew *EntitiesWatcher) syncStatusWorker(ctx context.Context) {
+	ticker := time.NewTicker(syncStatusCheckInterval)
+	defer ticker.Stop()
+
+	var lastReported []kuber.SyncStatus
+	var lastReportedAt time.Time
+	for {
+		statuses := ew.observer.SyncStatuses()
+		if syncStatusesChanged(lastReported, statuses) ||
+			time.Since(lastReportedAt) >= syncStatusReportInterval {
+			err := ew.reportSyncStatus(statuses)
+			if err != nil {
+				logger.Errorw("unable to report resources sync status", "error", err)
+			} else {
+				lastReported = statuses
+				lastReportedAt = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ew *EntitiesWatcher) reportSyncStatus(statuses []kuber.SyncStatus) error {
+	if ew.sendSyncStatus == nil {
+		return nil
+	}
+
+	items := make([]*agent.ResourceSyncStatus, 0, len(statuses))
+	for _, status := range statuses {
+		items = append(items, &agent.ResourceSyncStatus{
+			GroupVersionResourceKind: packetGvrk(status.GroupVersionResourceKind),
+			State:                    string(status.State),
+			LastError:                status.LastError,
+			LastErrorTime:            status.LastErrorTime,
+			SyncedAt:                 status.SyncedAt,
+			NextRetry:                status.NextRetry,
+		})
+	}
+	return ew.sendSyncStatus(items)
+}
+
+func syncStatusesChanged(old, new []kuber.SyncStatus) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for i := range old {
+		if old[i].GroupVersionResourceKind != new[i].GroupVersionResourceKind ||
+			old[i].State != new[i].State ||
+			old[i].LastError != new[i].LastError {
+			return true
+		}
+	}
+	return false
+}
+
 func (ew *EntitiesWatcher) GetAllEntitiesByGvrk() (map[kuber.GroupVersionResourceKind][]unstructured.Unstructured, []error) {
 	entities := make(map[kuber.GroupVersionResourceKind][]unstructured.Unstructured)
 	errs := make([]error, 0)
@@ -192,6 +310,7 @@ func (ew *EntitiesWatcher) getParents(u *unstructured.Unstructured) (*agent.Pare
 func (ew *EntitiesWatcher) OnAdd(gvrk kuber.GroupVersionResourceKind, obj unstructured.Unstructured) {
 	delta := agent.Delta{
 		Kind:      agent.EntityDeltaKindUpsert,
+		Gvrk:      packetGvrk(gvrk),
 		Data:      obj,
 		Timestamp: time.Now(),
 	}
@@ -204,9 +323,12 @@ func (ew *EntitiesWatcher) OnAdd(gvrk kuber.GroupVersionResourceKind, obj unstru
 }
 
 func (ew *EntitiesWatcher) OnUpdate(gvrk kuber.GroupVersionResourceKind, oldObj, newObj unstructured.Unstructured) {
+	// objects are already masked, so the diff never reveals masked values
 	delta := agent.Delta{
 		Kind:      agent.EntityDeltaKindUpsert,
+		Gvrk:      packetGvrk(gvrk),
 		Data:      newObj,
+		Base:      &oldObj,
 		Timestamp: time.Now(),
 	}
 
@@ -222,6 +344,7 @@ func (ew *EntitiesWatcher) OnDelete(gvrk kuber.GroupVersionResourceKind, obj uns
 
 	delta := agent.Delta{
 		Kind:      agent.EntityDeltaKindDelete,
+		Gvrk:      packetGvrk(gvrk),
 		Data:      obj,
 		Timestamp: time.Now(),
 	}
@@ -232,6 +355,14 @@ func (ew *EntitiesWatcher) OnDelete(gvrk kuber.GroupVersionResourceKind, obj uns
 	}
 }
 
+func (ew *EntitiesWatcher) OnSecretFindings(gvrk kuber.GroupVersionResourceKind, obj unstructured.Unstructured, findings []kuber.SecretFinding) {
+	for handler := range ew.resourceEventHandlers {
+		if findingsHandler, ok := handler.(SecretFindingsEventsHandler); ok {
+			findingsHandler.OnResourceSecretFindings(gvrk, obj, findings)
+		}
+	}
+}
+
 func (ew *EntitiesWatcher) deltasWorker(ctx context.Context) {
 	// this worker should be started only once
 
@@ -246,18 +377,13 @@ func (ew *EntitiesWatcher) deltasWorker(ctx context.Context) {
 		for {
 			select {
 			case item := <-ew.deltasQueue:
-				identifier := fmt.Sprintf(
-					"%s:%s:%s",
-					item.Data.GetNamespace(),
-					item.Data.GetKind(),
-					item.Data.GetName(),
-				)
+				identifier := deltaKey(&item)
 				oldItem, ok := items[identifier]
 				if !ok {
 					items[identifier] = item
 				} else {
 					if item.Timestamp.After(oldItem.Timestamp) {
-						items[identifier] = item
+						items[identifier] = coalesceDeltas(oldItem, item)
 					}
 				}
 				if len(items) >= deltasPacketFlushAfterSize ||
@@ -274,8 +400,13 @@ func (ew *EntitiesWatcher) deltasWorker(ctx context.Context) {
 				deltas := make([]*agent.Delta, 0, len(items))
 				for _, item := range items {
 					_item := item
+					err := diffDelta(&_item)
+					if err != nil {
+						logger.Warnw("unable to diff entity, sending it in full", "error", err)
+					}
 					deltas = append(deltas, &_item)
 				}
+				ew.flushDeltas(deltas)
 				break
 			}
 		}
@@ -286,6 +417,17 @@ func (ew *EntitiesWatcher) deltasWorker(ctx context.Context) {
 	}
 }
 
+func (ew *EntitiesWatcher) flushDeltas(deltas []*agent.Delta) {
+	if ew.sendDeltas == nil || len(deltas) == 0 {
+		return
+	}
+	// the deltas are delivered by the pipe later, the error is about the packets it dropped
+	err := ew.sendDeltas(deltas, ew.bases.prepare(deltas))
+	if err != nil {
+		logger.Errorw("unable to send entities deltas", "error", err, "count", len(deltas))
+	}
+}
+
 func (ew *EntitiesWatcher) GetParents(namespace string, kind string, name string) (*kuber.ParentController, bool) {
 	return ew.observer.ParentsStore.GetParents(namespace, kind, name)
 }
@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixCorp/magalix-agent/v3/client"
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixCorp/magalix-agent/v3/utils"
+	"github.com/MagalixTechnologies/core/logger"
+	"github.com/MagalixTechnologies/uuid-go"
+)
+
+const (
+	commandResultPacketExpireAfter = 30 * time.Minute
+	commandResultPacketExpireCount = 0
+	commandResultPacketPriority    = 2
+	commandResultPacketRetries     = 5
+)
+
+// legacyCommands packets commands were sent with before the command packet,
+// they're run as the command of the same name and answered once finished
+var legacyCommands = []proto.PacketKind{
+	proto.PacketKindRestart,
+	proto.PacketKindLogLevel,
+	proto.PacketKindAuditCommand,
+	proto.PacketKindConstraintsRequest,
+}
+
+func (g *MagalixGateway) SetCommandHandler(handler agent.CommandHandler) {
+	if handler == nil {
+		panic("command handler is nil")
+	}
+	g.handleCommand = handler
+
+	for _, kind := range legacyCommands {
+		g.gwClient.AddListener(kind, g.legacyCommandListener(kind))
+	}
+
+	g.gwClient.AddListener(proto.PacketKindCommand, func(in []byte) ([]byte, error) {
+		var command proto.PacketCommand
+		if err := g.gwClient.CodecFor(proto.PacketKindCommand).Decode(in, &command); err != nil {
+			return nil, err
+		}
+		if command.ID.IsNil() {
+			command.ID = uuid.NewV4()
+		}
+
+		// the result is sent once the command finishes
+		go func() {
+			result := g.handleCommand(&agent.CommandRequest{
+				ID:      command.ID,
+				Name:    command.Name,
+				Timeout: command.Timeout,
+				Payload: command.Request,
+			})
+			err := g.SendCommandResult(result)
+			if err != nil {
+				logger.Errorw("unable to send command result", "command", command.Name, "id", command.ID, "error", err)
+			}
+		}()
+
+		return g.gwClient.CodecFor(proto.PacketKindCommand).Encode(proto.PacketCommandResult{
+			ID:    command.ID,
+			Name:  command.Name,
+			State: proto.CommandStateAccepted,
+		})
+	})
+}
+
+func (g *MagalixGateway) legacyCommandListener(kind proto.PacketKind) func(in []byte) ([]byte, error) {
+	return func(in []byte) ([]byte, error) {
+		// audit commands used to be empty, they audit everything
+		var payload json.RawMessage
+		if len(in) > 0 {
+			if err := g.gwClient.CodecFor(kind).Decode(in, &payload); err != nil {
+				return nil, err
+			}
+		}
+
+		result := g.handleCommand(&agent.CommandRequest{
+			ID:      uuid.NewV4(),
+			Name:    kind.String(),
+			Payload: payload,
+		})
+		if result.State == agent.CommandStateFailed {
+			return nil, errors.New(result.Error)
+		}
+		if result.Response == nil {
+			return nil, nil
+		}
+		return g.gwClient.CodecFor(kind).Encode(result.Response)
+	}
+}
+
+func (g *MagalixGateway) SendCommandResult(result *agent.CommandResult) error {
+	err := g.accepts(proto.PacketKindCommandResult)
+	if err != nil {
+		return err
+	}
+
+	packet := proto.PacketCommandResult{
+		ID:         result.ID,
+		Name:       result.Name,
+		State:      proto.CommandState(result.State),
+		Progress:   result.Progress,
+		Message:    result.Message,
+		Error:      result.Error,
+		StartedAt:  timeOrNil(result.StartedAt),
+		FinishedAt: timeOrNil(result.FinishedAt),
+	}
+	if result.Response != nil {
+		packet.Response, err = json.Marshal(result.Response)
+		if err != nil {
+			return fmt.Errorf("unable to encode %s command response, error: %w", result.Name, err)
+		}
+	}
+
+	return g.gwClient.Pipe(client.Package{
+		Kind:        proto.PacketKindCommandResult,
+		ExpiryTime:  utils.After(commandResultPacketExpireAfter),
+		ExpiryCount: commandResultPacketExpireCount,
+		Priority:    commandResultPacketPriority,
+		Retries:     commandResultPacketRetries,
+		Data:        packet,
+	})
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixCorp/magalix-agent/v3/client"
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixCorp/magalix-agent/v3/utils"
+)
+
+const (
+	deltasPacketExpireAfter = 30 * time.Minute
+	deltasPacketExpireCount = 0
+	deltasPacketPriority    = 3
+	deltasPacketRetries     = 5
+)
+
+func (g *MagalixGateway) SendEntitiesDeltas(deltas []*agent.Delta, done agent.DeltasDone) error {
+	err := g.accepts(proto.PacketKindEntitiesDeltas)
+	if err != nil {
+		return err
+	}
+
+	// gateways that don't apply patches get the whole entity
+	patches := g.gwClient.HasFeature(proto.FeatureDeltaPatches)
+	items := make([]proto.PacketEntityDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		item := proto.PacketEntityDelta{
+			Gvrk: proto.GroupVersionResourceKind{
+				GroupVersionResource: delta.Gvrk.GroupVersionResource,
+				Kind:                 delta.Gvrk.Kind,
+			},
+			DeltaKind: proto.EntityDeltaKind(delta.Kind),
+			Namespace: delta.Data.GetNamespace(),
+			Name:      delta.Data.GetName(),
+			Timestamp: delta.Timestamp,
+		}
+		if delta.Kind == agent.EntityDeltaKindPatch && patches {
+			item.Patch = delta.Patch
+			item.BaseResourceVersion = delta.BaseResourceVersion
+		} else {
+			if delta.Kind == agent.EntityDeltaKindPatch {
+				item.DeltaKind = proto.EntityEventTypeUpsert
+			}
+			item.Data = delta.Data.Object
+		}
+		items = append(items, item)
+	}
+
+	return g.gwClient.Pipe(client.Package{
+		Kind:        proto.PacketKindEntitiesDeltas,
+		ExpiryTime:  utils.After(deltasPacketExpireAfter),
+		ExpiryCount: deltasPacketExpireCount,
+		Priority:    deltasPacketPriority,
+		Retries:     deltasPacketRetries,
+		Data: proto.PacketEntitiesDeltasRequest{
+			Items:     items,
+			Timestamp: time.Now().UTC(),
+		},
+		OnDone: done,
+	})
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/MagalixCorp/magalix-agent/v3/agent"
@@ -20,73 +21,6 @@ const (
 	auditResultsBatchExpiry = 20 * time.Second
 )
 
-func (g *MagalixGateway) SetConstraintsHandler(handler agent.ConstraintsHandler) {
-	if handler == nil {
-		panic("constraints handler is nil")
-	}
-	g.addConstraints = handler
-	g.gwClient.AddListener(proto.PacketKindConstraintsRequest, func(in []byte) ([]byte, error) {
-		var constraintsRequest proto.PacketConstraintsRequest
-		if err := proto.DecodeSnappy(in, &constraintsRequest); err != nil {
-			return nil, err
-		}
-
-		constraints := make([]*agent.Constraint, 0, len(constraintsRequest.Constraints))
-		for _, c := range constraintsRequest.Constraints {
-			constraint := &agent.Constraint{
-				Id:           c.Id,
-				TemplateId:   c.TemplateId,
-				AccountId:    c.AccountId,
-				ClusterId:    c.ClusterId,
-				Name:         c.Name,
-				TemplateName: c.TemplateName,
-				Parameters:   c.Parameters,
-				Match: agent.Match{
-					Namespaces: c.Match.Namespaces,
-					Kinds:      c.Match.Kinds,
-					Labels:     c.Match.Labels,
-				},
-				Code:        c.Code,
-				Description: c.Description,
-				HowToSolve:  c.HowToSolve,
-				UpdatedAt:   c.UpdatedAt,
-				CategoryId:  c.CategoryId,
-				Severity:    c.Severity,
-				Controls:    c.Controls,
-				Standards:   c.Standards,
-				DeletedAt:   c.DeletedAt,
-			}
-			constraints = append(constraints, constraint)
-		}
-		errMap := g.addConstraints(constraints)
-		if errMap != nil && len(errMap) > 0 {
-			// TODO: Send errors and ids in constraint response
-			for id, err := range errMap {
-				logger.Errorw("Couldn't add constraint", "error", err, "constraint-id", id)
-			}
-		}
-
-		return proto.EncodeSnappy(proto.PacketConstraintsResponse{})
-	})
-}
-
-func (g *MagalixGateway) SetAuditCommandHandler(handler agent.AuditCommandHandler) {
-	if handler == nil {
-		panic("audi command handler is nil")
-	}
-	g.handleAuditCommand = handler
-	g.gwClient.AddListener(proto.PacketKindAuditCommand, func(in []byte) ([]byte, error) {
-		// Packet is empty so no need to decode
-
-		err := g.handleAuditCommand()
-		if err != nil {
-			logger.Errorw("Couldn't run audit", "error", err)
-		}
-
-		return nil, err
-	})
-}
-
 func (g *MagalixGateway) SendAuditResults(auditResults []*agent.AuditResult) error {
 	for _, auditResult := range auditResults {
 		g.auditResultChan <- auditResult
@@ -96,8 +30,14 @@ func (g *MagalixGateway) SendAuditResults(auditResults []*agent.AuditResult) err
 
 func (g *MagalixGateway) SendAuditResultsWorker(ctx context.Context) error {
 	timer := time.NewTicker(auditResultsBatchExpiry)
+	defer timer.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
+		case flushed := <-g.auditResultsFlush:
+			g.flushAuditResults()
+			close(flushed)
 		case result := <-g.auditResultChan:
 			g.auditResultsBuffer = append(g.auditResultsBuffer, result)
 			if len(g.auditResultsBuffer) == cap(g.auditResultsBuffer) {
@@ -114,7 +54,39 @@ func (g *MagalixGateway) SendAuditResultsWorker(ctx context.Context) error {
 	}
 }
 
+// flushAuditResults pipes the buffered audit results and the ones waiting to be buffered
+func (g *MagalixGateway) flushAuditResults() {
+	// the worker is the only reader of the channel
+	for len(g.auditResultChan) > 0 {
+		g.auditResultsBuffer = append(g.auditResultsBuffer, <-g.auditResultChan)
+	}
+	if len(g.auditResultsBuffer) > 0 {
+		g.SendAuditResultsBatch(g.auditResultsBuffer)
+		g.auditResultsBuffer = g.auditResultsBuffer[:0]
+	}
+}
+
+// syncAuditResults makes the audit results worker pipe its buffered results
+func (g *MagalixGateway) syncAuditResults(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case g.auditResultsFlush <- flushed:
+	case <-ctx.Done():
+		return fmt.Errorf("audit results worker is not running, error: %w", ctx.Err())
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("unable to flush audit results, error: %w", ctx.Err())
+	}
+}
+
 func (g *MagalixGateway) SendAuditResultsBatch(auditResult []*agent.AuditResult) {
+	if err := g.accepts(proto.PacketKindAuditResultRequest); err != nil {
+		logger.Errorw("unable to send audit results", "error", err)
+		return
+	}
 	items := make([]*proto.PacketAuditResultItem, 0, len(auditResult))
 	for _, r := range auditResult {
 		items = append(items, r.ToPacket())
@@ -3,104 +3,41 @@ package gateway
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/MagalixCorp/magalix-agent/v3/agent"
 	"github.com/MagalixCorp/magalix-agent/v3/client"
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
 	"github.com/MagalixTechnologies/core/logger"
-	"github.com/MagalixTechnologies/uuid-go"
 	"go.uber.org/zap/zapcore"
 )
 
 const auditResultsBatchSize = 1000
 
 type MagalixGateway struct {
-	MgxAgentGatewayUrl string
-
-	AccountID    uuid.UUID
-	ClusterID    uuid.UUID
-	ClientSecret []byte
-
-	AgentVersion string
-	AgentID      string
-
-	K8sServerVersion string
-	AgentPermissions string
-	ClusterProvider  string
-
-	ProtoHandshake     time.Duration
-	ProtoWriteTime     time.Duration
-	ProtoReadTime      time.Duration
-	ProtoReconnectTime time.Duration
-	ProtoBackoff       time.Duration
-
-	ShouldSendLogs bool
-
 	gwClient           *client.Client
 	connectedChan      chan bool
 	cancelWorkers      context.CancelFunc
-	addConstraints     agent.ConstraintsHandler
-	handleAuditCommand agent.AuditCommandHandler
-	triggerRestart     agent.RestartHandler
-	changeLogLevel     agent.ChangeLogLevelHandler
+	handleCommand      agent.CommandHandler
 	auditResultsBuffer []*agent.AuditResult
 	auditResultChan    chan *agent.AuditResult
+	auditResultsFlush  chan chan struct{}
+}
+
+// Options of the gateway, they configure the client connecting to it
+type Options struct {
+	client.Options
 }
 
-func New(
-	gatewayUrl string,
-	accountID uuid.UUID,
-	clusterID uuid.UUID,
-	secret []byte,
-	agentVersion string,
-	agentID string,
-	k8sServerVersion string,
-	agentPermissions string,
-	clusterProvider string,
-	protoHandshake time.Duration,
-	protoWriteTime time.Duration,
-	protoReadTime time.Duration,
-	protoReconnectTime time.Duration,
-	protoBackoff time.Duration,
-	sendLogs bool,
-) *MagalixGateway {
+func New(options Options) *MagalixGateway {
 	connected := make(chan bool)
 	return &MagalixGateway{
-		MgxAgentGatewayUrl: gatewayUrl,
-		AccountID:          accountID,
-		ClusterID:          clusterID,
-		ClientSecret:       secret,
-		AgentVersion:       agentVersion,
-		AgentID:            agentID,
-		K8sServerVersion:   k8sServerVersion,
-		AgentPermissions:   agentPermissions,
-		ClusterProvider:    clusterProvider,
-		ProtoHandshake:     protoHandshake,
-		ProtoWriteTime:     protoWriteTime,
-		ProtoReadTime:      protoReadTime,
-		ProtoReconnectTime: protoReconnectTime,
-		ProtoBackoff:       protoBackoff,
-		ShouldSendLogs:     sendLogs,
 		connectedChan:      connected,
-		gwClient: client.InitClient(
-			agentVersion,
-			agentID,
-			accountID,
-			clusterID,
-			secret,
-			k8sServerVersion,
-			agentPermissions,
-			clusterProvider,
-			gatewayUrl,
-			protoHandshake,
-			protoWriteTime,
-			protoReadTime,
-			protoReconnectTime,
-			protoBackoff,
-			sendLogs,
-		),
+		gwClient:           client.InitClient(options.Options),
 		auditResultsBuffer: make([]*agent.AuditResult, 0, auditResultsBatchSize),
 		auditResultChan:    make(chan *agent.AuditResult, 50),
+		auditResultsFlush:  make(chan chan struct{}),
 	}
 }
 
@@ -123,20 +60,57 @@ func (g *MagalixGateway) Stop() error {
 	return nil
 }
 
-func (g *MagalixGateway) WaitAuthorization(timeout time.Duration) error {
+// ConnectionStatus gets the state of the connection to the gateway
+func (g *MagalixGateway) ConnectionStatus() client.ConnectionStatus {
+	return g.gwClient.ConnectionStatus()
+}
+
+// WatchdogStats gets the liveness and the latency of the connection to the gateway
+func (g *MagalixGateway) WatchdogStats() client.WatchdogStats {
+	return g.gwClient.WatchdogStats()
+}
+
+// PipeStats gets the pending and dropped packets of the gateway pipe
+func (g *MagalixGateway) PipeStats() client.PipeStats {
+	return g.gwClient.PipeStats()
+}
+
+// accepts refuses the packet kinds the agent gateway said it can't handle
+func (g *MagalixGateway) accepts(kind proto.PacketKind) error {
+	if !g.gwClient.Accepts(kind) {
+		return fmt.Errorf("%w: %s", client.ErrUnsupportedKind, kind)
+	}
+	return nil
+}
+
+// WaitAuthorization blocks until the agent is authorized, a suspended agent
+// waits until it's accepted again. It returns once ctx is done.
+func (g *MagalixGateway) WaitAuthorization(ctx context.Context, timeout time.Duration) error {
 	logger.Info("waiting for connection and authorization")
 	if g.gwClient.IsReady() {
 		return nil
 	}
 
-	select {
-	case <-g.connectedChan:
-		logger.Info("Connected and authorized")
-		return nil
-	case <-time.After(timeout):
-		err := errors.New("authorization timeout")
-		logger.Error(err)
-		return err
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.connectedChan:
+			logger.Info("Connected and authorized")
+			return nil
+		case <-timer.C:
+			// a suspended agent waits to be accepted instead of exiting
+			if state, _ := g.gwClient.State(); state == client.StateSuspended {
+				logger.Info("agent is still suspended, waiting for authorization")
+				timer.Reset(timeout)
+				continue
+			}
+			err := errors.New("authorization timeout")
+			logger.Error(err)
+			return err
+		}
 	}
 }
 
@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sync pipes the buffered audit results and logs, then waits until every
+// piped packet is sent to the agent gateway or ctx is done
+func (g *MagalixGateway) Sync(ctx context.Context) error {
+	err := g.syncAuditResults(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = g.gwClient.Drain(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to send pending packets, error: %w", err)
+	}
+	return nil
+}
+
+// SendBye tells the agent gateway that the agent is going away
+func (g *MagalixGateway) SendBye(reason string) error {
+	err := g.gwClient.Bye(reason)
+	if err != nil {
+		return fmt.Errorf("unable to send bye, error: %w", err)
+	}
+	return nil
+}
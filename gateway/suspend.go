@@ -0,0 +1,23 @@
+package gateway
+
+import (
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixTechnologies/core/logger"
+)
+
+func (g *MagalixGateway) SetSuspendHandler(handler agent.SuspendHandler) {
+	if handler == nil {
+		panic("suspend handler is nil")
+	}
+	g.gwClient.SetSuspendHandler(func(suspended bool) {
+		err := handler(suspended)
+		if err != nil {
+			logger.Errorw("unable to handle agent suspension", "suspended", suspended, "error", err)
+		}
+	})
+}
+
+// Retry connects to the gateway right away if the agent is suspended or waiting to reconnect
+func (g *MagalixGateway) Retry() error {
+	return g.gwClient.Retry()
+}
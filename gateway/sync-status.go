@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/agent"
+	"github.com/MagalixCorp/magalix-agent/v3/client"
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+	"github.com/MagalixCorp/magalix-agent/v3/utils"
+)
+
+const (
+	syncStatusPacketExpireAfter = 30 * time.Minute
+	// only the latest status matters
+	syncStatusPacketExpireCount = 1
+	syncStatusPacketPriority    = 2
+	syncStatusPacketRetries     = 5
+)
+
+func (g *MagalixGateway) SendSyncStatus(statuses []*agent.ResourceSyncStatus) error {
+	err := g.accepts(proto.PacketKindSyncStatusRequest)
+	if err != nil {
+		return err
+	}
+
+	items := make([]proto.PacketSyncStatusItem, 0, len(statuses))
+	for _, status := range statuses {
+		items = append(items, proto.PacketSyncStatusItem{
+			GroupVersionResourceKind: proto.GroupVersionResourceKind{
+				GroupVersionResource: status.GroupVersionResource,
+				Kind:                 status.Kind,
+			},
+			State:         status.State,
+			LastError:     status.LastError,
+			LastErrorTime: timeOrNil(status.LastErrorTime),
+			SyncedAt:      timeOrNil(status.SyncedAt),
+			NextRetry:     timeOrNil(status.NextRetry),
+		})
+	}
+
+	return g.gwClient.Pipe(client.Package{
+		Kind:        proto.PacketKindSyncStatusRequest,
+		ExpiryTime:  utils.After(syncStatusPacketExpireAfter),
+		ExpiryCount: syncStatusPacketExpireCount,
+		Priority:    syncStatusPacketPriority,
+		Retries:     syncStatusPacketRetries,
+		Data: proto.PacketSyncStatusRequest{
+			Items:     items,
+			Timestamp: time.Now().UTC(),
+		},
+	})
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
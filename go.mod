@@ -8,26 +8,32 @@ require (
 	github.com/MagalixTechnologies/opa-core v1.0.12
 	github.com/MagalixTechnologies/uuid-go v0.0.0-20210127133914-f8f07f7ab96e
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/evanphx/json-patch v4.12.0+incompatible
 	github.com/golang/snappy v0.0.4
 	github.com/google/go-cmp v0.5.7 // indirect
 	github.com/google/gofuzz v1.2.0 // indirect
+	github.com/gorilla/websocket v1.4.2
+	github.com/klauspost/compress v1.13.5
 	github.com/miekg/dns v1.1.45 // indirect
 	github.com/onsi/gomega v1.18.1 // indirect
+	github.com/open-policy-agent/opa v0.37.1
 	github.com/pkg/errors v0.9.1
 	github.com/reconquest/sign-go v0.0.0-20181113092801-8d4f8c5854ae
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
 	go.uber.org/zap v1.20.0
 	golang.org/x/crypto v0.0.0-20220131195533-30dcbda58838 // indirect
-	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
+	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27 // indirect
 	golang.org/x/tools v0.1.9 // indirect
+	google.golang.org/protobuf v1.27.1
 	k8s.io/api v0.23.3
 	k8s.io/apimachinery v0.23.3
 	k8s.io/client-go v0.23.3
 	k8s.io/klog/v2 v2.40.1 // indirect
 	k8s.io/utils v0.0.0-20220127004650-9b3446523e65 // indirect
 	sigs.k8s.io/json v0.0.0-20211208200746-9f7c6b3444d2 // indirect
+	sigs.k8s.io/yaml v1.2.0
 
 )
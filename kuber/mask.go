@@ -1,15 +1,29 @@
 package kuber
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"regexp"
 
 	"github.com/MagalixCorp/magalix-agent/v3/utils"
 	corev1 "k8s.io/api/core/v1"
 	kv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+// hashedValuePrefix prefixes values masked with a keyed hash
+const hashedValuePrefix = "hmac-sha256:"
+
+// snapshotMaskedAnnotation marks the objects read from a snapshot, they were masked
+// before they were written. It isn't a valid annotation key so the api server never
+// returns objects with it, whatever their values are.
+const snapshotMaskedAnnotation = "agent.magalix.com/masked#snapshot"
+
 var (
 	podSpecMap = map[string][]string{
 		Pods.Kind:                   {"spec"},
@@ -21,45 +35,237 @@ var (
 		Jobs.Kind:                   {"spec", "template", "spec"},
 		CronJobs.Kind:               {"spec", "jobTemplate", "spec", "template", "spec"},
 	}
+
+	// DefaultMaskingRules masks the values of every env var and every container arg,
+	// commands and annotations are kept as is
+	DefaultMaskingRules = MaskingRules{
+		Env:  MaskingRule{MaskByDefault: true},
+		Args: MaskingRule{MaskByDefault: true},
+	}
 )
 
-func maskContainers(containers []kv1.Container) (masked []kv1.Container) {
-	for _, container := range containers {
-		container.Env = maskEnvVars(container.Env)
-		container.Args = maskArgs(container.Args)
-		masked = append(masked, container)
+// MaskingRule decides which values of a field are masked.
+// Deny takes precedence over Allow, values matching neither are masked if MaskByDefault is set.
+type MaskingRule struct {
+	MaskByDefault bool `json:"maskByDefault"`
+	// Allow patterns of the values to keep as is
+	Allow []string `json:"allow,omitempty"`
+	// Deny patterns of the values to mask
+	Deny []string `json:"deny,omitempty"`
+}
+
+// MaskingRules masking rules of every maskable field
+type MaskingRules struct {
+	// Env rules matched against the names of the env vars of containers
+	Env MaskingRule `json:"env"`
+	// Args rules matched against every arg of containers, e.g. "--port=8080"
+	Args MaskingRule `json:"args"`
+	// Command rules matched against every item of the command of containers
+	Command MaskingRule `json:"command"`
+	// Annotations rules matched against the annotation keys of every object
+	Annotations MaskingRule `json:"annotations"`
+}
+
+// HasPodSpec returns true if the objects of kind embed a pod spec
+func HasPodSpec(kind string) bool {
+	_, ok := podSpecMap[kind]
+	return ok
+}
+
+// LoadMaskingRules reads masking rules from a yaml or json file
+func LoadMaskingRules(path string) (MaskingRules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return MaskingRules{}, fmt.Errorf("unable to read masking rules file, error: %w", err)
 	}
-	return
+
+	var rules MaskingRules
+	err = yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return MaskingRules{}, fmt.Errorf("unable to parse masking rules file %s, error: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+type maskingMatcher struct {
+	maskByDefault bool
+	allow         []*regexp.Regexp
+	deny          []*regexp.Regexp
+}
+
+func newMaskingMatcher(rule MaskingRule) (*maskingMatcher, error) {
+	matcher := &maskingMatcher{maskByDefault: rule.MaskByDefault}
+	for _, pattern := range rule.Allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q, error: %w", pattern, err)
+		}
+		matcher.allow = append(matcher.allow, re)
+	}
+	for _, pattern := range rule.Deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q, error: %w", pattern, err)
+		}
+		matcher.deny = append(matcher.deny, re)
+	}
+	return matcher, nil
+}
+
+func (m *maskingMatcher) shouldMask(value string) bool {
+	for _, re := range m.deny {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	for _, re := range m.allow {
+		if re.MatchString(value) {
+			return false
+		}
+	}
+	return m.maskByDefault
+}
+
+// MaskingPolicy masks the sensitive values of objects before they leave the informers.
+// If a key is set masked values are replaced with a keyed hash of the value so equal
+// values are still equal after masking, otherwise they're replaced with a constant.
+type MaskingPolicy struct {
+	env         *maskingMatcher
+	args        *maskingMatcher
+	command     *maskingMatcher
+	annotations *maskingMatcher
+	key         []byte
+}
+
+func NewMaskingPolicy(rules MaskingRules, key []byte) (*MaskingPolicy, error) {
+	var err error
+	policy := &MaskingPolicy{key: key}
+	policy.env, err = newMaskingMatcher(rules.Env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env masking rule, error: %w", err)
+	}
+	policy.args, err = newMaskingMatcher(rules.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid args masking rule, error: %w", err)
+	}
+	policy.command, err = newMaskingMatcher(rules.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command masking rule, error: %w", err)
+	}
+	policy.annotations, err = newMaskingMatcher(rules.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations masking rule, error: %w", err)
+	}
+	return policy, nil
+}
+
+// mask returns the masked form of value
+func (p *MaskingPolicy) mask(value string) string {
+	if len(p.key) == 0 {
+		return maskedValue
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(value))
+	return hashedValuePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *MaskingPolicy) maskContainer(container *kv1.Container) {
+	container.Env = p.maskEnvVars(container.Env)
+	container.Args = p.maskValues(p.args, container.Args)
+	container.Command = p.maskValues(p.command, container.Command)
 }
 
-func maskEnvVars(env []kv1.EnvVar) (masked []kv1.EnvVar) {
+func (p *MaskingPolicy) maskContainers(containers []kv1.Container) []kv1.Container {
+	for i := range containers {
+		p.maskContainer(&containers[i])
+	}
+	return containers
+}
+
+func (p *MaskingPolicy) maskEphemeralContainers(containers []kv1.EphemeralContainer) []kv1.EphemeralContainer {
+	for i := range containers {
+		common := &containers[i].EphemeralContainerCommon
+		common.Env = p.maskEnvVars(common.Env)
+		common.Args = p.maskValues(p.args, common.Args)
+		common.Command = p.maskValues(p.command, common.Command)
+	}
+	return containers
+}
+
+func (p *MaskingPolicy) maskEnvVars(env []kv1.EnvVar) (masked []kv1.EnvVar) {
+	if env == nil {
+		return nil
+	}
 	masked = make([]kv1.EnvVar, len(env))
 	for i, envVar := range env {
-		if envVar.Value != "" {
-			envVar.Value = maskedValue
+		if envVar.Value != "" && p.env.shouldMask(envVar.Name) {
+			envVar.Value = p.mask(envVar.Value)
 		}
 		masked[i] = envVar
 	}
 	return
 }
 
-func maskArgs(args []string) (masked []string) {
-	masked = make([]string, len(args))
-	for i := range args {
-		masked[i] = maskedValue
+func (p *MaskingPolicy) maskValues(matcher *maskingMatcher, values []string) (masked []string) {
+	if values == nil {
+		return nil
+	}
+	masked = make([]string, len(values))
+	for i, value := range values {
+		if matcher.shouldMask(value) {
+			value = p.mask(value)
+		}
+		masked[i] = value
 	}
 	return
 }
 
-func maskUnstructured(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+// maskAnnotations masks the annotations of obj in place, obj must be a copy
+func (p *MaskingPolicy) maskAnnotations(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	changed := false
+	for key, value := range annotations {
+		if p.annotations.shouldMask(key) {
+			annotations[key] = p.mask(value)
+			changed = true
+		}
+	}
+	if changed {
+		obj.SetAnnotations(annotations)
+	}
+}
+
+func (p *MaskingPolicy) hasAnnotationRules() bool {
+	return p.annotations.maskByDefault || len(p.annotations.deny) > 0
+}
+
+// Mask returns a masked copy of obj, obj is returned as is if there is nothing to mask.
+// Objects read from a snapshot are already masked, only their marker is removed.
+func (p *MaskingPolicy) Mask(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if isSnapshotMasked(obj) {
+		obj = obj.DeepCopy()
+		annotations := obj.GetAnnotations()
+		delete(annotations, snapshotMaskedAnnotation)
+		obj.SetAnnotations(annotations)
+		return obj, nil
+	}
+
 	kind := obj.GetKind()
 	errMap := map[string]interface{}{
 		"kind": kind,
 	}
 
-	podSpecPath, ok := podSpecMap[kind]
-	if !ok {
-		// not maskable kind
+	podSpecPath, hasPodSpec := podSpecMap[kind]
+	if !hasPodSpec && !(p.hasAnnotationRules() && len(obj.GetAnnotations()) > 0) {
+		// not maskable object
+		return obj, nil
+	}
+
+	// deep copy to not mutate the data from cash store
+	obj = obj.DeepCopy()
+	p.maskAnnotations(obj)
+	if !hasPodSpec {
 		return obj, nil
 	}
 
@@ -77,8 +283,9 @@ func maskUnstructured(obj *unstructured.Unstructured) (*unstructured.Unstructure
 		return nil, fmt.Errorf("unable to transcode pod spec, error: %w with data %+v", err, errMap)
 	}
 
-	podSpec.Containers = maskContainers(podSpec.Containers)
-	podSpec.InitContainers = maskContainers(podSpec.InitContainers)
+	podSpec.Containers = p.maskContainers(podSpec.Containers)
+	podSpec.InitContainers = p.maskContainers(podSpec.InitContainers)
+	podSpec.EphemeralContainers = p.maskEphemeralContainers(podSpec.EphemeralContainers)
 
 	var podSpecJson map[string]interface{}
 	err = utils.Transcode(podSpec, &podSpecJson)
@@ -86,8 +293,6 @@ func maskUnstructured(obj *unstructured.Unstructured) (*unstructured.Unstructure
 		return nil, fmt.Errorf("unable to transcode pod spec, error: %w with data %+v", err, errMap)
 	}
 
-	// deep copy to not mutate the data from cash store
-	obj = obj.DeepCopy()
 	err = unstructured.SetNestedField(obj.Object, podSpecJson, podSpecPath...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to set pod spec, error: %w, with data %+v", err, errMap)
@@ -95,3 +300,24 @@ func maskUnstructured(obj *unstructured.Unstructured) (*unstructured.Unstructure
 
 	return obj, nil
 }
+
+// defaultMaskingPolicy is used when the observer has no masking policy
+var defaultMaskingPolicy = func() *MaskingPolicy {
+	policy, err := NewMaskingPolicy(DefaultMaskingRules, nil)
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}()
+
+func isSnapshotMasked(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetAnnotations()[snapshotMaskedAnnotation]
+	return ok
+}
+
+func maskUnstructured(obj *unstructured.Unstructured, policy *MaskingPolicy) (*unstructured.Unstructured, error) {
+	if policy == nil {
+		policy = defaultMaskingPolicy
+	}
+	return policy.Mask(obj)
+}
@@ -0,0 +1,163 @@
+package kuber
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newMaskingTestPod() *unstructured.Unstructured {
+	container := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":    name,
+			"image":   "nginx",
+			"command": []interface{}{"server", "--password=secret"},
+			"args":    []interface{}{"--port=8080", "--token=secret"},
+			"env": []interface{}{
+				map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+				map[string]interface{}{"name": "DB_PASSWORD", "value": "secret"},
+				map[string]interface{}{"name": "API_TOKEN", "value": "secret"},
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       Pods.Kind,
+		"metadata": map[string]interface{}{
+			"name": "web",
+			"annotations": map[string]interface{}{
+				"example.com/token": "secret",
+				"team":              "a",
+			},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{container("web")},
+			"ephemeralContainers": []interface{}{
+				container("debugger"),
+			},
+		},
+	}}
+}
+
+func TestMaskingPolicy_Mask(t *testing.T) {
+	policy, err := NewMaskingPolicy(MaskingRules{
+		Env:         MaskingRule{MaskByDefault: true, Allow: []string{"^LOG_LEVEL$"}},
+		Args:        MaskingRule{MaskByDefault: true, Allow: []string{`^--port=\d+$`}},
+		Command:     MaskingRule{Deny: []string{"password"}},
+		Annotations: MaskingRule{Deny: []string{"token"}},
+	}, []byte("key"))
+	if err != nil {
+		t.Fatalf("NewMaskingPolicy() error = %v", err)
+	}
+
+	obj := newMaskingTestPod()
+	masked, err := policy.Mask(obj)
+	if err != nil {
+		t.Fatalf("Mask() error = %v", err)
+	}
+
+	if annotations := obj.GetAnnotations(); annotations["example.com/token"] != "secret" {
+		t.Errorf("Mask() should not mutate the original object")
+	}
+	annotations := masked.GetAnnotations()
+	if annotations["team"] != "a" || !strings.HasPrefix(annotations["example.com/token"], hashedValuePrefix) {
+		t.Errorf("masked annotations = %v", annotations)
+	}
+
+	for _, field := range []string{"containers", "ephemeralContainers"} {
+		containers, _, _ := unstructured.NestedSlice(masked.Object, "spec", field)
+		if len(containers) != 1 {
+			t.Fatalf("masked %s = %v", field, containers)
+		}
+		container := containers[0].(map[string]interface{})
+
+		args, _, _ := unstructured.NestedStringSlice(container, "args")
+		if args[0] != "--port=8080" || !strings.HasPrefix(args[1], hashedValuePrefix) {
+			t.Errorf("masked %s args = %v", field, args)
+		}
+		command, _, _ := unstructured.NestedStringSlice(container, "command")
+		if command[0] != "server" || !strings.HasPrefix(command[1], hashedValuePrefix) {
+			t.Errorf("masked %s command = %v", field, command)
+		}
+
+		env, _, _ := unstructured.NestedSlice(container, "env")
+		values := map[string]string{}
+		for _, item := range env {
+			envVar := item.(map[string]interface{})
+			values[envVar["name"].(string)] = envVar["value"].(string)
+		}
+		if values["LOG_LEVEL"] != "debug" {
+			t.Errorf("allowed env var should be kept, got %v", values)
+		}
+		if values["DB_PASSWORD"] == "secret" || values["DB_PASSWORD"] != values["API_TOKEN"] {
+			t.Errorf("equal secrets should be masked to equal values, got %v", values)
+		}
+	}
+}
+
+func TestMaskingPolicy_DefaultRules(t *testing.T) {
+	masked, err := maskUnstructured(newMaskingTestPod(), nil)
+	if err != nil {
+		t.Fatalf("maskUnstructured() error = %v", err)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(masked.Object, "spec", "containers")
+	container := containers[0].(map[string]interface{})
+	args, _, _ := unstructured.NestedStringSlice(container, "args")
+	for _, arg := range args {
+		if arg != maskedValue {
+			t.Errorf("every arg should be masked by default, got %v", args)
+		}
+	}
+	command, _, _ := unstructured.NestedStringSlice(container, "command")
+	if command[1] != "--password=secret" {
+		t.Errorf("commands should be kept by default, got %v", command)
+	}
+	if masked.GetAnnotations()["example.com/token"] != "secret" {
+		t.Errorf("annotations should be kept by default")
+	}
+}
+
+func TestMaskingPolicy_SnapshotObjects(t *testing.T) {
+	policy, err := NewMaskingPolicy(DefaultMaskingRules, []byte("key"))
+	if err != nil {
+		t.Fatalf("NewMaskingPolicy() error = %v", err)
+	}
+
+	// live values are masked whatever they look like
+	live := newMaskingTestPod()
+	containers, _, _ := unstructured.NestedSlice(live.Object, "spec", "containers")
+	containers[0].(map[string]interface{})["args"] = []interface{}{hashedValuePrefix + "secret", maskedValue}
+	_ = unstructured.SetNestedSlice(live.Object, containers, "spec", "containers")
+	masked, err := policy.Mask(live)
+	if err != nil {
+		t.Fatalf("Mask() error = %v", err)
+	}
+	containers, _, _ = unstructured.NestedSlice(masked.Object, "spec", "containers")
+	args, _, _ := unstructured.NestedStringSlice(containers[0].(map[string]interface{}), "args")
+	for _, arg := range args {
+		if arg == hashedValuePrefix+"secret" || arg == maskedValue {
+			t.Errorf("values that look masked should still be masked, got %v", args)
+		}
+	}
+
+	// objects read from a snapshot are not masked twice
+	snapshot := (&SnapshotResource{
+		GroupVersionResourceKind: Pods,
+		Objects:                  []map[string]interface{}{masked.DeepCopy().Object},
+	}).list()
+	fromSnapshot := &snapshot.Items[0]
+	if !isSnapshotMasked(fromSnapshot) {
+		t.Fatalf("objects of a snapshot should be marked as masked")
+	}
+	unmarked, err := policy.Mask(fromSnapshot)
+	if err != nil {
+		t.Fatalf("Mask() error = %v", err)
+	}
+	if isSnapshotMasked(unmarked) || !reflect.DeepEqual(unmarked.Object, masked.Object) {
+		t.Errorf("Mask() of a snapshot object = %v, want %v", unmarked.Object, masked.Object)
+	}
+}
@@ -0,0 +1,68 @@
+package kuber
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// MemoryUsage is the estimated memory held by the cached objects of a resource
+type MemoryUsage struct {
+	GroupVersionResourceKind
+
+	Objects int64
+	Bytes   int64
+	// PrunedBytes estimated bytes removed by the prune rules since the informer started
+	PrunedBytes int64
+}
+
+// memoryAccount keeps track of the estimated size of the objects cached by an informer
+type memoryAccount struct {
+	objects int64
+	bytes   int64
+	pruned  int64
+}
+
+func (a *memoryAccount) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			atomic.AddInt64(&a.objects, 1)
+			atomic.AddInt64(&a.bytes, objectSize(obj))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			atomic.AddInt64(&a.bytes, objectSize(newObj)-objectSize(oldObj))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			atomic.AddInt64(&a.objects, -1)
+			atomic.AddInt64(&a.bytes, -objectSize(obj))
+		},
+	}
+}
+
+func (a *memoryAccount) usage(gvrk GroupVersionResourceKind) MemoryUsage {
+	return MemoryUsage{
+		GroupVersionResourceKind: gvrk,
+		Objects:                  atomic.LoadInt64(&a.objects),
+		Bytes:                    atomic.LoadInt64(&a.bytes),
+		PrunedBytes:              atomic.LoadInt64(&a.pruned),
+	}
+}
+
+func objectSize(obj interface{}) int64 {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u == nil {
+		return 0
+	}
+	return estimateSize(u.Object)
+}
+
+func sortMemoryUsages(usages []MemoryUsage) {
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].String() < usages[j].String()
+	})
+}
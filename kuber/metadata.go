@@ -0,0 +1,101 @@
+package kuber
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MagalixTechnologies/core/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/metadata"
+)
+
+// resourceClient lists and watches objects of a single resource
+type resourceClient interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// metadataResourceClient lists and watches only the metadata of objects so
+// their payload, e.g. the data of secrets, never reaches the agent.
+// Objects are converted to *unstructured.Unstructured holding apiVersion,
+// kind and metadata so they are handled like any other watched object.
+type metadataResourceClient struct {
+	client metadata.Getter
+	gvrk   GroupVersionResourceKind
+}
+
+func newMetadataResourceClient(client metadata.Interface, gvrk GroupVersionResourceKind) *metadataResourceClient {
+	return &metadataResourceClient{
+		client: client.Resource(gvrk.GroupVersionResource),
+		gvrk:   gvrk,
+	}
+}
+
+func (c *metadataResourceClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	partialList, err := c.client.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{
+		Object: map[string]interface{}{},
+		Items:  make([]unstructured.Unstructured, 0, len(partialList.Items)),
+	}
+	list.SetAPIVersion(c.gvrk.GroupVersion().String())
+	list.SetKind(c.gvrk.Kind + "List")
+	list.SetResourceVersion(partialList.ResourceVersion)
+	list.SetContinue(partialList.Continue)
+	if partialList.RemainingItemCount != nil {
+		list.SetRemainingItemCount(partialList.RemainingItemCount)
+	}
+
+	for i := range partialList.Items {
+		u, err := c.toUnstructured(&partialList.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *u)
+	}
+
+	return list, nil
+}
+
+func (c *metadataResourceClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := c.client.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		partial, ok := in.Object.(*metav1.PartialObjectMetadata)
+		if !ok {
+			// errors are passed as is
+			return in, true
+		}
+		u, err := c.toUnstructured(partial)
+		if err != nil {
+			logger.Errorw("unable to convert object metadata", "resource", c.gvrk.String(), "error", err)
+			return in, false
+		}
+		in.Object = u
+		return in, true
+	}), nil
+}
+
+func (c *metadataResourceClient) toUnstructured(partial *metav1.PartialObjectMetadata) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(partial)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to convert %s %s/%s metadata to unstructured, error: %w",
+			c.gvrk.Kind, partial.Namespace, partial.Name, err,
+		)
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(c.gvrk.GroupVersion().String())
+	u.SetKind(c.gvrk.Kind)
+	return u, nil
+}
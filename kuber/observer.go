@@ -4,28 +4,72 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MagalixTechnologies/core/logger"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
-	"k8s.io/client-go/informers"
+	"k8s.io/client-go/dynamic/dynamiclister"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/cache"
 )
 
+const (
+	// forbiddenRetryInterval how long a watcher stays disabled after the api server
+	// refused to list or watch its resource before it's retried
+	forbiddenRetryInterval = 15 * time.Minute
+
+	cacheSyncTimeout      = time.Minute
+	cacheSyncPollInterval = 100 * time.Millisecond
+)
+
 type Observer struct {
-	dynamicinformer.DynamicSharedInformerFactory
 	ParentsStore *ParentsStore
+	Ownership    *OwnershipGraph
 
-	stopCh chan struct{}
+	client         dynamic.Interface
+	metadataClient metadata.Interface
+	transformer    *Transformer
+	masking        *MaskingPolicy
+	detector       *SecretDetector
+	defaultResync  time.Duration
+
+	watchers map[GroupVersionResourceKind]*watcher
+	snapshot map[GroupVersionResourceKind]*SnapshotResource
+	mutex    sync.Mutex
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
-func NewObserver(client dynamic.Interface, parentsStore *ParentsStore, stopCh chan struct{}, defaultResync time.Duration) *Observer {
+func NewObserver(
+	client dynamic.Interface,
+	metadataClient metadata.Interface,
+	parentsStore *ParentsStore,
+	transformer *Transformer,
+	masking *MaskingPolicy,
+	detector *SecretDetector,
+	stopCh chan struct{},
+	defaultResync time.Duration,
+) *Observer {
 	return &Observer{
-		DynamicSharedInformerFactory: dynamicinformer.NewDynamicSharedInformerFactory(client, defaultResync),
-		ParentsStore:                 parentsStore,
-		stopCh:                       stopCh,
+		ParentsStore:   parentsStore,
+		Ownership:      NewOwnershipGraph(),
+		client:         client,
+		metadataClient: metadataClient,
+		transformer:    transformer,
+		masking:        masking,
+		detector:       detector,
+		defaultResync:  defaultResync,
+		watchers:       map[GroupVersionResourceKind]*watcher{},
+		stopCh:         stopCh,
 	}
 }
 
@@ -33,7 +77,19 @@ func (observer *Observer) Watch(gvrk GroupVersionResourceKind) *watcher {
 	logger.Debugw("subscribed on changes", "resource", gvrk.String())
 
 	watcher := observer.WatcherFor(gvrk)
-	observer.Start()
+	watcher.start()
+
+	return watcher
+}
+
+// WatchMetadata watches only the metadata of the objects of a resource, their
+// payload is never cached. Objects are passed to the handlers with apiVersion,
+// kind and metadata only.
+func (observer *Observer) WatchMetadata(gvrk GroupVersionResourceKind) *watcher {
+	logger.Debugw("subscribed on metadata changes", "resource", gvrk.String())
+
+	watcher := observer.watcherFor(gvrk, true)
+	watcher.start()
 
 	return watcher
 }
@@ -44,7 +100,7 @@ func (observer *Observer) WatchAndWaitForSync(gvrk GroupVersionResourceKind) (*w
 	done := make(chan struct{}, 1)
 
 	go func() {
-		cache.WaitForCacheSync(observer.stopCh, watcher.informer.Informer().HasSynced)
+		cache.WaitForCacheSync(observer.stopCh, watcher.HasSynced)
 		done <- struct{}{}
 	}()
 
@@ -58,44 +114,159 @@ func (observer *Observer) WatchAndWaitForSync(gvrk GroupVersionResourceKind) (*w
 }
 
 func (observer *Observer) WatcherFor(gvrk GroupVersionResourceKind) *watcher {
-	informer := observer.ForResource(gvrk.GroupVersionResource)
+	return observer.watcherFor(gvrk, false)
+}
+
+func (observer *Observer) watcherFor(gvrk GroupVersionResourceKind, metadataOnly bool) *watcher {
+	if !metadataOnly && IsMetadataOnly(gvrk) {
+		logger.Warnw("resource can only be watched by its metadata, downgrading the watch", "resource", gvrk.String())
+		metadataOnly = true
+	}
 
-	return &watcher{
-		gvrk:     gvrk,
-		informer: informer,
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	w, ok := observer.watchers[gvrk]
+	if !ok {
+		w = newWatcher(gvrk, observer, metadataOnly)
+		observer.watchers[gvrk] = w
+	} else if w.metadataOnly != metadataOnly {
+		logger.Warnw(
+			"resource is already watched with a different mode",
+			"resource", gvrk.String(),
+			"metadata_only", w.metadataOnly,
+		)
 	}
+
+	return w
 }
 
 func (observer *Observer) Start() {
-	observer.DynamicSharedInformerFactory.Start(observer.stopCh)
+	for _, w := range observer.getWatchers() {
+		w.start()
+	}
 }
 
 func (observer *Observer) Stop() {
-	observer.stopCh <- struct{}{}
+	observer.stopOnce.Do(func() {
+		close(observer.stopCh)
+	})
+	for _, w := range observer.getWatchers() {
+		w.stop()
+	}
 }
 
-func (observer *Observer) WaitForCacheSync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
+// Pause stops every informer until Resume is called, nothing is listed or watched meanwhile
+func (observer *Observer) Pause() {
+	for _, w := range observer.getWatchers() {
+		w.pause()
+	}
+}
+
+// Resume starts the paused informers again, they list the current state of their resources
+func (observer *Observer) Resume() {
+	for _, w := range observer.getWatchers() {
+		w.resume()
+	}
+}
 
-	finished := make(chan struct{})
+func (observer *Observer) getWatchers() []*watcher {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
 
-	go func() {
-		observer.DynamicSharedInformerFactory.WaitForCacheSync(observer.stopCh)
-		finished <- struct{}{}
-	}()
+	watchers := make([]*watcher, 0, len(observer.watchers))
+	for _, w := range observer.watchers {
+		watchers = append(watchers, w)
+	}
+	return watchers
+}
+
+// SyncStatuses returns the sync status of every watched resource sorted by resource
+func (observer *Observer) SyncStatuses() []SyncStatus {
+	watchers := observer.getWatchers()
+	statuses := make([]SyncStatus, 0, len(watchers))
+	for _, w := range watchers {
+		statuses = append(statuses, w.SyncStatus())
+	}
+	sortSyncStatuses(statuses)
+	return statuses
+}
+
+// MemoryUsage returns the estimated memory held by the cached objects of every watched resource
+func (observer *Observer) MemoryUsage() []MemoryUsage {
+	watchers := observer.getWatchers()
+	usages := make([]MemoryUsage, 0, len(watchers))
+	for _, w := range watchers {
+		usages = append(usages, w.MemoryUsage())
+	}
+	sortMemoryUsages(usages)
+	return usages
+}
+
+// WaitForCacheSync blocks until every watcher is either synced or disabled because
+// of missing permissions. It returns a *CacheSyncError listing the blind resources
+// if some of them are not synced when it returns.
+func (observer *Observer) WaitForCacheSync() error {
+	timeout := time.NewTimer(cacheSyncTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(cacheSyncPollInterval)
+	defer ticker.Stop()
 
 	for {
-		select {
-		case <-finished:
+		settled := true
+		blind := make([]SyncStatus, 0)
+		for _, status := range observer.SyncStatuses() {
+			switch status.State {
+			case SyncStateSynced, SyncStateWarm:
+			case SyncStateForbidden, SyncStatePaused:
+				blind = append(blind, status)
+			default:
+				settled = false
+				blind = append(blind, status)
+			}
+		}
+
+		if settled || !observer.waitTick(ticker, timeout) {
+			if len(blind) > 0 {
+				return &CacheSyncError{Statuses: blind, Timeout: !settled}
+			}
 			return nil
-		case <-ctx.Done():
-			return fmt.Errorf(
-				"timeout waiting for cache sync",
-			)
 		}
 	}
+}
+
+func (observer *Observer) waitTick(ticker *time.Ticker, timeout *time.Timer) bool {
+	select {
+	case <-ticker.C:
+		return true
+	case <-timeout.C:
+		return false
+	case <-observer.stopCh:
+		return false
+	}
+}
 
+// CacheSyncError describes the resources that are not synced after waiting for the cache sync
+type CacheSyncError struct {
+	Statuses []SyncStatus
+	Timeout  bool
+}
+
+func (e *CacheSyncError) Error() string {
+	resources := make([]string, 0, len(e.Statuses))
+	for _, status := range e.Statuses {
+		resource := fmt.Sprintf("%s (%s)", status.Kind, status.State)
+		if status.LastError != "" {
+			resource = fmt.Sprintf("%s (%s: %s)", status.Kind, status.State, status.LastError)
+		}
+		resources = append(resources, resource)
+	}
+
+	reason := "some resources are not synced"
+	if e.Timeout {
+		reason = "timeout waiting for cache sync"
+	}
+	return fmt.Sprintf("%s, blind resources: %s", reason, strings.Join(resources, ", "))
 }
 
 type Watcher interface {
@@ -122,11 +293,461 @@ type Watcher interface {
 	// store. The value returned is not synchronized with access to the underlying store and is not
 	// thread-safe.
 	LastSyncResourceVersion() string
+
+	// SyncStatus returns the sync state and the last list/watch error of the resource
+	SyncStatus() SyncStatus
+
+	// MetadataOnly returns true if only the metadata of the objects is watched and cached
+	MetadataOnly() bool
+}
+
+type handlerRegistration struct {
+	handler      cache.ResourceEventHandler
+	resyncPeriod time.Duration
 }
 
 type watcher struct {
-	gvrk     GroupVersionResourceKind
-	informer informers.GenericInformer
+	gvrk         GroupVersionResourceKind
+	observer     *Observer
+	metadataOnly bool
+
+	mutex    sync.RWMutex
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+	memory   *memoryAccount
+	stopCh   chan struct{}
+	running  bool
+	stopped  bool
+	paused   bool
+	retry    *time.Timer
+	handlers []handlerRegistration
+	status   SyncStatus
+
+	// fromSnapshot is set when the informer is started from a snapshot or from
+	// the objects of the informer it replaced until it lists the current state
+	fromSnapshot bool
+	// cached objects of the replaced informer the new one starts from
+	cached *cachedObjects
+	// relist forces the next watch to fail so the informer lists the current state
+	relist bool
+
+	// generation is increased every time the informer is replaced
+	// so results of stale informers are ignored
+	generation int
+}
+
+func newWatcher(gvrk GroupVersionResourceKind, observer *Observer, metadataOnly bool) *watcher {
+	w := &watcher{
+		gvrk:         gvrk,
+		observer:     observer,
+		metadataOnly: metadataOnly,
+		status: SyncStatus{
+			GroupVersionResourceKind: gvrk,
+			State:                    SyncStatePending,
+		},
+	}
+	w.informer, w.lister, w.memory = w.newInformer()
+	return w
+}
+
+func (w *watcher) newInformer() (cache.SharedIndexInformer, cache.GenericLister, *memoryAccount) {
+	w.generation++
+	generation := w.generation
+	memory := &memoryAccount{}
+	transformer := w.observer.transformer
+	client := w.resourceClient()
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if cached := w.cachedList(generation); cached != nil {
+					return cached, nil
+				}
+				if snapshot := w.snapshotList(generation); snapshot != nil {
+					return snapshot, nil
+				}
+				list, err := client.List(context.TODO(), options)
+				w.onListWatchResult(generation, err)
+				if err != nil {
+					return nil, err
+				}
+				w.onListed(generation)
+				atomic.AddInt64(&memory.pruned, transformer.transformList(list))
+				return list, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if w.shouldRelist(generation) {
+					// the reflector lists again on expired errors without logging them
+					return nil, apierrors.NewResourceExpired("listing the current state after starting from a snapshot")
+				}
+				watcher, err := client.Watch(context.TODO(), options)
+				w.onListWatchResult(generation, err)
+				if err != nil {
+					return nil, err
+				}
+				return transformer.transformWatch(watcher, &memory.pruned), nil
+			},
+		},
+		&unstructured.Unstructured{},
+		w.observer.defaultResync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	// registered first so the accounting is up to date before other handlers are notified
+	informer.AddEventHandler(memory.handler())
+	informer.AddEventHandler(w.observer.Ownership.handler(w.observer.ParentsStore))
+	lister := dynamiclister.NewRuntimeObjectShim(
+		dynamiclister.New(informer.GetIndexer(), w.gvrk.GroupVersionResource),
+	)
+	return informer, lister, memory
+}
+
+func (w *watcher) resourceClient() resourceClient {
+	if w.metadataOnly {
+		return newMetadataResourceClient(w.observer.metadataClient, w.gvrk)
+	}
+	return w.observer.client.Resource(w.gvrk.GroupVersionResource)
+}
+
+// start runs the informer of the watcher, does nothing if it's already running
+func (w *watcher) start() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.running || w.stopped || w.paused || w.status.State == SyncStateForbidden {
+		return
+	}
+	w.run()
+}
+
+// run must be called with the lock held
+func (w *watcher) run() {
+	stopCh := make(chan struct{})
+	w.stopCh = stopCh
+	w.running = true
+
+	informer := w.informer
+	go informer.Run(stopCh)
+	go func() {
+		if cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			w.onSynced(informer)
+		}
+	}()
+}
+
+func (w *watcher) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.stopped = true
+	if w.retry != nil {
+		w.retry.Stop()
+		w.retry = nil
+	}
+	w.halt()
+}
+
+// halt stops the running informer, must be called with the lock held
+func (w *watcher) halt() {
+	if w.running {
+		close(w.stopCh)
+		w.running = false
+	}
+}
+
+func (w *watcher) onSynced(informer cache.SharedIndexInformer) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if informer != w.informer {
+		// a stale informer that has been replaced after a retry
+		return
+	}
+	w.status.NextRetry = time.Time{}
+	if w.fromSnapshot {
+		w.status.State = SyncStateWarm
+		logger.Debugw("resource synced from snapshot", "resource", w.gvrk.String())
+		return
+	}
+	w.status.State = SyncStateSynced
+	w.status.SyncedAt = time.Now()
+	logger.Debugw("resource synced", "resource", w.gvrk.String())
+}
+
+// snapshotList returns the snapshot of the resource on the first list of the watcher if there is one
+func (w *watcher) snapshotList(generation int) *unstructured.UnstructuredList {
+	resource := w.observer.takeSnapshot(w.gvrk, w.metadataOnly)
+	if resource == nil {
+		return nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if generation != w.generation {
+		return nil
+	}
+	w.fromSnapshot = true
+	w.relist = true
+	logger.Infow(
+		"starting from cache snapshot",
+		"resource", w.gvrk.String(),
+		"objects", len(resource.Objects),
+		"resource_version", resource.ResourceVersion,
+	)
+	return resource.list()
+}
+
+// cachedList returns the objects of the replaced informer on the first list of the new one
+func (w *watcher) cachedList(generation int) *unstructured.UnstructuredList {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if generation != w.generation || w.cached == nil {
+		return nil
+	}
+	list := w.cached.list
+	w.cached = nil
+	w.fromSnapshot = true
+	w.relist = true
+	return list
+}
+
+func (w *watcher) shouldRelist(generation int) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if generation != w.generation || !w.relist {
+		return false
+	}
+	w.relist = false
+	return true
+}
+
+// onListed is called after the current state of the resource is listed
+func (w *watcher) onListed(generation int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if generation != w.generation || !w.fromSnapshot {
+		return
+	}
+	w.fromSnapshot = false
+	if w.status.State == SyncStateWarm {
+		w.status.State = SyncStateSynced
+		w.status.SyncedAt = time.Now()
+		logger.Debugw("resource synced", "resource", w.gvrk.String())
+	}
+}
+
+// snapshot returns the masked objects cached by the watcher if it's synced
+func (w *watcher) snapshot() (SnapshotResource, bool) {
+	w.mutex.RLock()
+	informer := w.informer
+	synced := w.status.State == SyncStateSynced
+	w.mutex.RUnlock()
+
+	if !synced {
+		return SnapshotResource{}, false
+	}
+
+	resource := SnapshotResource{
+		GroupVersionResourceKind: w.gvrk,
+		MetadataOnly:             w.metadataOnly,
+		ResourceVersion:          informer.LastSyncResourceVersion(),
+	}
+	items := informer.GetStore().List()
+	resource.Objects = make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		u, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		masked, err := maskUnstructured(u, w.observer.masking)
+		if err != nil {
+			logger.Warnw("unable to mask object, skipping it from snapshot", "resource", w.gvrk.String(), "error", err)
+			continue
+		}
+		resource.Objects = append(resource.Objects, masked.Object)
+	}
+	return resource, true
+}
+
+func (w *watcher) onListWatchResult(generation int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if generation != w.generation || w.paused {
+		return
+	}
+	if err == nil {
+		if w.status.State == SyncStateFailing {
+			w.status.State = SyncStatePending
+		}
+		return
+	}
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+		// the reflector lists again from the latest resource version
+		return
+	}
+
+	w.status.LastError = err.Error()
+	w.status.LastErrorTime = time.Now()
+
+	if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+		w.disable()
+		return
+	}
+	if w.status.State != SyncStateSynced && w.status.State != SyncStateWarm {
+		w.status.State = SyncStateFailing
+	}
+}
+
+// disable stops the informer of a resource the agent isn't allowed to access
+// and schedules a retry. It must be called with the lock held.
+func (w *watcher) disable() {
+	if w.status.State == SyncStateForbidden {
+		return
+	}
+
+	w.halt()
+	w.status.State = SyncStateForbidden
+	w.status.NextRetry = time.Now().Add(forbiddenRetryInterval)
+	w.retry = time.AfterFunc(forbiddenRetryInterval, w.restart)
+
+	logger.Warnw(
+		"missing permissions to watch resource, disabling its watcher",
+		"resource", w.gvrk.String(),
+		"error", w.status.LastError,
+		"retry_at", w.status.NextRetry,
+	)
+}
+
+// restart replaces the informer of a disabled watcher with a new one and
+// registers the existing handlers on it
+func (w *watcher) restart() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.retry = nil
+	if w.stopped || w.paused {
+		return
+	}
+
+	logger.Infow("retrying disabled resource watcher", "resource", w.gvrk.String())
+	w.replaceInformer()
+}
+
+// replaceInformer runs a new informer with the existing handlers, must be called with the lock held.
+// The new informer starts from the objects of the old one, the handlers already know them,
+// and lists the current state right after so the changes missed meanwhile are delivered.
+func (w *watcher) replaceInformer() {
+	cached := newCachedObjects(w.informer)
+	w.informer, w.lister, w.memory = w.newInformer()
+	w.cached = cached
+	for _, registration := range w.handlers {
+		registration.handler = cached.skipAdds(registration.handler)
+		registerHandler(w.informer, registration)
+	}
+	w.status.State = SyncStatePending
+	w.status.NextRetry = time.Time{}
+	w.run()
+}
+
+// pause stops the informer until the watcher is resumed, a disabled watcher isn't retried meanwhile
+func (w *watcher) pause() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.paused || w.stopped {
+		return
+	}
+	w.paused = true
+	if w.retry != nil {
+		w.retry.Stop()
+		w.retry = nil
+	}
+	w.halt()
+	w.status.State = SyncStatePaused
+	w.status.NextRetry = time.Time{}
+}
+
+// resume replaces the informer of a paused watcher, the objects changed while
+// it was paused are passed to the handlers once it lists the current state
+func (w *watcher) resume() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.paused {
+		return
+	}
+	w.paused = false
+	if w.stopped {
+		return
+	}
+	w.replaceInformer()
+}
+
+func registerHandler(informer cache.SharedIndexInformer, registration handlerRegistration) {
+	if registration.resyncPeriod > 0 {
+		informer.AddEventHandlerWithResyncPeriod(registration.handler, registration.resyncPeriod)
+	} else {
+		informer.AddEventHandler(registration.handler)
+	}
+}
+
+// cachedObjects the objects a replaced informer had cached when it was stopped
+type cachedObjects struct {
+	list *unstructured.UnstructuredList
+	// versions resource version of each cached object by key
+	versions map[string]string
+}
+
+func newCachedObjects(informer cache.SharedIndexInformer) *cachedObjects {
+	items := informer.GetStore().List()
+	cached := &cachedObjects{
+		list:     &unstructured.UnstructuredList{Items: make([]unstructured.Unstructured, 0, len(items))},
+		versions: make(map[string]string, len(items)),
+	}
+	cached.list.SetResourceVersion(informer.LastSyncResourceVersion())
+	for _, item := range items {
+		u, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(u)
+		if err != nil {
+			continue
+		}
+		cached.list.Items = append(cached.list.Items, *u)
+		cached.versions[key] = u.GetResourceVersion()
+	}
+	return cached
+}
+
+// skipAdds drops the add events of the cached objects, the handler was
+// notified of them by the replaced informer
+func (cached *cachedObjects) skipAdds(handler cache.ResourceEventHandler) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				key, err := cache.MetaNamespaceKeyFunc(u)
+				if version, found := cached.versions[key]; err == nil && found && version == u.GetResourceVersion() {
+					return
+				}
+			}
+			handler.OnAdd(obj)
+		},
+		UpdateFunc: handler.OnUpdate,
+		DeleteFunc: handler.OnDelete,
+	}
+}
+
+func (w *watcher) addHandler(handler cache.ResourceEventHandler, resyncPeriod time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	registration := handlerRegistration{handler: handler, resyncPeriod: resyncPeriod}
+	w.handlers = append(w.handlers, registration)
+	registerHandler(w.informer, registration)
 }
 
 func (w *watcher) GetGroupVersionResourceKind() GroupVersionResourceKind {
@@ -134,26 +755,56 @@ func (w *watcher) GetGroupVersionResourceKind() GroupVersionResourceKind {
 }
 
 func (w *watcher) Lister() cache.GenericLister {
-	return w.informer.Lister()
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.lister
 }
 
 func (w *watcher) AddEventHandler(handler ResourceEventHandler) {
-	w.informer.Informer().AddEventHandler(wrapHandler(handler, w.gvrk))
+	w.addHandler(wrapHandler(handler, w.gvrk, w.observer.masking, w.observer.detector), 0)
 }
 
 func (w *watcher) AddEventHandlerWithResyncPeriod(handler ResourceEventHandler, resyncPeriod time.Duration) {
-	w.informer.Informer().AddEventHandlerWithResyncPeriod(wrapHandler(handler, w.gvrk), resyncPeriod)
+	w.addHandler(wrapHandler(handler, w.gvrk, w.observer.masking, w.observer.detector), resyncPeriod)
 }
 
 func (w *watcher) HasSynced() bool {
-	return w.informer.Informer().HasSynced()
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.informer.HasSynced()
 }
 
 func (w *watcher) LastSyncResourceVersion() string {
-	return w.informer.Informer().LastSyncResourceVersion()
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.informer.LastSyncResourceVersion()
 }
 
-func wrapHandler(wrapped ResourceEventHandler, gvrk GroupVersionResourceKind) cache.ResourceEventHandler {
+func (w *watcher) MemoryUsage() MemoryUsage {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.memory.usage(w.gvrk)
+}
+
+func (w *watcher) MetadataOnly() bool {
+	return w.metadataOnly
+}
+
+func (w *watcher) SyncStatus() SyncStatus {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.status
+}
+
+func wrapHandler(
+	wrapped ResourceEventHandler,
+	gvrk GroupVersionResourceKind,
+	masking *MaskingPolicy,
+	detector *SecretDetector,
+) cache.ResourceEventHandler {
+	findingsHandler, detect := wrapped.(SecretFindingsHandler)
+	detect = detect && detector != nil
+
 	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			objUn, ok := obj.(*unstructured.Unstructured)
@@ -161,12 +812,20 @@ func wrapHandler(wrapped ResourceEventHandler, gvrk GroupVersionResourceKind) ca
 				logger.Error("unable to cast obj to *Unstructured")
 			}
 			if objUn != nil {
-				objUn, err := maskUnstructured(objUn)
+				var findings []SecretFinding
+				if detect && !isSnapshotMasked(objUn) {
+					// secrets must be detected before their values are masked
+					findings = detector.Detect(objUn)
+				}
+				objUn, err := maskUnstructured(objUn, masking)
 				if err != nil {
 					logger.Errorw("unable to mask Unstructured", "error", err)
 					return
 				}
 				wrapped.OnAdd(gvrk, *objUn)
+				if len(findings) > 0 {
+					findingsHandler.OnSecretFindings(gvrk, *objUn, findings)
+				}
 			}
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
@@ -199,25 +858,39 @@ func wrapHandler(wrapped ResourceEventHandler, gvrk GroupVersionResourceKind) ca
 				}
 			}
 			if oldUn != nil && newUn != nil {
-				oldUn, err := maskUnstructured(oldUn)
+				var findings []SecretFinding
+				changed := false
+				if detect && !isSnapshotMasked(newUn) {
+					findings = detector.Detect(newUn)
+					// the findings of objects read from a snapshot are unknown, they're reported again
+					changed = isSnapshotMasked(oldUn) || !equalSecretFindings(detector.Detect(oldUn), findings)
+				}
+				oldUn, err := maskUnstructured(oldUn, masking)
 				if err != nil {
 					logger.Errorw("unable to mask Unstructured", "error", err)
 				}
-				newUn, err := maskUnstructured(newUn)
+				newUn, err := maskUnstructured(newUn, masking)
 				if err != nil {
 					logger.Errorw("unable to mask Unstructured", "error", err)
 					return
 				}
 				wrapped.OnUpdate(gvrk, *oldUn, *newUn)
+				if changed {
+					findingsHandler.OnSecretFindings(gvrk, *newUn, findings)
+				}
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
+			// objects deleted while the informer wasn't watching come as tombstones
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
 			objUn, ok := obj.(*unstructured.Unstructured)
 			if !ok {
 				logger.Error("unable to cast obj to *Unstructured")
 			}
 			if objUn != nil {
-				objUn, err := maskUnstructured(objUn)
+				objUn, err := maskUnstructured(objUn, masking)
 				if err != nil {
 					logger.Errorw("unable to mask Unstructured", "error", err)
 					return
@@ -234,6 +907,14 @@ type ResourceEventHandler interface {
 	OnDelete(gvrk GroupVersionResourceKind, obj unstructured.Unstructured)
 }
 
+// SecretFindingsHandler can be implemented by a ResourceEventHandler to be notified
+// of the hardcoded secrets found in added and updated objects. It's called after
+// OnAdd and OnUpdate with the masked object only if an added object has findings or
+// the findings of an updated object changed, findings is empty once they're fixed.
+type SecretFindingsHandler interface {
+	OnSecretFindings(gvrk GroupVersionResourceKind, obj unstructured.Unstructured, findings []SecretFinding)
+}
+
 // ResourceEventHandlerFuncs is an adaptor to let you easily specify as many or
 // as few of the notification functions as you want while still implementing
 // ResourceEventHandler.
@@ -0,0 +1,283 @@
+package kuber
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestObserver_ForbiddenResourceIsDisabled(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			Pods.GroupVersionResource:     "PodList",
+			Services.GroupVersionResource: "ServiceList",
+		},
+	)
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(Pods.GroupVersionResource.GroupResource(), "", errors.New("rbac"))
+	})
+
+	observer := NewObserver(
+		client,
+		metadatafake.NewSimpleMetadataClient(runtime.NewScheme()),
+		NewParentsStore(),
+		NewTransformer(DefaultPruneRules),
+		nil,
+		nil,
+		make(chan struct{}),
+		time.Minute,
+	)
+	defer observer.Stop()
+
+	observer.Watch(Pods)
+	observer.Watch(Services)
+
+	err := observer.WaitForCacheSync()
+	var syncErr *CacheSyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("WaitForCacheSync() error = %v, want *CacheSyncError", err)
+	}
+	if syncErr.Timeout {
+		t.Errorf("WaitForCacheSync() timed out, forbidden resources should not block the sync")
+	}
+	if len(syncErr.Statuses) != 1 || syncErr.Statuses[0].Kind != Pods.Kind {
+		t.Fatalf("WaitForCacheSync() blind resources = %+v, want only %s", syncErr.Statuses, Pods.Kind)
+	}
+
+	pods := syncErr.Statuses[0]
+	if pods.State != SyncStateForbidden {
+		t.Errorf("pods state = %s, want %s", pods.State, SyncStateForbidden)
+	}
+	if pods.LastError == "" || pods.NextRetry.IsZero() {
+		t.Errorf("pods status should have the last error and the next retry, got %+v", pods)
+	}
+
+	services := observer.WatcherFor(Services).SyncStatus()
+	if services.State != SyncStateSynced {
+		t.Errorf("services state = %s, want %s", services.State, SyncStateSynced)
+	}
+}
+
+func TestObserver_WatchMetadata(t *testing.T) {
+	scheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+	secret := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: Secrets.Kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db-credentials",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "db"},
+		},
+	}
+
+	observer := NewObserver(
+		fake.NewSimpleDynamicClient(runtime.NewScheme()),
+		metadatafake.NewSimpleMetadataClient(scheme, secret),
+		NewParentsStore(),
+		NewTransformer(DefaultPruneRules),
+		nil,
+		nil,
+		make(chan struct{}),
+		time.Minute,
+	)
+	defer observer.Stop()
+
+	w := observer.WatchMetadata(Secrets)
+	if err := observer.WaitForCacheSync(); err != nil {
+		t.Fatalf("WaitForCacheSync() error = %v", err)
+	}
+	if !w.MetadataOnly() {
+		t.Errorf("MetadataOnly() = false, want true")
+	}
+
+	obj, err := w.Lister().ByNamespace("default").Get("db-credentials")
+	if err != nil {
+		t.Fatalf("unable to get secret from lister, error: %v", err)
+	}
+	u := obj.(*unstructured.Unstructured)
+	if u.GetKind() != Secrets.Kind || u.GetAPIVersion() != "v1" {
+		t.Errorf("got apiVersion %q kind %q, want v1 %s", u.GetAPIVersion(), u.GetKind(), Secrets.Kind)
+	}
+	if u.GetLabels()["app"] != "db" {
+		t.Errorf("labels should be kept, got %v", u.GetLabels())
+	}
+	for key := range u.Object {
+		if key != "apiVersion" && key != "kind" && key != "metadata" {
+			t.Errorf("metadata only object has unexpected field %q", key)
+		}
+	}
+
+	// secret payloads are never watched even if asked to
+	for _, gvrk := range MetadataOnlyResources {
+		if !observer.WatcherFor(gvrk).MetadataOnly() {
+			t.Errorf("%s should only be watched by its metadata", gvrk.Kind)
+		}
+	}
+}
+
+func TestObserver_PauseAndResume(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			Services.GroupVersionResource: "ServiceList",
+		},
+	)
+	observer := NewObserver(
+		client,
+		metadatafake.NewSimpleMetadataClient(runtime.NewScheme()),
+		NewParentsStore(),
+		NewTransformer(DefaultPruneRules),
+		nil,
+		nil,
+		make(chan struct{}),
+		time.Minute,
+	)
+	defer observer.Stop()
+
+	w := observer.Watch(Services)
+	if err := observer.WaitForCacheSync(); err != nil {
+		t.Fatalf("WaitForCacheSync() error = %v", err)
+	}
+	lists := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "list" {
+				count++
+			}
+		}
+		return count
+	}
+
+	observer.Pause()
+	if state := w.SyncStatus().State; state != SyncStatePaused {
+		t.Errorf("state = %s after Pause(), want %s", state, SyncStatePaused)
+	}
+	// a paused watcher isn't started again
+	listed := lists()
+	observer.Watch(Services)
+	if w.SyncStatus().State != SyncStatePaused || lists() != listed {
+		t.Errorf("Watch() restarted a paused watcher")
+	}
+
+	observer.Resume()
+	if err := observer.WaitForCacheSync(); err != nil {
+		t.Fatalf("WaitForCacheSync() after Resume() error = %v", err)
+	}
+	// the resumed watcher starts from its cached objects and lists the current
+	// state after the backoff of the reflector
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) && w.SyncStatus().State != SyncStateSynced {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state := w.SyncStatus().State; state != SyncStateSynced {
+		t.Errorf("state = %s after Resume(), want %s", state, SyncStateSynced)
+	}
+	if lists() <= listed {
+		t.Errorf("resumed watcher should list the current state again")
+	}
+}
+
+func newTestService(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       Services.Kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+		},
+	}}
+}
+
+func TestObserver_ResumeDeliversMissedDeletes(t *testing.T) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			Services.GroupVersionResource: "ServiceList",
+		},
+		newTestService("kept"),
+		newTestService("deleted-while-paused"),
+	)
+	observer := NewObserver(
+		client,
+		metadatafake.NewSimpleMetadataClient(runtime.NewScheme()),
+		NewParentsStore(),
+		NewTransformer(DefaultPruneRules),
+		nil,
+		nil,
+		make(chan struct{}),
+		time.Minute,
+	)
+	defer observer.Stop()
+
+	var (
+		eventsM sync.Mutex
+		adds    = map[string]int{}
+		deletes = map[string]int{}
+	)
+	w := observer.Watch(Services)
+	w.AddEventHandler(ResourceEventHandlerFuncs{
+		Observer: observer,
+		AddFunc: func(gvrk GroupVersionResourceKind, obj unstructured.Unstructured) {
+			eventsM.Lock()
+			defer eventsM.Unlock()
+			adds[obj.GetName()]++
+		},
+		DeleteFunc: func(gvrk GroupVersionResourceKind, obj unstructured.Unstructured) {
+			eventsM.Lock()
+			defer eventsM.Unlock()
+			deletes[obj.GetName()]++
+		},
+	})
+	if err := observer.WaitForCacheSync(); err != nil {
+		t.Fatalf("WaitForCacheSync() error = %v", err)
+	}
+
+	observer.Pause()
+	services := client.Resource(Services.GroupVersionResource).Namespace("default")
+	if err := services.Delete(context.TODO(), "deleted-while-paused", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := services.Create(context.TODO(), newTestService("created-while-paused"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	observer.Resume()
+
+	// the informer lists the current state after the backoff of the reflector
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		eventsM.Lock()
+		done := deletes["deleted-while-paused"] > 0 && adds["created-while-paused"] > 0
+		eventsM.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	eventsM.Lock()
+	defer eventsM.Unlock()
+	if deletes["deleted-while-paused"] != 1 {
+		t.Errorf("objects deleted while paused got %d delete events, want 1", deletes["deleted-while-paused"])
+	}
+	if adds["created-while-paused"] != 1 {
+		t.Errorf("objects created while paused got %d add events, want 1", adds["created-while-paused"])
+	}
+	if adds["kept"] != 1 {
+		t.Errorf("objects known before the pause got %d add events, want 1", adds["kept"])
+	}
+	if _, err := w.Lister().ByNamespace("default").Get("deleted-while-paused"); err == nil {
+		t.Errorf("objects deleted while paused should be removed from the cache")
+	}
+}
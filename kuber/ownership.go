@@ -0,0 +1,416 @@
+package kuber
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// clusterScopedKinds kinds of the well known cluster scoped resources, owner
+// references don't have a namespace so it's used to find where the owner lives
+var clusterScopedKinds = map[string]struct{}{
+	Nodes.Kind:                       {},
+	Namespaces.Kind:                  {},
+	PersistentVolumes.Kind:           {},
+	StorageClasses.Kind:              {},
+	ClusterRoles.Kind:                {},
+	ClusterRoleBindings.Kind:         {},
+	IngressClasses.Kind:              {},
+	"CustomResourceDefinition":       {},
+	"APIService":                     {},
+	"PriorityClass":                  {},
+	"RuntimeClass":                   {},
+	"CSIDriver":                      {},
+	"CSINode":                        {},
+	"VolumeAttachment":               {},
+	"PodSecurityPolicy":              {},
+	"MutatingWebhookConfiguration":   {},
+	"ValidatingWebhookConfiguration": {},
+}
+
+// IsClusterScoped returns true if objects of kind are not namespaced
+func IsClusterScoped(kind string) bool {
+	_, ok := clusterScopedKinds[kind]
+	return ok
+}
+
+// OwnerNamespace returns the namespace of an owner of an object in namespace
+func OwnerNamespace(namespace string, ownerKind string) string {
+	if IsClusterScoped(ownerKind) {
+		return ""
+	}
+	return namespace
+}
+
+// OwnershipNode is an object of the ownership graph
+type OwnershipNode struct {
+	UID        types.UID `json:"uid"`
+	APIVersion string    `json:"api_version"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	// Observed is false for owners only known from the owner references of their children
+	Observed bool `json:"observed"`
+}
+
+func (node OwnershipNode) String() string {
+	if node.Namespace == "" {
+		return fmt.Sprintf("%s %s", node.Kind, node.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", node.Kind, node.Namespace, node.Name)
+}
+
+// OwnershipEdge links an owner to one of the objects it owns
+type OwnershipEdge struct {
+	Owner      types.UID `json:"owner"`
+	Child      types.UID `json:"child"`
+	Controller bool      `json:"controller"`
+}
+
+// OwnershipGraphExport is a snapshot of the ownership graph
+type OwnershipGraphExport struct {
+	Nodes []OwnershipNode `json:"nodes"`
+	Edges []OwnershipEdge `json:"edges"`
+}
+
+// OwnershipGraph keeps the owner references of the watched objects indexed in both
+// directions. Objects may have multiple owners and owners may be cluster scoped.
+// It's updated incrementally by the informers of the observer.
+type OwnershipGraph struct {
+	mutex sync.RWMutex
+
+	nodes map[types.UID]*OwnershipNode
+	// owners edges of every child indexed by the child uid
+	owners map[types.UID][]OwnershipEdge
+	// children uids of the children indexed by the owner uid
+	children map[types.UID]map[types.UID]struct{}
+	// uids indexed by entity key
+	uids map[string]types.UID
+}
+
+func NewOwnershipGraph() *OwnershipGraph {
+	return &OwnershipGraph{
+		nodes:    map[types.UID]*OwnershipNode{},
+		owners:   map[types.UID][]OwnershipEdge{},
+		children: map[types.UID]map[types.UID]struct{}{},
+		uids:     map[string]types.UID{},
+	}
+}
+
+// Add adds an object to the graph or updates its owners if it already exists
+func (g *OwnershipGraph) Add(obj *unstructured.Unstructured) {
+	uid := obj.GetUID()
+	if uid == "" {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	node := OwnershipNode{
+		UID:        uid,
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Observed:   true,
+	}
+	if old, ok := g.nodes[uid]; ok {
+		g.deleteKey(*old)
+	}
+	g.nodes[uid] = &node
+	g.uids[GetEntityKey(node.Namespace, node.Kind, node.Name)] = uid
+
+	g.unlinkOwners(uid)
+	refs := obj.GetOwnerReferences()
+	edges := make([]OwnershipEdge, 0, len(refs))
+	for _, ref := range refs {
+		if _, ok := g.nodes[ref.UID]; !ok {
+			// not observed yet, or not watched at all
+			g.nodes[ref.UID] = &OwnershipNode{
+				UID:        ref.UID,
+				APIVersion: ref.APIVersion,
+				Kind:       ref.Kind,
+				Namespace:  OwnerNamespace(node.Namespace, ref.Kind),
+				Name:       ref.Name,
+			}
+		}
+		edges = append(edges, OwnershipEdge{
+			Owner:      ref.UID,
+			Child:      uid,
+			Controller: ref.Controller != nil && *ref.Controller,
+		})
+		if g.children[ref.UID] == nil {
+			g.children[ref.UID] = map[types.UID]struct{}{}
+		}
+		g.children[ref.UID][uid] = struct{}{}
+	}
+	if len(edges) > 0 {
+		g.owners[uid] = edges
+	}
+}
+
+// Delete removes an object from the graph. Its children are kept, they're
+// removed when they're deleted themselves, usually by the garbage collector.
+func (g *OwnershipGraph) Delete(obj *unstructured.Unstructured) {
+	uid := obj.GetUID()
+	if uid == "" {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	node, ok := g.nodes[uid]
+	if !ok {
+		return
+	}
+	g.deleteKey(*node)
+	g.unlinkOwners(uid)
+
+	if len(g.children[uid]) > 0 {
+		node.Observed = false
+	} else {
+		delete(g.nodes, uid)
+	}
+}
+
+func (g *OwnershipGraph) deleteKey(node OwnershipNode) {
+	key := GetEntityKey(node.Namespace, node.Kind, node.Name)
+	if g.uids[key] == node.UID {
+		delete(g.uids, key)
+	}
+}
+
+// unlinkOwners removes the edges from the owners of uid, owners that are not
+// observed and have no more children are removed. Must be called with the lock held.
+func (g *OwnershipGraph) unlinkOwners(uid types.UID) {
+	for _, edge := range g.owners[uid] {
+		children := g.children[edge.Owner]
+		delete(children, uid)
+		if len(children) > 0 {
+			continue
+		}
+		delete(g.children, edge.Owner)
+		if owner, ok := g.nodes[edge.Owner]; ok && !owner.Observed {
+			delete(g.nodes, edge.Owner)
+		}
+	}
+	delete(g.owners, uid)
+}
+
+// Get returns the node of uid
+func (g *OwnershipGraph) Get(uid types.UID) (OwnershipNode, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	node, ok := g.nodes[uid]
+	if !ok {
+		return OwnershipNode{}, false
+	}
+	return *node, true
+}
+
+// Lookup returns the node of an observed object
+func (g *OwnershipGraph) Lookup(namespace string, kind string, name string) (OwnershipNode, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	uid, ok := g.uids[GetEntityKey(namespace, kind, name)]
+	if !ok {
+		return OwnershipNode{}, false
+	}
+	return *g.nodes[uid], true
+}
+
+// GetOwners returns the direct owners of uid, the controller owner first
+func (g *OwnershipGraph) GetOwners(uid types.UID) []OwnershipNode {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	edges := g.owners[uid]
+	owners := make([]OwnershipNode, 0, len(edges))
+	for _, edge := range edges {
+		if edge.Controller {
+			owners = append([]OwnershipNode{*g.nodes[edge.Owner]}, owners...)
+		} else {
+			owners = append(owners, *g.nodes[edge.Owner])
+		}
+	}
+	return owners
+}
+
+// GetChildren returns the objects directly owned by uid
+func (g *OwnershipGraph) GetChildren(uid types.UID) []OwnershipNode {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	children := make([]OwnershipNode, 0, len(g.children[uid]))
+	for child := range g.children[uid] {
+		children = append(children, *g.nodes[child])
+	}
+	sortOwnershipNodes(children)
+	return children
+}
+
+// GetDescendants returns every object owned directly or indirectly by uid
+func (g *OwnershipGraph) GetDescendants(uid types.UID) []OwnershipNode {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	visited := map[types.UID]struct{}{uid: {}}
+	descendants := make([]OwnershipNode, 0)
+	queue := []types.UID{uid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for child := range g.children[current] {
+			// owner references can form cycles
+			if _, ok := visited[child]; ok {
+				continue
+			}
+			visited[child] = struct{}{}
+			descendants = append(descendants, *g.nodes[child])
+			queue = append(queue, child)
+		}
+	}
+	sortOwnershipNodes(descendants)
+	return descendants
+}
+
+// Export returns a snapshot of the graph sorted by node
+func (g *OwnershipGraph) Export() OwnershipGraphExport {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	export := OwnershipGraphExport{
+		Nodes: make([]OwnershipNode, 0, len(g.nodes)),
+		Edges: make([]OwnershipEdge, 0, len(g.owners)),
+	}
+	for _, node := range g.nodes {
+		export.Nodes = append(export.Nodes, *node)
+	}
+	for _, edges := range g.owners {
+		export.Edges = append(export.Edges, edges...)
+	}
+	sortOwnershipNodes(export.Nodes)
+	sort.Slice(export.Edges, func(i, j int) bool {
+		if export.Edges[i].Owner != export.Edges[j].Owner {
+			return export.Edges[i].Owner < export.Edges[j].Owner
+		}
+		return export.Edges[i].Child < export.Edges[j].Child
+	})
+	return export
+}
+
+// WriteDOT writes the graph in the graphviz DOT format, owners point to their children
+// and non controller owners are dashed
+func (g *OwnershipGraph) WriteDOT(w io.Writer) error {
+	export := g.Export()
+
+	_, err := fmt.Fprintln(w, "digraph ownership {")
+	if err != nil {
+		return err
+	}
+	for _, node := range export.Nodes {
+		style := ""
+		if !node.Observed {
+			style = ", style=dotted"
+		}
+		_, err = fmt.Fprintf(w, "  %q [label=%q%s];\n", node.UID, node.String(), style)
+		if err != nil {
+			return err
+		}
+	}
+	for _, edge := range export.Edges {
+		style := ""
+		if !edge.Controller {
+			style = " [style=dashed]"
+		}
+		_, err = fmt.Fprintf(w, "  %q -> %q%s;\n", edge.Owner, edge.Child, style)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+// handler keeps the graph up to date with the objects of an informer and
+// invalidates the cached parents of objects whose owners changed
+func (g *OwnershipGraph) handler(parentsStore *ParentsStore) cache.ResourceEventHandler {
+	invalidate := func(obj *unstructured.Unstructured) {
+		if parentsStore == nil {
+			return
+		}
+		parentsStore.Delete(obj.GetNamespace(), obj.GetKind(), obj.GetName())
+		for _, node := range g.GetDescendants(obj.GetUID()) {
+			parentsStore.Delete(node.Namespace, node.Kind, node.Name)
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				g.Add(u)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldU, oldOk := oldObj.(*unstructured.Unstructured)
+			newU, newOk := newObj.(*unstructured.Unstructured)
+			if !newOk {
+				return
+			}
+			if oldOk && !ownerReferencesEqual(oldU, newU) {
+				invalidate(newU)
+			}
+			g.Add(newU)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				invalidate(u)
+				g.Delete(u)
+			}
+		},
+	}
+}
+
+func ownerReferencesEqual(a, b *unstructured.Unstructured) bool {
+	aRefs := a.GetOwnerReferences()
+	bRefs := b.GetOwnerReferences()
+	if len(aRefs) != len(bRefs) {
+		return false
+	}
+	for i := range aRefs {
+		aController := aRefs[i].Controller != nil && *aRefs[i].Controller
+		bController := bRefs[i].Controller != nil && *bRefs[i].Controller
+		if aRefs[i].UID != bRefs[i].UID || aController != bController {
+			return false
+		}
+	}
+	return true
+}
+
+func sortOwnershipNodes(nodes []OwnershipNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.UID < b.UID
+	})
+}
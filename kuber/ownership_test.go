@@ -0,0 +1,126 @@
+package kuber
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newOwnedObject(kind, namespace, name, uid string, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(uid))
+	obj.SetOwnerReferences(owners)
+	return obj
+}
+
+func ownerReference(obj *unstructured.Unstructured, controller bool) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+		Controller: &controller,
+	}
+}
+
+func nodeNames(nodes []OwnershipNode) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func TestOwnershipGraph(t *testing.T) {
+	graph := NewOwnershipGraph()
+
+	deployment := newOwnedObject(Deployments.Kind, "default", "web", "deployment")
+	replicaSet := newOwnedObject(ReplicaSets.Kind, "default", "web-1", "replicaset", ownerReference(deployment, true))
+	node := newOwnedObject(Nodes.Kind, "", "node-1", "node")
+	// a pod owned by a replicaset and by a cluster scoped object
+	pod := newOwnedObject(
+		Pods.Kind, "default", "web-1-a", "pod",
+		ownerReference(node, false),
+		ownerReference(replicaSet, true),
+	)
+
+	// children are added before their owners are observed
+	graph.Add(pod)
+	graph.Add(replicaSet)
+
+	owners := graph.GetOwners(pod.GetUID())
+	if got := nodeNames(owners); len(got) != 2 || got[0] != "web-1" || got[1] != "node-1" {
+		t.Fatalf("GetOwners() = %v, want the controller owner first", got)
+	}
+	if owners[1].Namespace != "" || owners[1].Observed {
+		t.Errorf("cluster scoped owner = %+v, want no namespace and not observed", owners[1])
+	}
+	if !strings.Contains(strings.Join(nodeNames(graph.GetDescendants(deployment.GetUID())), ","), "web-1-a") {
+		t.Errorf("GetDescendants() should follow not observed owners")
+	}
+
+	graph.Add(deployment)
+	graph.Add(node)
+
+	if got := nodeNames(graph.GetChildren(node.GetUID())); len(got) != 1 || got[0] != "web-1-a" {
+		t.Errorf("GetChildren(node) = %v, want [web-1-a]", got)
+	}
+	if got := nodeNames(graph.GetDescendants(deployment.GetUID())); len(got) != 2 {
+		t.Errorf("GetDescendants(deployment) = %v, want the replicaset and the pod", got)
+	}
+	if found, ok := graph.Lookup("default", Pods.Kind, "web-1-a"); !ok || found.UID != pod.GetUID() {
+		t.Errorf("Lookup() = %+v, %v", found, ok)
+	}
+
+	var dot bytes.Buffer
+	if err := graph.WriteDOT(&dot); err != nil {
+		t.Fatalf("WriteDOT() error = %v", err)
+	}
+	if !strings.Contains(dot.String(), `"replicaset" -> "pod";`) ||
+		!strings.Contains(dot.String(), `"node" -> "pod" [style=dashed];`) {
+		t.Errorf("WriteDOT() = %s", dot.String())
+	}
+
+	// a deleted owner is kept as long as it has children
+	graph.Delete(replicaSet)
+	if owner, ok := graph.Get(replicaSet.GetUID()); !ok || owner.Observed {
+		t.Errorf("deleted owner with children = %+v, %v, want a not observed node", owner, ok)
+	}
+	graph.Delete(pod)
+	if _, ok := graph.Get(replicaSet.GetUID()); ok {
+		t.Errorf("deleted owner without children should be removed")
+	}
+	if got := graph.GetChildren(node.GetUID()); len(got) != 0 {
+		t.Errorf("GetChildren(node) = %v, want none", nodeNames(got))
+	}
+	if export := graph.Export(); len(export.Nodes) != 2 || len(export.Edges) != 0 {
+		t.Errorf("Export() = %+v, want only the deployment and the node", export)
+	}
+}
+
+func TestGetParents_MultipleOwners(t *testing.T) {
+	deployment := newOwnedObject(Deployments.Kind, "default", "web", "deployment")
+	pod := newOwnedObject(
+		Pods.Kind, "default", "web-a", "pod",
+		ownerReference(newOwnedObject(ConfigMaps.Kind, "default", "config", "configmap"), false),
+		ownerReference(deployment, true),
+	)
+
+	parent, err := GetParents(pod, NewParentsStore(), func(kind string) (Watcher, bool) {
+		return nil, false
+	})
+	if err != nil {
+		t.Fatalf("GetParents() error = %v", err)
+	}
+	if parent == nil || parent.Kind != Deployments.Kind || parent.Name != "web" || parent.IsWatched {
+		t.Errorf("GetParents() = %+v, want the not watched controller owner", parent)
+	}
+}
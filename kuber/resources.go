@@ -116,4 +116,34 @@ var (
 		GroupVersionResource: corev1.SchemeGroupVersion.WithResource("serviceaccounts"),
 		Kind:                 "ServiceAccount",
 	}
+	Secrets = GroupVersionResourceKind{
+		GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"),
+		Kind:                 "Secret",
+	}
+	ConfigMaps = GroupVersionResourceKind{
+		GroupVersionResource: corev1.SchemeGroupVersion.WithResource("configmaps"),
+		Kind:                 "ConfigMap",
+	}
+	Events = GroupVersionResourceKind{
+		GroupVersionResource: corev1.SchemeGroupVersion.WithResource("events"),
+		Kind:                 "Event",
+	}
+
+	// MetadataOnlyResources are only ever watched by their metadata so their
+	// payload is never held in memory, full watches of them are downgraded
+	MetadataOnlyResources = []GroupVersionResourceKind{
+		Secrets,
+		ConfigMaps,
+		Events,
+	}
 )
+
+// IsMetadataOnly returns true if the objects of the resource are only ever watched by their metadata
+func IsMetadataOnly(gvrk GroupVersionResourceKind) bool {
+	for _, resource := range MetadataOnlyResources {
+		if resource == gvrk {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package kuber
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MagalixTechnologies/core/logger"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// SnapshotFileName name of the snapshot file in the snapshots directory
+	SnapshotFileName = "cache-snapshot.json.gz"
+	// snapshotFormatVersion is increased on incompatible changes of the snapshot format
+	snapshotFormatVersion = 1
+	// snapshotMaxAge older snapshots are ignored, most of their resource versions are compacted anyway
+	snapshotMaxAge = 24 * time.Hour
+)
+
+// Snapshot is the last known state of the informers cache. Objects are masked
+// before they're written so secrets never reach the disk.
+type Snapshot struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"created_at"`
+	Resources []SnapshotResource `json:"resources"`
+}
+
+// SnapshotResource the cached objects of a resource and the resource version they were listed at
+type SnapshotResource struct {
+	GroupVersionResourceKind
+	MetadataOnly    bool                     `json:"metadata_only"`
+	ResourceVersion string                   `json:"resource_version"`
+	Objects         []map[string]interface{} `json:"objects"`
+}
+
+// ReadSnapshot reads a gzipped json snapshot
+func ReadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open snapshot file, error: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot file %s, error: %w", path, err)
+	}
+	defer reader.Close()
+
+	var snapshot Snapshot
+	err = json.NewDecoder(reader).Decode(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode snapshot file %s, error: %w", path, err)
+	}
+	if snapshot.Version != snapshotFormatVersion {
+		return nil, fmt.Errorf(
+			"unsupported snapshot version %d, expected %d", snapshot.Version, snapshotFormatVersion,
+		)
+	}
+
+	return &snapshot, nil
+}
+
+// WriteSnapshot writes a gzipped json snapshot, the file is replaced atomically
+// so a crash while writing never leaves a partial snapshot behind
+func WriteSnapshot(path string, snapshot *Snapshot) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot file, error: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	err = json.NewEncoder(writer).Encode(snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to encode snapshot, error: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("unable to compress snapshot, error: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write snapshot file, error: %w", err)
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("unable to replace snapshot file, error: %w", err)
+	}
+	return nil
+}
+
+// Snapshot returns the objects cached by every synced watcher
+func (observer *Observer) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Version:   snapshotFormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Resources: make([]SnapshotResource, 0),
+	}
+
+	for _, w := range observer.getWatchers() {
+		resource, ok := w.snapshot()
+		if ok {
+			snapshot.Resources = append(snapshot.Resources, resource)
+		}
+	}
+	return snapshot
+}
+
+// LoadSnapshot makes the watchers created afterwards start from the objects of
+// the snapshot instead of listing them. The informers relist in the background
+// right after, and the differences are delivered as update and delete events.
+func (observer *Observer) LoadSnapshot(snapshot *Snapshot) error {
+	age := time.Since(snapshot.CreatedAt)
+	if age > snapshotMaxAge {
+		return fmt.Errorf("snapshot is too old, created %s ago", age.Round(time.Second))
+	}
+
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	observer.snapshot = map[GroupVersionResourceKind]*SnapshotResource{}
+	for i := range snapshot.Resources {
+		resource := &snapshot.Resources[i]
+		observer.snapshot[resource.GroupVersionResourceKind] = resource
+	}
+	return nil
+}
+
+// takeSnapshot returns the snapshot of a resource only once, watchers
+// replaced after a retry must list the current state
+func (observer *Observer) takeSnapshot(gvrk GroupVersionResourceKind, metadataOnly bool) *SnapshotResource {
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	resource, ok := observer.snapshot[gvrk]
+	if !ok {
+		return nil
+	}
+	delete(observer.snapshot, gvrk)
+	if resource.MetadataOnly != metadataOnly {
+		return nil
+	}
+	return resource
+}
+
+// WriteSnapshots writes a snapshot to path every interval until the observer is stopped
+func (observer *Observer) WriteSnapshots(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-observer.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		snapshot := observer.Snapshot()
+		err := WriteSnapshot(path, snapshot)
+		if err != nil {
+			logger.Errorw("unable to write cache snapshot", "error", err)
+			continue
+		}
+		logger.Debugw(
+			"cache snapshot written",
+			"resources", len(snapshot.Resources),
+			"duration", time.Since(start),
+		)
+	}
+}
+
+func (resource *SnapshotResource) list() *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{
+		Object: map[string]interface{}{},
+		Items:  make([]unstructured.Unstructured, 0, len(resource.Objects)),
+	}
+	list.SetAPIVersion(resource.GroupVersion().String())
+	list.SetKind(resource.Kind + "List")
+	list.SetResourceVersion(resource.ResourceVersion)
+	for _, obj := range resource.Objects {
+		item := unstructured.Unstructured{Object: obj}
+		// the objects were masked before they were written
+		annotations := item.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[snapshotMaskedAnnotation] = ""
+		item.SetAnnotations(annotations)
+		list.Items = append(list.Items, item)
+	}
+	return list
+}
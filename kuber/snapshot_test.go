@@ -0,0 +1,98 @@
+package kuber
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func newSnapshotTestPod(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       Pods.Kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{},
+	}}
+}
+
+func TestObserver_WarmStartFromSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SnapshotFileName)
+	err := WriteSnapshot(path, &Snapshot{
+		Version:   snapshotFormatVersion,
+		CreatedAt: time.Now(),
+		Resources: []SnapshotResource{{
+			GroupVersionResourceKind: Pods,
+			ResourceVersion:          "10",
+			Objects:                  []map[string]interface{}{newSnapshotTestPod("deleted-while-down").Object},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	snapshot, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{Pods.GroupVersionResource: "PodList"},
+		newSnapshotTestPod("created-while-down"),
+	)
+	observer := NewObserver(
+		client,
+		metadatafake.NewSimpleMetadataClient(runtime.NewScheme()),
+		NewParentsStore(),
+		NewTransformer(DefaultPruneRules),
+		nil,
+		nil,
+		make(chan struct{}),
+		time.Minute,
+	)
+	defer observer.Stop()
+	if err := observer.LoadSnapshot(snapshot); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+
+	w := observer.Watch(Pods)
+	if err := observer.WaitForCacheSync(); err != nil {
+		t.Fatalf("WaitForCacheSync() error = %v", err)
+	}
+	if _, err := w.Lister().ByNamespace("default").Get("deleted-while-down"); err != nil {
+		t.Errorf("objects of the snapshot should be served before the informer lists, error: %v", err)
+	}
+
+	// the informer lists the current state after the backoff of the reflector
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		_, errDeleted := w.Lister().ByNamespace("default").Get("deleted-while-down")
+		_, errCreated := w.Lister().ByNamespace("default").Get("created-while-down")
+		if errDeleted != nil && errCreated == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := w.Lister().ByNamespace("default").Get("deleted-while-down"); err == nil {
+		t.Fatalf("objects deleted since the snapshot should be removed")
+	}
+	if state := w.SyncStatus().State; state != SyncStateSynced {
+		t.Errorf("state = %s, want %s after listing the current state", state, SyncStateSynced)
+	}
+	if _, err := w.Lister().ByNamespace("default").Get("created-while-down"); err != nil {
+		t.Errorf("objects created since the snapshot should be added, error: %v", err)
+	}
+
+	written := observer.Snapshot()
+	if len(written.Resources) != 1 || len(written.Resources[0].Objects) != 1 {
+		t.Errorf("Snapshot() = %+v, want the current pod only", written.Resources)
+	}
+}
@@ -0,0 +1,48 @@
+package kuber
+
+import (
+	"sort"
+	"time"
+)
+
+type SyncState string
+
+const (
+	// SyncStatePending the informer is started and waiting for the first full list
+	SyncStatePending SyncState = "pending"
+	// SyncStateSynced the informer has completed at least one full list
+	SyncStateSynced SyncState = "synced"
+	// SyncStateWarm the informer is serving the objects of a snapshot while it lists the current state
+	SyncStateWarm SyncState = "warm"
+	// SyncStateFailing the informer can't list or watch the resource for a reason other than permissions
+	SyncStateFailing SyncState = "failing"
+	// SyncStateForbidden the agent is not allowed to list or watch the resource,
+	// the informer is stopped and retried on a slow schedule
+	SyncStateForbidden SyncState = "forbidden"
+	// SyncStatePaused the informer is stopped while the agent is suspended,
+	// it lists the current state again once resumed
+	SyncStatePaused SyncState = "paused"
+)
+
+// SyncStatus holds the sync state and the last error of a single watched resource
+type SyncStatus struct {
+	GroupVersionResourceKind
+
+	State         SyncState
+	LastError     string
+	LastErrorTime time.Time
+	SyncedAt      time.Time
+	NextRetry     time.Time
+}
+
+// IsBlind returns true if the agent has no view of the resource,
+// a warm resource may be stale but it's not blind
+func (s SyncStatus) IsBlind() bool {
+	return s.State != SyncStateSynced && s.State != SyncStateWarm
+}
+
+func sortSyncStatuses(statuses []SyncStatus) {
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].String() < statuses[j].String()
+	})
+}
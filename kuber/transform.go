@@ -0,0 +1,187 @@
+package kuber
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/yaml"
+)
+
+// AllKinds matches objects of every kind in a PruneRule
+const AllKinds = "*"
+
+var (
+	// DefaultPruneRules drops the fields that are never audited but often double the size of objects
+	DefaultPruneRules = []PruneRule{
+		{
+			Kind:        AllKinds,
+			Fields:      [][]string{{"metadata", "managedFields"}},
+			Annotations: []string{"kubectl.kubernetes.io/last-applied-configuration"},
+		},
+	}
+)
+
+// PruneRule removes fields from objects of a kind before they are cached
+type PruneRule struct {
+	// Kind the rule applies to, AllKinds applies the rule to every kind
+	Kind string `json:"kind"`
+	// Fields paths of the fields to remove, e.g. [["status", "images"]]
+	Fields [][]string `json:"fields,omitempty"`
+	// Annotations keys of the annotations to remove
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// Transformer prunes objects before they are stored in the informers cache
+type Transformer struct {
+	rules map[string][]PruneRule
+}
+
+func NewTransformer(rules []PruneRule) *Transformer {
+	t := &Transformer{rules: map[string][]PruneRule{}}
+	for _, rule := range rules {
+		t.rules[rule.Kind] = append(t.rules[rule.Kind], rule)
+	}
+	return t
+}
+
+// LoadPruneRules reads prune rules from a yaml or json file
+func LoadPruneRules(path string) ([]PruneRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read prune rules file, error: %w", err)
+	}
+
+	var rules []PruneRule
+	err = yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse prune rules file %s, error: %w", path, err)
+	}
+
+	for i, rule := range rules {
+		if rule.Kind == "" {
+			return nil, fmt.Errorf("prune rule #%d in %s has no kind", i, path)
+		}
+	}
+
+	return rules, nil
+}
+
+// Transform prunes obj in place and returns the estimated number of bytes removed
+func (t *Transformer) Transform(obj *unstructured.Unstructured) int64 {
+	if t == nil || obj == nil {
+		return 0
+	}
+
+	var pruned int64
+	for _, rules := range [][]PruneRule{t.rules[AllKinds], t.rules[obj.GetKind()]} {
+		for _, rule := range rules {
+			pruned += rule.apply(obj)
+		}
+	}
+	return pruned
+}
+
+func (rule PruneRule) apply(obj *unstructured.Unstructured) int64 {
+	var pruned int64
+	for _, field := range rule.Fields {
+		value, found, err := unstructured.NestedFieldNoCopy(obj.Object, field...)
+		if err != nil || !found {
+			continue
+		}
+		pruned += estimateSize(value)
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+
+	if len(rule.Annotations) > 0 {
+		annotations, found, err := unstructured.NestedMap(obj.Object, "metadata", "annotations")
+		if err == nil && found {
+			removed := false
+			for _, key := range rule.Annotations {
+				if value, ok := annotations[key]; ok {
+					pruned += estimateSize(key) + estimateSize(value)
+					delete(annotations, key)
+					removed = true
+				}
+			}
+			if removed {
+				if len(annotations) == 0 {
+					obj.SetAnnotations(nil)
+				} else {
+					obj.SetAnnotations(toStringMap(annotations))
+				}
+			}
+		}
+	}
+
+	return pruned
+}
+
+// transformList prunes every item of a list response
+func (t *Transformer) transformList(list *unstructured.UnstructuredList) int64 {
+	if t == nil || list == nil {
+		return 0
+	}
+
+	var pruned int64
+	for i := range list.Items {
+		pruned += t.Transform(&list.Items[i])
+	}
+	return pruned
+}
+
+// transformWatch prunes the objects of every event of a watch
+func (t *Transformer) transformWatch(w watch.Interface, pruned *int64) watch.Interface {
+	if t == nil || w == nil {
+		return w
+	}
+
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		if obj, ok := in.Object.(*unstructured.Unstructured); ok {
+			atomic.AddInt64(pruned, t.Transform(obj))
+		}
+		return in, true
+	})
+}
+
+func toStringMap(m map[string]interface{}) map[string]string {
+	out := make(map[string]string, len(m))
+	for key, value := range m {
+		if s, ok := value.(string); ok {
+			out[key] = s
+		}
+	}
+	return out
+}
+
+// estimateSize estimates the memory held by a decoded json value.
+// It's an approximation used for accounting, not an exact measurement.
+func estimateSize(value interface{}) int64 {
+	const (
+		headerSize = 16
+		wordSize   = 8
+	)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := int64(headerSize)
+		for key, item := range v {
+			size += headerSize + int64(len(key)) + estimateSize(item)
+		}
+		return size
+	case []interface{}:
+		size := int64(headerSize + wordSize)
+		for _, item := range v {
+			size += estimateSize(item)
+		}
+		return size
+	case string:
+		return headerSize + int64(len(v))
+	case nil:
+		return wordSize
+	default:
+		return headerSize
+	}
+}
@@ -0,0 +1,55 @@
+package kuber
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTransformer_Transform(t *testing.T) {
+	transformer := NewTransformer(append(DefaultPruneRules, PruneRule{
+		Kind:   Nodes.Kind,
+		Fields: [][]string{{"status", "images"}},
+	}))
+
+	newObj := func(kind string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"kind": kind,
+			"metadata": map[string]interface{}{
+				"name":          "obj",
+				"managedFields": []interface{}{map[string]interface{}{"manager": "kubectl"}},
+				"annotations": map[string]interface{}{
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+					"owner": "team-a",
+				},
+			},
+			"status": map[string]interface{}{
+				"images": []interface{}{"nginx"},
+			},
+		}}
+	}
+
+	node := newObj(Nodes.Kind)
+	if pruned := transformer.Transform(node); pruned <= 0 {
+		t.Errorf("Transform() pruned = %d, want > 0", pruned)
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(node.Object, "metadata", "managedFields"); found {
+		t.Errorf("managedFields should be pruned for every kind")
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(node.Object, "status", "images"); found {
+		t.Errorf("status.images should be pruned for nodes")
+	}
+	annotations := node.GetAnnotations()
+	if _, found := annotations["kubectl.kubernetes.io/last-applied-configuration"]; found {
+		t.Errorf("last-applied-configuration annotation should be pruned")
+	}
+	if annotations["owner"] != "team-a" {
+		t.Errorf("other annotations should be kept, got %v", annotations)
+	}
+
+	pod := newObj(Pods.Kind)
+	transformer.Transform(pod)
+	if _, found, _ := unstructured.NestedFieldNoCopy(pod.Object, "status", "images"); !found {
+		t.Errorf("status.images should be kept for pods")
+	}
+}
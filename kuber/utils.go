@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	apisv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -65,6 +66,9 @@ func GetEntityKey(namespace string, kind string, name string) string {
 	return fmt.Sprintf("%s:%s:%s", namespace, kind, name)
 }
 
+// GetParents returns the chain of owners of obj. The controller owner is followed
+// if there is one, otherwise the first owner. Owners are looked up in their own
+// namespace, i.e. cluster scoped owners are looked up without a namespace.
 func GetParents(
 	obj Identifiable,
 	parentsStore *ParentsStore,
@@ -82,39 +86,28 @@ func GetParents(
 		return parents, nil
 	}
 
-	owners := obj.GetOwnerReferences()
-
-	if len(owners) > 1 {
-
-		for i, owner := range owners {
-			errMap[fmt.Sprintf("owner_name_%d", i)] = owner.Name
-			errMap[fmt.Sprintf("owner_kind_%d", i)] = owner.Kind
-			errMap[fmt.Sprintf("owner_api_version_%d", i)] = owner.APIVersion
-		}
-
-		return nil, fmt.Errorf("object has multiple owners with data: %+v", errMap)
-	}
+	owner := controllerOwner(obj.GetOwnerReferences())
 
 	var parent *ParentController
-	for _, owner := range owners {
-		if owner.Controller != nil && *owner.Controller {
-			parent = &ParentController{
-				Kind:       owner.Kind,
-				Name:       owner.Name,
-				APIVersion: owner.APIVersion,
-			}
-
-			watcher, ok := getWatcher(owner.Kind)
-			if !ok {
-				// not watched parent
-				break
-			}
+	if owner != nil {
+		parent = &ParentController{
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			APIVersion: owner.APIVersion,
+		}
 
+		watcher, ok := getWatcher(owner.Kind)
+		if ok {
 			parent.IsWatched = true
 
-			ownerObj, err := watcher.Lister().
-				ByNamespace(obj.GetNamespace()).
-				Get(owner.Name)
+			var ownerObj runtime.Object
+			var err error
+			ownerNamespace := OwnerNamespace(obj.GetNamespace(), owner.Kind)
+			if ownerNamespace == "" {
+				ownerObj, err = watcher.Lister().Get(owner.Name)
+			} else {
+				ownerObj, err = watcher.Lister().ByNamespace(ownerNamespace).Get(owner.Name)
+			}
 			if err != nil {
 				return nil, fmt.Errorf(
 					"unable to get parent owner, error: %w with data %+v", err, errMap,
@@ -141,6 +134,20 @@ func GetParents(
 	return parent, nil
 }
 
+// controllerOwner returns the managing controller of an object
+// or its first owner if none of the owners is a controller
+func controllerOwner(owners []apisv1.OwnerReference) *apisv1.OwnerReference {
+	for i := range owners {
+		if owners[i].Controller != nil && *owners[i].Controller {
+			return &owners[i]
+		}
+	}
+	if len(owners) > 0 {
+		return &owners[0]
+	}
+	return nil
+}
+
 func RootParent(parent *ParentController) *ParentController {
 	if parent == nil {
 		return nil
@@ -1,20 +1,122 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/MagalixCorp/magalix-agent/v3/client"
+	"github.com/MagalixCorp/magalix-agent/v3/kuber"
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
 	"github.com/MagalixTechnologies/core/logger"
 )
 
 const (
-	liveness  = "/live"
-	readiness = "/ready"
+	liveness          = "/live"
+	readiness         = "/ready"
+	resourcesStatus   = "/status/resources"
+	memoryStatus      = "/status/memory"
+	pipeStatus        = "/status/pipe"
+	gatewayStatus     = "/status/gateway"
+	gatewayRetry      = "/gateway/retry"
+	watchdogStatus    = "/status/watchdog"
+	ownershipGraph    = "/debug/ownership"
+	contentTypeJSON   = "application/json"
+	contentTypeDOT    = "text/vnd.graphviz"
+	headerContentType = "Content-Type"
 )
 
 type ProbesServer struct {
 	address string
 
 	IsReady bool
+	// SyncStatuses returns the sync status of every watched resource
+	SyncStatuses func() []kuber.SyncStatus
+	// MemoryUsage returns the estimated memory held by the cached objects of every watched resource
+	MemoryUsage func() []kuber.MemoryUsage
+	// Ownership graph of the watched objects, exported as json or as dot with ?format=dot
+	Ownership *kuber.OwnershipGraph
+	// PipeStats returns the pending and dropped packets of the gateway pipe
+	PipeStats func() client.PipeStats
+	// GatewayStatus returns the state of the connection to the gateway
+	GatewayStatus func() client.ConnectionStatus
+	// RetryGateway connects to the gateway right away if suspended or waiting to reconnect
+	RetryGateway func() error
+	// WatchdogStats returns the liveness and the latency of the connection to the gateway
+	WatchdogStats func() client.WatchdogStats
+}
+
+type gatewayStatusResponse struct {
+	State         string     `json:"state"`
+	NextRetry     *time.Time `json:"next_retry,omitempty"`
+	Connected     bool       `json:"connected"`
+	Authorized    bool       `json:"authorized"`
+	Suspended     bool       `json:"suspended"`
+	Proxy         string     `json:"proxy,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	ProxyError    bool       `json:"proxy_error,omitempty"`
+	Endpoint      string     `json:"endpoint,omitempty"`
+	Endpoints     []endpoint `json:"endpoints,omitempty"`
+	// Capabilities negotiated with the gateway
+	Capabilities *proto.Capabilities `json:"capabilities,omitempty"`
+}
+
+type latencyBucket struct {
+	// LessOrEqual upper bound of the bucket, +Inf for the last one
+	LessOrEqual string `json:"le"`
+	Count       int    `json:"count"`
+}
+
+type watchdogStatusResponse struct {
+	Healthy             bool            `json:"healthy"`
+	Pings               int64           `json:"pings"`
+	Failures            int64           `json:"failures"`
+	SlowPongs           int64           `json:"slow_pongs"`
+	DeadConnections     int64           `json:"dead_connections"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	LastPing            *time.Time      `json:"last_ping,omitempty"`
+	LastLatency         string          `json:"last_latency,omitempty"`
+	P50                 string          `json:"p50,omitempty"`
+	P90                 string          `json:"p90,omitempty"`
+	P99                 string          `json:"p99,omitempty"`
+	Buckets             []latencyBucket `json:"buckets"`
+}
+
+type endpoint struct {
+	URL           string     `json:"url"`
+	Weight        int        `json:"weight,omitempty"`
+	Active        bool       `json:"active"`
+	Failures      int        `json:"failures"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	Latency       string     `json:"latency,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+type resourceStatus struct {
+	Group         string     `json:"group"`
+	Version       string     `json:"version"`
+	Resource      string     `json:"resource"`
+	Kind          string     `json:"kind"`
+	State         string     `json:"state"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	SyncedAt      *time.Time `json:"synced_at,omitempty"`
+	NextRetry     *time.Time `json:"next_retry,omitempty"`
+}
+
+type memoryUsage struct {
+	Kind        string `json:"kind"`
+	Objects     int64  `json:"objects"`
+	Bytes       int64  `json:"bytes"`
+	PrunedBytes int64  `json:"pruned_bytes"`
+}
+
+type memoryStatusResponse struct {
+	TotalObjects int64         `json:"total_objects"`
+	TotalBytes   int64         `json:"total_bytes"`
+	Resources    []memoryUsage `json:"resources"`
 }
 
 func NewProbesServer(address string) *ProbesServer {
@@ -27,6 +129,13 @@ func NewProbesServer(address string) *ProbesServer {
 func (p *ProbesServer) Start() error {
 	http.HandleFunc(liveness, p.livenessProbeHandler)
 	http.HandleFunc(readiness, p.readinessProbeHandler)
+	http.HandleFunc(resourcesStatus, p.resourcesStatusHandler)
+	http.HandleFunc(memoryStatus, p.memoryStatusHandler)
+	http.HandleFunc(pipeStatus, p.pipeStatusHandler)
+	http.HandleFunc(gatewayStatus, p.gatewayStatusHandler)
+	http.HandleFunc(gatewayRetry, p.gatewayRetryHandler)
+	http.HandleFunc(watchdogStatus, p.watchdogStatusHandler)
+	http.HandleFunc(ownershipGraph, p.ownershipGraphHandler)
 
 	logger.Infow("Starting server....", "address", p.address)
 	defer func() {
@@ -41,9 +150,179 @@ func (p *ProbesServer) livenessProbeHandler(w http.ResponseWriter, req *http.Req
 }
 
 func (p *ProbesServer) readinessProbeHandler(w http.ResponseWriter, req *http.Request) {
-	if p.IsReady {
+	// a suspended agent is alive but doesn't do anything, a dead connection is being reconnected
+	if p.IsReady && (p.GatewayStatus == nil || !p.GatewayStatus().Suspended) &&
+		(p.WatchdogStats == nil || p.WatchdogStats().Healthy) {
 		w.WriteHeader(200)
 	} else {
 		w.WriteHeader(503)
 	}
 }
+
+func (p *ProbesServer) resourcesStatusHandler(w http.ResponseWriter, req *http.Request) {
+	statuses := []resourceStatus{}
+	if p.SyncStatuses != nil {
+		for _, status := range p.SyncStatuses() {
+			statuses = append(statuses, resourceStatus{
+				Group:         status.Group,
+				Version:       status.Version,
+				Resource:      status.Resource,
+				Kind:          status.Kind,
+				State:         string(status.State),
+				LastError:     status.LastError,
+				LastErrorTime: timeOrNil(status.LastErrorTime),
+				SyncedAt:      timeOrNil(status.SyncedAt),
+				NextRetry:     timeOrNil(status.NextRetry),
+			})
+		}
+	}
+
+	writeJSON(w, statuses)
+}
+
+func (p *ProbesServer) memoryStatusHandler(w http.ResponseWriter, req *http.Request) {
+	response := memoryStatusResponse{Resources: []memoryUsage{}}
+	if p.MemoryUsage != nil {
+		for _, usage := range p.MemoryUsage() {
+			response.TotalObjects += usage.Objects
+			response.TotalBytes += usage.Bytes
+			response.Resources = append(response.Resources, memoryUsage{
+				Kind:        usage.Kind,
+				Objects:     usage.Objects,
+				Bytes:       usage.Bytes,
+				PrunedBytes: usage.PrunedBytes,
+			})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+func (p *ProbesServer) pipeStatusHandler(w http.ResponseWriter, req *http.Request) {
+	stats := client.PipeStats{Dropped: map[proto.PacketKind]client.DropStats{}}
+	if p.PipeStats != nil {
+		stats = p.PipeStats()
+	}
+
+	writeJSON(w, stats)
+}
+
+func (p *ProbesServer) gatewayStatusHandler(w http.ResponseWriter, req *http.Request) {
+	response := gatewayStatusResponse{}
+	if p.GatewayStatus != nil {
+		status := p.GatewayStatus()
+		response = gatewayStatusResponse{
+			State:         string(status.State),
+			NextRetry:     timeOrNil(status.NextRetry),
+			Connected:     status.Connected,
+			Authorized:    status.Authorized,
+			Suspended:     status.Suspended,
+			Proxy:         status.Proxy,
+			LastError:     status.LastError,
+			LastErrorTime: timeOrNil(status.LastErrorTime),
+			ProxyError:    status.ProxyError,
+			Endpoint:      status.Endpoint,
+			Capabilities:  status.Capabilities,
+		}
+		for _, e := range status.Endpoints {
+			response.Endpoints = append(response.Endpoints, endpoint{
+				URL:           e.URL,
+				Weight:        e.Weight,
+				Active:        e.Active,
+				Failures:      e.Failures,
+				CooldownUntil: timeOrNil(e.CooldownUntil),
+				Latency:       durationOrEmpty(e.Latency),
+				LastError:     e.LastError,
+				LastErrorTime: timeOrNil(e.LastErrorTime),
+			})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+func (p *ProbesServer) watchdogStatusHandler(w http.ResponseWriter, req *http.Request) {
+	response := watchdogStatusResponse{Healthy: true, Buckets: []latencyBucket{}}
+	if p.WatchdogStats != nil {
+		stats := p.WatchdogStats()
+		response = watchdogStatusResponse{
+			Healthy:             stats.Healthy,
+			Pings:               stats.Pings,
+			Failures:            stats.Failures,
+			SlowPongs:           stats.SlowPongs,
+			DeadConnections:     stats.DeadConnections,
+			ConsecutiveFailures: stats.ConsecutiveFailures,
+			LastPing:            timeOrNil(stats.LastPing),
+			LastLatency:         durationOrEmpty(stats.LastLatency),
+			P50:                 durationOrEmpty(stats.P50),
+			P90:                 durationOrEmpty(stats.P90),
+			P99:                 durationOrEmpty(stats.P99),
+			Buckets:             make([]latencyBucket, 0, len(stats.Buckets)),
+		}
+		for _, bucket := range stats.Buckets {
+			le := "+Inf"
+			if bucket.UpperBound > 0 {
+				le = bucket.UpperBound.String()
+			}
+			response.Buckets = append(response.Buckets, latencyBucket{LessOrEqual: le, Count: bucket.Count})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+func (p *ProbesServer) gatewayRetryHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.RetryGateway == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err := p.RetryGateway(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *ProbesServer) ownershipGraphHandler(w http.ResponseWriter, req *http.Request) {
+	graph := p.Ownership
+	if graph == nil {
+		graph = kuber.NewOwnershipGraph()
+	}
+
+	if req.URL.Query().Get("format") == "dot" {
+		w.Header().Set(headerContentType, contentTypeDOT)
+		err := graph.WriteDOT(w)
+		if err != nil {
+			logger.Errorw("unable to write ownership graph", "error", err)
+		}
+		return
+	}
+
+	writeJSON(w, graph.Export())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set(headerContentType, contentTypeJSON)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.Errorw("unable to write probes server response", "error", err)
+	}
+}
+
+func durationOrEmpty(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,121 @@
+package proto
+
+import "errors"
+
+// ErrUnsupportedKind the gateway said it doesn't accept packets of this kind
+var ErrUnsupportedKind = errors.New("packet kind not accepted by the agent gateway")
+
+const (
+	EncodingJSON        = "json"
+	EncodingProtobuf    = "protobuf"
+	CompressionNone     = "none"
+	CompressionSnappy   = "snappy"
+	CompressionZstd     = "zstd"
+	CompressionZstdDict = "zstd-dict"
+
+	// FeaturePacketV2 the gateway understands the v2 packet layout
+	FeaturePacketV2 = "packet_v2"
+	// FeatureEnvelope piped packets are wrapped in a PacketEnvelope and acknowledged
+	FeatureEnvelope = "envelope"
+	// FeatureDeltaPatches entities deltas may carry a json merge patch instead of the entity
+	FeatureDeltaPatches = "delta_patches"
+	// FeatureChunking packets bigger than MaxPacketSize are split in chunks
+	FeatureChunking = "chunking"
+)
+
+// Capabilities packet kinds, encodings, compression and features supported by
+// one side of the connection, lists are in order of preference
+type Capabilities struct {
+	Kinds       []PacketKind `json:"kinds"`
+	Encodings   []string     `json:"encodings"`
+	Compression []string     `json:"compression"`
+	Features    []string     `json:"features"`
+	// ProtobufKinds packet kinds encoded as protobuf when it's the negotiated
+	// encoding, the other kinds are encoded as json
+	ProtobufKinds []PacketKind `json:"protobuf_kinds,omitempty"`
+	// ZstdDictionaryID id of the dictionary used by the zstd-dict compression,
+	// it's only negotiated if both sides have the same dictionary
+	ZstdDictionaryID uint32 `json:"zstd_dictionary_id,omitempty"`
+	// MaxPacketSize max size of an encoded packet, the smallest one of both sides is used
+	MaxPacketSize int `json:"max_packet_size,omitempty"`
+}
+
+// Negotiate returns the capabilities supported by both sides in the order of preference of c
+func (c Capabilities) Negotiate(other Capabilities) Capabilities {
+	negotiated := Capabilities{}
+	for _, kind := range c.Kinds {
+		if other.HasKind(kind) {
+			negotiated.Kinds = append(negotiated.Kinds, kind)
+		}
+	}
+	negotiated.Encodings = intersect(c.Encodings, other.Encodings)
+	for _, kind := range c.ProtobufKinds {
+		if other.HasProtobufKind(kind) {
+			negotiated.ProtobufKinds = append(negotiated.ProtobufKinds, kind)
+		}
+	}
+	negotiated.Compression = intersect(c.Compression, other.Compression)
+	if c.ZstdDictionaryID == other.ZstdDictionaryID {
+		negotiated.ZstdDictionaryID = c.ZstdDictionaryID
+	} else {
+		negotiated.Compression = remove(negotiated.Compression, CompressionZstdDict)
+	}
+	negotiated.Features = intersect(c.Features, other.Features)
+	negotiated.MaxPacketSize = c.MaxPacketSize
+	if other.MaxPacketSize > 0 && (c.MaxPacketSize == 0 || other.MaxPacketSize < c.MaxPacketSize) {
+		negotiated.MaxPacketSize = other.MaxPacketSize
+	}
+	return negotiated
+}
+
+func (c Capabilities) HasKind(kind PacketKind) bool {
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// HasProtobufKind returns true if packets of kind can be encoded as protobuf
+func (c Capabilities) HasProtobufKind(kind PacketKind) bool {
+	for _, k := range c.ProtobufKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Capabilities) HasFeature(feature string) bool {
+	return contains(c.Features, feature)
+}
+
+func intersect(preferred []string, other []string) []string {
+	var items []string
+	for _, item := range preferred {
+		if contains(other, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func remove(items []string, item string) []string {
+	var kept []string
+	for _, i := range items {
+		if i != item {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
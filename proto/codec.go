@@ -0,0 +1,266 @@
+package proto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const zstdDictionaryMagic = 0xEC30A437
+
+// Encoding turns packets into bytes
+type Encoding interface {
+	Name() string
+	Marshal(in interface{}) ([]byte, error)
+	Unmarshal(data []byte, out interface{}) error
+}
+
+// Compressor compresses encoded packets
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsM     sync.RWMutex
+	encodings   = map[string]Encoding{}
+	compressors = map[string]Compressor{}
+)
+
+func init() {
+	RegisterEncoding(jsonEncoding{})
+	RegisterEncoding(protobufEncoding{})
+	RegisterCompressor(noCompressor{})
+	RegisterCompressor(snappyCompressor{})
+
+	zstdCompressor, err := NewZstdCompressor(nil)
+	if err != nil {
+		panic(err)
+	}
+	RegisterCompressor(zstdCompressor)
+}
+
+// RegisterEncoding makes an encoding available to codecs, it replaces any encoding with the same name
+func RegisterEncoding(encoding Encoding) {
+	codecsM.Lock()
+	defer codecsM.Unlock()
+	encodings[encoding.Name()] = encoding
+}
+
+// RegisterCompressor makes a compressor available to codecs, it replaces any compressor with the same name
+func RegisterCompressor(compressor Compressor) {
+	codecsM.Lock()
+	defer codecsM.Unlock()
+	compressors[compressor.Name()] = compressor
+}
+
+// Codec encodes then compresses packets
+type Codec struct {
+	Encoding   Encoding
+	Compressor Compressor
+}
+
+// DefaultCodec json and snappy, used before anything is negotiated
+var DefaultCodec = Codec{Encoding: jsonEncoding{}, Compressor: snappyCompressor{}}
+
+// ChunkCodec protobuf without compression, chunks are always sent with it as
+// their data is encoded and compressed already, it's part of the chunking feature
+var ChunkCodec = Codec{Encoding: protobufEncoding{}, Compressor: noCompressor{}}
+
+// GetCodec returns the codec made of the registered encoding and compressor
+func GetCodec(encoding string, compression string) (Codec, error) {
+	codecsM.RLock()
+	defer codecsM.RUnlock()
+	e, ok := encodings[encoding]
+	if !ok {
+		return Codec{}, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	c, ok := compressors[compression]
+	if !ok {
+		return Codec{}, fmt.Errorf("unknown compression %q", compression)
+	}
+	return Codec{Encoding: e, Compressor: c}, nil
+}
+
+// JSON returns the codec with the json encoding and the compressor of c, it's used
+// for the kinds that weren't negotiated to be encoded as protobuf
+func (c Codec) JSON() Codec {
+	return Codec{Encoding: jsonEncoding{}, Compressor: c.Compressor}
+}
+
+func (c Codec) String() string {
+	return c.Encoding.Name() + "+" + c.Compressor.Name()
+}
+
+func (c Codec) Encode(in interface{}) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := string(debug.Stack())
+			err = fmt.Errorf("%s panic: %v", stack, r)
+		}
+	}()
+
+	data, err := c.Encoding.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode to %s, error: %w", c.Encoding.Name(), err)
+	}
+	return c.Compressor.Compress(data)
+}
+
+func (c Codec) Decode(in []byte, out interface{}) error {
+	data, err := c.Compressor.Decompress(in)
+	if err != nil {
+		return fmt.Errorf("unable to decompress %s, error: %w", c.Compressor.Name(), err)
+	}
+	return c.Encoding.Unmarshal(data, out)
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) Name() string {
+	return EncodingJSON
+}
+
+func (jsonEncoding) Marshal(in interface{}) ([]byte, error) {
+	return json.Marshal(in)
+}
+
+func (jsonEncoding) Unmarshal(data []byte, out interface{}) error {
+	return json.Unmarshal(data, out)
+}
+
+// ProtoMarshaler a packet with a protobuf definition in pb/packets.proto
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoUnmarshaler a packet with a protobuf definition in pb/packets.proto
+type ProtoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+// protobufEncoding encodes the packets having a protobuf definition, it's only
+// used for the kinds negotiated in Capabilities.ProtobufKinds
+type protobufEncoding struct{}
+
+func (protobufEncoding) Name() string {
+	return EncodingProtobuf
+}
+
+func (protobufEncoding) Marshal(in interface{}) ([]byte, error) {
+	message, ok := in.(ProtoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%T has no protobuf definition", in)
+	}
+	return message.MarshalProto()
+}
+
+func (protobufEncoding) Unmarshal(data []byte, out interface{}) error {
+	message, ok := out.(ProtoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%T has no protobuf definition", out)
+	}
+	return message.UnmarshalProto(data)
+}
+
+type noCompressor struct{}
+
+func (noCompressor) Name() string {
+	return CompressionNone
+}
+
+func (noCompressor) Compress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (noCompressor) Decompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return CompressionSnappy
+}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// ZstdCompressor compresses with zstd, with a dictionary trained on typical
+// packets, e.g. with zstd --train, if it's given one
+type ZstdCompressor struct {
+	dictionaryID uint32
+	encoder      *zstd.Encoder
+	decoder      *zstd.Decoder
+}
+
+// NewZstdCompressor creates a zstd compressor, named zstd-dict if dictionary isn't empty
+func NewZstdCompressor(dictionary []byte) (*ZstdCompressor, error) {
+	// concurrent EncodeAll and DecodeAll calls wait for each other, it keeps the memory low
+	encoderOptions := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	decoderOptions := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	compressor := &ZstdCompressor{}
+	if len(dictionary) > 0 {
+		id, err := ZstdDictionaryID(dictionary)
+		if err != nil {
+			return nil, err
+		}
+		compressor.dictionaryID = id
+		encoderOptions = append(encoderOptions, zstd.WithEncoderDict(dictionary))
+		decoderOptions = append(decoderOptions, zstd.WithDecoderDicts(dictionary))
+	}
+
+	var err error
+	compressor.encoder, err = zstd.NewWriter(nil, encoderOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create zstd encoder, error: %w", err)
+	}
+	compressor.decoder, err = zstd.NewReader(nil, decoderOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create zstd decoder, error: %w", err)
+	}
+	return compressor, nil
+}
+
+// ZstdDictionaryID returns the id of a zstd dictionary, both sides must use the same one
+func ZstdDictionaryID(dictionary []byte) (uint32, error) {
+	if len(dictionary) < 8 || binary.LittleEndian.Uint32(dictionary) != zstdDictionaryMagic {
+		return 0, fmt.Errorf("invalid zstd dictionary")
+	}
+	id := binary.LittleEndian.Uint32(dictionary[4:])
+	if id == 0 {
+		return 0, fmt.Errorf("zstd dictionary has no id")
+	}
+	return id, nil
+}
+
+func (c *ZstdCompressor) Name() string {
+	if c.dictionaryID != 0 {
+		return CompressionZstdDict
+	}
+	return CompressionZstd
+}
+
+// DictionaryID id of the dictionary of the compressor, zero without one
+func (c *ZstdCompressor) DictionaryID() uint32 {
+	return c.dictionaryID
+}
+
+func (c *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
@@ -0,0 +1,272 @@
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MagalixTechnologies/uuid-go"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// deploymentSpec a deployment as the auditor sees it
+func deploymentSpec(i int) map[string]interface{} {
+	name := fmt.Sprintf("service-%d", i)
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "production",
+			"uid":             uuid.NewV4().String(),
+			"resourceVersion": fmt.Sprint(100000 + i),
+			"labels":          map[string]interface{}{"app": name, "team": "payments", "tier": "backend"},
+			"annotations": map[string]interface{}{
+				"deployment.kubernetes.io/revision": "12",
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 3,
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": name}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": name}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  name,
+							"image": fmt.Sprintf("registry.example.com/payments/%s:1.%d.0", name, i),
+							"ports": []interface{}{map[string]interface{}{"containerPort": 8080, "protocol": "TCP"}},
+							"env": []interface{}{
+								map[string]interface{}{"name": "LOG_LEVEL", "value": "info"},
+								map[string]interface{}{"name": "DATABASE_HOST", "value": "postgres.production.svc"},
+							},
+							"resources": map[string]interface{}{
+								"limits":   map[string]interface{}{"cpu": "500m", "memory": "512Mi"},
+								"requests": map[string]interface{}{"cpu": "250m", "memory": "256Mi"},
+							},
+							"securityContext": map[string]interface{}{"runAsNonRoot": true, "readOnlyRootFilesystem": false},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func auditResultRequest(items int) PacketAuditResultRequest {
+	packet := PacketAuditResultRequest{Timestamp: time.Now().UTC()}
+	for i := 0; i < items; i++ {
+		packet.Items = append(packet.Items, &PacketAuditResultItem{
+			Id:            uuid.NewV4().String(),
+			TemplateID:    stringPtr(uuid.NewV4().String()),
+			ConstraintID:  stringPtr(uuid.NewV4().String()),
+			CategoryID:    stringPtr("security"),
+			Severity:      stringPtr("high"),
+			Controls:      []string{"PCI-DSS 2.2", "CIS 5.2.6"},
+			Standards:     []string{"PCI-DSS", "CIS"},
+			Description:   "Containers should not run with a writable root filesystem",
+			HowToSolve:    "Set securityContext.readOnlyRootFilesystem to true",
+			Status:        AuditResultStatusViolating,
+			Msg:           stringPtr("container has a writable root filesystem"),
+			EntityName:    stringPtr(fmt.Sprintf("service-%d", i%50)),
+			EntityKind:    stringPtr("Deployment"),
+			NamespaceName: stringPtr("production"),
+			EntitySpec:    deploymentSpec(i % 50),
+			Trigger:       "Audit",
+			CorrelationID: uuid.NewV4().String(),
+		})
+	}
+	return packet
+}
+
+func entitiesDeltasRequest(items int) PacketEntitiesDeltasRequest {
+	packet := PacketEntitiesDeltasRequest{Timestamp: time.Now().UTC()}
+	for i := 0; i < items; i++ {
+		delta := PacketEntityDelta{
+			Gvrk: GroupVersionResourceKind{
+				GroupVersionResource: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				Kind:                 "Deployment",
+			},
+			DeltaKind: EntityEventTypeUpsert,
+			Namespace: "production",
+			Name:      fmt.Sprintf("service-%d", i),
+			Timestamp: time.Now().UTC(),
+			Data:      deploymentSpec(i),
+		}
+		if i%3 == 0 {
+			delta.DeltaKind = EntityEventTypePatch
+			delta.Data = nil
+			delta.Patch = json.RawMessage(`{"spec":{"replicas":4}}`)
+			delta.BaseResourceVersion = fmt.Sprint(100000 + i)
+		}
+		packet.Items = append(packet.Items, delta)
+	}
+	return packet
+}
+
+func codecs(t testing.TB) []Codec {
+	var all []Codec
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf} {
+		for _, compression := range []string{CompressionNone, CompressionSnappy, CompressionZstd} {
+			codec, err := GetCodec(encoding, compression)
+			if err != nil {
+				t.Fatalf("GetCodec() error = %v", err)
+			}
+			all = append(all, codec)
+		}
+	}
+	return all
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	// json turns numbers into float64, compare with what json gives back
+	normalize := func(in interface{}, out interface{}) {
+		data, _ := json.Marshal(in)
+		_ = json.Unmarshal(data, out)
+	}
+
+	audit := auditResultRequest(20)
+	deltas := entitiesDeltasRequest(20)
+	var wantAudit PacketAuditResultRequest
+	var wantDeltas PacketEntitiesDeltasRequest
+	normalize(audit, &wantAudit)
+	normalize(deltas, &wantDeltas)
+
+	for _, codec := range codecs(t) {
+		t.Run(codec.String(), func(t *testing.T) {
+			data, err := codec.Encode(audit)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			var gotAudit PacketAuditResultRequest
+			err = codec.Decode(data, &gotAudit)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotAudit, wantAudit) {
+				t.Errorf("audit results changed after a round trip")
+			}
+
+			data, err = codec.Encode(deltas)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			var gotDeltas PacketEntitiesDeltasRequest
+			err = codec.Decode(data, &gotDeltas)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotDeltas, wantDeltas) {
+				t.Errorf("entities deltas changed after a round trip")
+			}
+
+			// packets without a protobuf definition are only encoded as json
+			data, err = codec.Encode(PacketLogLevel{Level: "debug"})
+			if codec.Encoding.Name() == EncodingProtobuf {
+				if err == nil {
+					t.Errorf("Encode() of a packet without a protobuf definition should fail")
+				}
+				data, err = codec.JSON().Encode(PacketLogLevel{Level: "debug"})
+			}
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			var level PacketLogLevel
+			err = codec.JSON().Decode(data, &level)
+			if err != nil || level.Level != "debug" {
+				t.Errorf("Decode() = %+v, %v", level, err)
+			}
+		})
+	}
+}
+
+func TestProtobuf_Envelope(t *testing.T) {
+	envelope := PacketEnvelope{ID: uuid.NewV4(), Stream: uuid.NewV4(), Sequence: 12, Attempt: 3, Proto: []byte{1, 2, 3}}
+	data, err := envelope.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto() error = %v", err)
+	}
+	var got PacketEnvelope
+	err = got.UnmarshalProto(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, envelope) {
+		t.Errorf("UnmarshalProto() = %+v, want %+v", got, envelope)
+	}
+
+	expiry := time.Now().UTC().Truncate(time.Second)
+	chunk := PacketChunk{ID: uuid.NewV4(), Kind: PacketKindAuditResultRequest, Index: 1, Count: 3, Size: 300, Expiry: &expiry, Data: []byte{4, 5}}
+	data, _ = ChunkCodec.Encode(chunk)
+	var gotChunk PacketChunk
+	err = ChunkCodec.Decode(data, &gotChunk)
+	if err != nil || !reflect.DeepEqual(gotChunk, chunk) {
+		t.Errorf("Decode() = %+v, %v, want %+v", gotChunk, err, chunk)
+	}
+
+	// empty optional strings are kept apart from missing ones
+	item := PacketAuditResultItem{Msg: stringPtr("")}
+	data, _ = item.MarshalProto()
+	var gotItem PacketAuditResultItem
+	_ = gotItem.UnmarshalProto(data)
+	if gotItem.Msg == nil || *gotItem.Msg != "" || gotItem.Severity != nil {
+		t.Errorf("UnmarshalProto() msg = %v, severity = %v", gotItem.Msg, gotItem.Severity)
+	}
+}
+
+func TestZstdDictionaryID(t *testing.T) {
+	for _, dictionary := range [][]byte{nil, []byte("not a dictionary"), {0x37, 0xa4, 0x30, 0xec, 0, 0, 0, 0}} {
+		if _, err := ZstdDictionaryID(dictionary); err == nil {
+			t.Errorf("ZstdDictionaryID(%v) should fail", dictionary)
+		}
+	}
+	id, err := ZstdDictionaryID([]byte{0x37, 0xa4, 0x30, 0xec, 42, 0, 0, 0})
+	if err != nil || id != 42 {
+		t.Errorf("ZstdDictionaryID() = %d, %v, want 42", id, err)
+	}
+}
+
+// BenchmarkCodecs compares the size and the cpu time of the codecs, run with
+// go test -bench Codecs -benchmem ./proto
+func BenchmarkCodecs(b *testing.B) {
+	payloads := []struct {
+		name   string
+		packet interface{}
+		out    func() interface{}
+	}{
+		{"audit-results", auditResultRequest(200), func() interface{} { return &PacketAuditResultRequest{} }},
+		{"entities-deltas", entitiesDeltasRequest(100), func() interface{} { return &PacketEntitiesDeltasRequest{} }},
+	}
+
+	for _, payload := range payloads {
+		raw, _ := json.Marshal(payload.packet)
+		for _, codec := range codecs(b) {
+			data, err := codec.Encode(payload.packet)
+			if err != nil {
+				b.Fatalf("Encode() error = %v", err)
+			}
+			name := payload.name + "/" + codec.String()
+
+			b.Run(name+"/encode", func(b *testing.B) {
+				b.SetBytes(int64(len(raw)))
+				for i := 0; i < b.N; i++ {
+					_, _ = codec.Encode(payload.packet)
+				}
+				b.ReportMetric(float64(len(data)), "wire-bytes")
+				b.ReportMetric(float64(len(raw))/float64(len(data)), "ratio")
+			})
+			b.Run(name+"/decode", func(b *testing.B) {
+				b.SetBytes(int64(len(raw)))
+				for i := 0; i < b.N; i++ {
+					_ = codec.Decode(data, payload.out())
+				}
+			})
+		}
+	}
+}
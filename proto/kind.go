@@ -15,6 +15,11 @@ const (
 	PacketKindAuditResultRequest   PacketKind = "audit/result"
 	PacketKindAuditCommand         PacketKind = "audit/audit_command"
 	PacketKindPing                 PacketKind = "ping"
+	PacketKindSyncStatusRequest    PacketKind = "entities/sync_status"
+	PacketKindEntitiesDeltas       PacketKind = "entities/deltas"
+	PacketKindChunk                PacketKind = "chunk"
+	PacketKindCommand              PacketKind = "command"
+	PacketKindCommandResult        PacketKind = "command/result"
 )
 
 func (kind PacketKind) String() string {
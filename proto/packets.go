@@ -4,12 +4,9 @@ package proto
 
 import (
 	"encoding/json"
-	"fmt"
-	"runtime/debug"
 	"time"
 
 	"github.com/MagalixTechnologies/uuid-go"
-	"github.com/golang/snappy"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -19,6 +16,7 @@ const (
 	ResourceRequirementKindDefaultFromLimits                  = "default-from-limits"
 	EntityEventTypeUpsert                     EntityDeltaKind = "UPSERT"
 	EntityEventTypeDelete                     EntityDeltaKind = "DELETE"
+	EntityEventTypePatch                      EntityDeltaKind = "PATCH"
 	AuditResultStatusViolating                                = "Violation"
 	AuditResultStatusCompliant                                = "Compliance"
 	AuditResultStatusIgnored                                  = "Ignored"
@@ -35,6 +33,11 @@ type PacketHello struct {
 	ServerVersion    string    `json:"server_version"`
 	AgentPermissions string    `json:"agent_permissions"`
 	ClusterProvider  string    `json:"cluster_provider"`
+	// EnvelopeEnabled piped packets are wrapped in a PacketEnvelope and acknowledged,
+	// only used if the gateway says so in its hello too
+	EnvelopeEnabled bool `json:"envelope_enabled,omitempty"`
+	// Capabilities what the agent supports, the gateway replies with what it accepts
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
 }
 
 type PacketAuthorizationRequest struct {
@@ -58,6 +61,46 @@ type PacketBye struct {
 	Reason string `json:"reason,omitempty"`
 }
 
+// PacketEnvelope wraps a piped packet so the gateway can drop the retries of
+// a packet it already processed and detect the packets that never arrived
+type PacketEnvelope struct {
+	// ID stays the same across retries of the packet
+	ID uuid.UUID `json:"id"`
+	// Stream identifies the pipe that numbered the packet, sequences are per stream and kind
+	Stream   uuid.UUID `json:"stream"`
+	Sequence uint64    `json:"sequence"`
+	// Attempt starts at one and is incremented on every retry
+	Attempt int             `json:"attempt"`
+	Data    json.RawMessage `json:"data"`
+	// Proto the packet encoded with its protobuf definition instead of Data, only
+	// set if the protobuf encoding is negotiated
+	Proto []byte `json:"proto,omitempty"`
+}
+
+// PacketChunk a part of a packet bigger than the negotiated max packet size,
+// the response to the last chunk is the response to the whole packet
+type PacketChunk struct {
+	// ID identifies the chunks of an encoding of a packet, it's derived from the
+	// id and the attempt of the envelope if any
+	ID   uuid.UUID  `json:"id"`
+	Kind PacketKind `json:"kind"`
+	// Index of the chunk starting at zero, chunks are sent in order
+	Index int `json:"index"`
+	Count int `json:"count"`
+	// Size of the whole encoded packet
+	Size int `json:"size"`
+	// Expiry time after which the received chunks can be dropped, nil if the packet never expires
+	Expiry *time.Time `json:"expiry,omitempty"`
+	Data   []byte     `json:"data"`
+}
+
+// PacketAck acknowledges an enveloped packet
+type PacketAck struct {
+	ID uuid.UUID `json:"id"`
+	// Duplicate the packet was already processed on a previous attempt
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
 type PacketPing struct {
 	Number  int       `json:"number,omitempty"`
 	Started time.Time `json:"started"`
@@ -91,6 +134,38 @@ type PacketRestart struct {
 	Status int `json:"status"`
 }
 
+// PacketCommand a command to run, its progress and result are sent back in
+// PacketCommandResult packets with the same id
+type PacketCommand struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Timeout overrides the default timeout of the command if set
+	Timeout time.Duration   `json:"timeout,omitempty"`
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+type CommandState string
+
+const (
+	// CommandStateAccepted the command is queued, it's the answer to PacketCommand
+	CommandStateAccepted  CommandState = "accepted"
+	CommandStateRunning   CommandState = "running"
+	CommandStateSucceeded CommandState = "succeeded"
+	CommandStateFailed    CommandState = "failed"
+)
+
+type PacketCommandResult struct {
+	ID         uuid.UUID       `json:"id"`
+	Name       string          `json:"name"`
+	State      CommandState    `json:"state"`
+	Progress   int             `json:"progress,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
 // PacketLogLevel used to change current log level
 type PacketLogLevel struct {
 	Level string `json:"level"`
@@ -136,6 +211,23 @@ type PacketAuditResultItem struct {
 	ParentKind    *string                `json:"parent_kind,omitempty"`
 	EntitySpec    map[string]interface{} `json:"entity_spec"`
 	Trigger       string                 `json:"trigger"`
+	// CorrelationID id of the audit command the result was produced by
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// PacketAuditCommand audits the resources matching all the filters set,
+// everything is audited if none is
+type PacketAuditCommand struct {
+	Namespaces    []string `json:"namespaces,omitempty"`
+	Kinds         []string `json:"kinds,omitempty"`
+	LabelSelector string   `json:"label_selector,omitempty"`
+	Names         []string `json:"names,omitempty"`
+	ConstraintIDs []string `json:"constraint_ids,omitempty"`
+}
+
+type PacketAuditCommandResponse struct {
+	// CorrelationID set on the results of the audit
+	CorrelationID string `json:"correlation_id"`
 }
 
 type PacketAuditResultRequest struct {
@@ -171,35 +263,87 @@ type PacketConstraintItem struct {
 	DeletedAt  *string   `json:"deleted_at,omitempty"`
 }
 
+// PacketSimulateRequest evaluates constraints against the cluster without installing them
+type PacketSimulateRequest struct {
+	Constraints []PacketConstraintItem `json:"constraints"`
+	// SampleSize max number of violating resources returned per constraint
+	SampleSize int `json:"sample_size,omitempty"`
+}
+
+type PacketSimulationSample struct {
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Msg       string `json:"msg,omitempty"`
+}
+
+type PacketConstraintSimulation struct {
+	ConstraintID string `json:"constraint_id"`
+	Name         string `json:"name"`
+	// Error why the constraint couldn't be evaluated at all
+	Error     string                   `json:"error,omitempty"`
+	Matched   int                      `json:"matched"`
+	Violating int                      `json:"violating"`
+	Compliant int                      `json:"compliant"`
+	Errors    int                      `json:"errors"`
+	Samples   []PacketSimulationSample `json:"samples,omitempty"`
+}
+
+type PacketSimulateResponse struct {
+	// Resources number of resources evaluated
+	Resources   int                          `json:"resources"`
+	Constraints []PacketConstraintSimulation `json:"constraints"`
+}
+
 type PacketConstraintsRequest struct {
 	Timestamp   time.Time              `json:"timestamp"`
 	Constraints []PacketConstraintItem `json:"constraints"`
 }
 
-type PacketConstraintsResponse struct{}
+type PacketConstraintsResponse struct {
+	// Errors why constraints couldn't be added by their id
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type PacketSyncStatusItem struct {
+	GroupVersionResourceKind
+	State         string     `json:"state"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	SyncedAt      *time.Time `json:"synced_at,omitempty"`
+	NextRetry     *time.Time `json:"next_retry,omitempty"`
+}
 
-func EncodeSnappy(in interface{}) (out []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			stack := string(debug.Stack())
-			err = fmt.Errorf("%s panic: %v", stack, r)
-		}
-	}()
+// PacketSyncStatusRequest reports which resources the agent can and can't see
+type PacketSyncStatusRequest struct {
+	Items     []PacketSyncStatusItem `json:"items"`
+	Timestamp time.Time              `json:"timestamp"`
+}
 
-	jsonIn, err := json.Marshal(in)
-	if err != nil {
-		return nil, fmt.Errorf("unable to encode to snappy, error: %w", err)
-	}
-	out = snappy.Encode(nil, jsonIn)
-	return out, err
+// PacketEntityDelta is either a full entity or, for PATCH deltas,
+// a json merge patch to apply on the version BaseResourceVersion of the entity
+type PacketEntityDelta struct {
+	Gvrk                GroupVersionResourceKind `json:"gvrk"`
+	DeltaKind           EntityDeltaKind          `json:"delta_kind"`
+	Data                map[string]interface{}   `json:"data,omitempty"`
+	Patch               json.RawMessage          `json:"patch,omitempty"`
+	BaseResourceVersion string                   `json:"base_resource_version,omitempty"`
+	Namespace           string                   `json:"namespace,omitempty"`
+	Name                string                   `json:"name"`
+	Timestamp           time.Time                `json:"timestamp"`
+}
+
+type PacketEntitiesDeltasRequest struct {
+	Items     []PacketEntityDelta `json:"items"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+func EncodeSnappy(in interface{}) (out []byte, err error) {
+	return DefaultCodec.Encode(in)
 }
 
 func DecodeSnappy(in []byte, out interface{}) error {
-	jsonIn, err := snappy.Decode(nil, in)
-	if err != nil {
-		return fmt.Errorf("unable to decode to snappy, error: %w", err)
-	}
-	return json.Unmarshal(jsonIn, out)
+	return DefaultCodec.Decode(in, out)
 }
 
 func DecodeJSON(in []byte, out interface{}) error {
@@ -0,0 +1,5 @@
+// Package pb the types generated from packets.proto, run go generate with
+// protoc and protoc-gen-go v1.27.1 in the PATH after changing it
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative packets.proto
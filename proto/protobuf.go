@@ -0,0 +1,364 @@
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto/pb"
+	"github.com/MagalixTechnologies/uuid-go"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ProtobufKinds the kinds of the packets with a protobuf definition, they're
+// converted to and from the types generated from pb/packets.proto. Envelopes
+// and acks take the encoding of the kind they're sent for.
+var ProtobufKinds = []PacketKind{
+	PacketKindAuditResultRequest,
+	PacketKindEntitiesDeltas,
+}
+
+// UnmarshalPacketJSON decodes the json data of a packet of kind, the packets of
+// ProtobufKinds are decoded into their types so they can be encoded as protobuf
+// again, the data of the other kinds is kept as is
+func UnmarshalPacketJSON(kind PacketKind, data json.RawMessage) (interface{}, error) {
+	var packet interface{}
+	switch kind {
+	case PacketKindAuditResultRequest:
+		packet = &PacketAuditResultRequest{}
+	case PacketKindEntitiesDeltas:
+		packet = &PacketEntitiesDeltasRequest{}
+	default:
+		return data, nil
+	}
+	err := json.Unmarshal(data, packet)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s packet, error: %w", kind, err)
+	}
+	return packet, nil
+}
+
+func uuidBytes(id uuid.UUID) []byte {
+	if id.IsNil() {
+		return nil
+	}
+	return id.Bytes()
+}
+
+func uuidFromBytes(data []byte) (uuid.UUID, error) {
+	if len(data) == 0 {
+		return uuid.Nil, nil
+	}
+	return uuid.FromBytes(data)
+}
+
+// unixNano the zero time is encoded as zero so it's omitted
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec).UTC()
+}
+
+// newStruct encodes fields with no fixed schema as a google.protobuf.Struct
+func newStruct(value map[string]interface{}) (*structpb.Struct, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return structpb.NewStruct(value)
+}
+
+func structMap(value *structpb.Struct) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.AsMap()
+}
+
+func (gvrk GroupVersionResourceKind) toProto() *pb.GroupVersionResourceKind {
+	return &pb.GroupVersionResourceKind{
+		Group:    gvrk.Group,
+		Version:  gvrk.Version,
+		Resource: gvrk.Resource,
+		Kind:     gvrk.Kind,
+	}
+}
+
+func (gvrk *GroupVersionResourceKind) fromProto(message *pb.GroupVersionResourceKind) {
+	gvrk.Group = message.GetGroup()
+	gvrk.Version = message.GetVersion()
+	gvrk.Resource = message.GetResource()
+	gvrk.Kind = message.GetKind()
+}
+
+func (packet PacketEnvelope) MarshalProto() ([]byte, error) {
+	return protobuf.Marshal(&pb.PacketEnvelope{
+		Id:       uuidBytes(packet.ID),
+		Stream:   uuidBytes(packet.Stream),
+		Sequence: packet.Sequence,
+		Attempt:  int64(packet.Attempt),
+		Data:     packet.Data,
+		Proto:    packet.Proto,
+	})
+}
+
+func (packet *PacketEnvelope) UnmarshalProto(data []byte) (err error) {
+	var message pb.PacketEnvelope
+	err = protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	packet.ID, err = uuidFromBytes(message.Id)
+	if err != nil {
+		return fmt.Errorf("invalid id, error: %w", err)
+	}
+	packet.Stream, err = uuidFromBytes(message.Stream)
+	if err != nil {
+		return fmt.Errorf("invalid stream, error: %w", err)
+	}
+	packet.Sequence = message.Sequence
+	packet.Attempt = int(message.Attempt)
+	packet.Data = message.Data
+	packet.Proto = message.Proto
+	return nil
+}
+
+func (packet PacketChunk) MarshalProto() ([]byte, error) {
+	message := &pb.PacketChunk{
+		Id:    uuidBytes(packet.ID),
+		Kind:  string(packet.Kind),
+		Index: uint32(packet.Index),
+		Count: uint32(packet.Count),
+		Size:  uint64(packet.Size),
+		Data:  packet.Data,
+	}
+	if packet.Expiry != nil {
+		message.Expiry = unixNano(*packet.Expiry)
+	}
+	return protobuf.Marshal(message)
+}
+
+func (packet *PacketChunk) UnmarshalProto(data []byte) (err error) {
+	var message pb.PacketChunk
+	err = protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	packet.ID, err = uuidFromBytes(message.Id)
+	if err != nil {
+		return fmt.Errorf("invalid id, error: %w", err)
+	}
+	packet.Kind = PacketKind(message.Kind)
+	packet.Index = int(message.Index)
+	packet.Count = int(message.Count)
+	packet.Size = int(message.Size)
+	if message.Expiry != 0 {
+		expiry := fromUnixNano(message.Expiry)
+		packet.Expiry = &expiry
+	}
+	packet.Data = message.Data
+	return nil
+}
+
+func (packet PacketAck) MarshalProto() ([]byte, error) {
+	return protobuf.Marshal(&pb.PacketAck{
+		Id:        uuidBytes(packet.ID),
+		Duplicate: packet.Duplicate,
+	})
+}
+
+func (packet *PacketAck) UnmarshalProto(data []byte) (err error) {
+	var message pb.PacketAck
+	err = protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	packet.ID, err = uuidFromBytes(message.Id)
+	if err != nil {
+		return fmt.Errorf("invalid id, error: %w", err)
+	}
+	packet.Duplicate = message.Duplicate
+	return nil
+}
+
+func (item *PacketAuditResultItem) toProto() (*pb.PacketAuditResultItem, error) {
+	spec, err := newStruct(item.EntitySpec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode entity spec, error: %w", err)
+	}
+	return &pb.PacketAuditResultItem{
+		Id:            item.Id,
+		TemplateId:    item.TemplateID,
+		ConstraintId:  item.ConstraintID,
+		CategoryId:    item.CategoryID,
+		Severity:      item.Severity,
+		Controls:      item.Controls,
+		Standards:     item.Standards,
+		Description:   item.Description,
+		HowToSolve:    item.HowToSolve,
+		Status:        string(item.Status),
+		Msg:           item.Msg,
+		EntityName:    item.EntityName,
+		EntityKind:    item.EntityKind,
+		NamespaceName: item.NamespaceName,
+		ParentName:    item.ParentName,
+		ParentKind:    item.ParentKind,
+		Trigger:       item.Trigger,
+		CorrelationId: item.CorrelationID,
+		EntitySpec:    spec,
+	}, nil
+}
+
+func (item *PacketAuditResultItem) fromProto(message *pb.PacketAuditResultItem) {
+	item.Id = message.Id
+	item.TemplateID = message.TemplateId
+	item.ConstraintID = message.ConstraintId
+	item.CategoryID = message.CategoryId
+	item.Severity = message.Severity
+	item.Controls = message.Controls
+	item.Standards = message.Standards
+	item.Description = message.Description
+	item.HowToSolve = message.HowToSolve
+	item.Status = AuditResultStatus(message.Status)
+	item.Msg = message.Msg
+	item.EntityName = message.EntityName
+	item.EntityKind = message.EntityKind
+	item.NamespaceName = message.NamespaceName
+	item.ParentName = message.ParentName
+	item.ParentKind = message.ParentKind
+	item.Trigger = message.Trigger
+	item.CorrelationID = message.CorrelationId
+	item.EntitySpec = structMap(message.EntitySpec)
+}
+
+func (item *PacketAuditResultItem) MarshalProto() ([]byte, error) {
+	message, err := item.toProto()
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.Marshal(message)
+}
+
+func (item *PacketAuditResultItem) UnmarshalProto(data []byte) error {
+	var message pb.PacketAuditResultItem
+	err := protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	item.fromProto(&message)
+	return nil
+}
+
+func (packet PacketAuditResultRequest) MarshalProto() ([]byte, error) {
+	message := &pb.PacketAuditResultRequest{
+		Items:     make([]*pb.PacketAuditResultItem, 0, len(packet.Items)),
+		Timestamp: unixNano(packet.Timestamp),
+	}
+	for _, item := range packet.Items {
+		itemMessage, err := item.toProto()
+		if err != nil {
+			return nil, err
+		}
+		message.Items = append(message.Items, itemMessage)
+	}
+	return protobuf.Marshal(message)
+}
+
+func (packet *PacketAuditResultRequest) UnmarshalProto(data []byte) error {
+	var message pb.PacketAuditResultRequest
+	err := protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	for _, itemMessage := range message.Items {
+		item := &PacketAuditResultItem{}
+		item.fromProto(itemMessage)
+		packet.Items = append(packet.Items, item)
+	}
+	packet.Timestamp = fromUnixNano(message.Timestamp)
+	return nil
+}
+
+func (delta PacketEntityDelta) toProto() (*pb.PacketEntityDelta, error) {
+	data, err := newStruct(delta.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode entity, error: %w", err)
+	}
+	return &pb.PacketEntityDelta{
+		Gvrk:                delta.Gvrk.toProto(),
+		DeltaKind:           string(delta.DeltaKind),
+		Patch:               delta.Patch,
+		BaseResourceVersion: delta.BaseResourceVersion,
+		Namespace:           delta.Namespace,
+		Name:                delta.Name,
+		Timestamp:           unixNano(delta.Timestamp),
+		Data:                data,
+	}, nil
+}
+
+func (delta *PacketEntityDelta) fromProto(message *pb.PacketEntityDelta) {
+	delta.Gvrk.fromProto(message.Gvrk)
+	delta.DeltaKind = EntityDeltaKind(message.DeltaKind)
+	delta.Patch = message.Patch
+	delta.BaseResourceVersion = message.BaseResourceVersion
+	delta.Namespace = message.Namespace
+	delta.Name = message.Name
+	delta.Timestamp = fromUnixNano(message.Timestamp)
+	delta.Data = structMap(message.Data)
+}
+
+func (delta PacketEntityDelta) MarshalProto() ([]byte, error) {
+	message, err := delta.toProto()
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.Marshal(message)
+}
+
+func (delta *PacketEntityDelta) UnmarshalProto(data []byte) error {
+	var message pb.PacketEntityDelta
+	err := protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	delta.fromProto(&message)
+	return nil
+}
+
+func (packet PacketEntitiesDeltasRequest) MarshalProto() ([]byte, error) {
+	message := &pb.PacketEntitiesDeltasRequest{
+		Items:     make([]*pb.PacketEntityDelta, 0, len(packet.Items)),
+		Timestamp: unixNano(packet.Timestamp),
+	}
+	for _, item := range packet.Items {
+		itemMessage, err := item.toProto()
+		if err != nil {
+			return nil, err
+		}
+		message.Items = append(message.Items, itemMessage)
+	}
+	return protobuf.Marshal(message)
+}
+
+func (packet *PacketEntitiesDeltasRequest) UnmarshalProto(data []byte) error {
+	var message pb.PacketEntitiesDeltasRequest
+	err := protobuf.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	for _, itemMessage := range message.Items {
+		item := PacketEntityDelta{}
+		item.fromProto(itemMessage)
+		packet.Items = append(packet.Items, item)
+	}
+	packet.Timestamp = fromUnixNano(message.Timestamp)
+	return nil
+}
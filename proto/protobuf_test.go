@@ -0,0 +1,156 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto/pb"
+	"github.com/MagalixTechnologies/uuid-go"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// checkProtoFields fails if m has unknown fields or doesn't have every field
+// of its definition set, messages are checked recursively
+func checkProtoFields(t *testing.T, m protoreflect.Message) {
+	t.Helper()
+	name := m.Descriptor().FullName()
+	if unknown := m.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s has fields missing from packets.proto: %v", name, unknown)
+	}
+	if name.Parent() != "magalix.agent" {
+		return
+	}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !m.Has(field) {
+			t.Errorf("%s.%s isn't encoded", name, field.Name())
+			continue
+		}
+		if field.Message() == nil {
+			continue
+		}
+		if field.IsList() {
+			list := m.Get(field).List()
+			for j := 0; j < list.Len(); j++ {
+				checkProtoFields(t, list.Get(j).Message())
+			}
+		} else {
+			checkProtoFields(t, m.Get(field).Message())
+		}
+	}
+}
+
+type protoMessageCodec interface {
+	ProtoMarshaler
+	ProtoUnmarshaler
+}
+
+func TestProtobuf_MatchesDefinitions(t *testing.T) {
+	expiry := time.Unix(0, time.Now().UnixNano()).UTC()
+	spec := map[string]interface{}{
+		"kind":     "Deployment",
+		"metadata": map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": "web"}},
+		"spec":     map[string]interface{}{"replicas": 3.0, "paused": false, "args": []interface{}{"--port", 8080.0, nil}},
+	}
+	item := &PacketAuditResultItem{
+		Id:            "1",
+		TemplateID:    stringPtr("template"),
+		ConstraintID:  stringPtr("constraint"),
+		CategoryID:    stringPtr("category"),
+		Severity:      stringPtr("high"),
+		Controls:      []string{"control"},
+		Standards:     []string{"standard"},
+		Description:   "description",
+		HowToSolve:    "how to solve",
+		Status:        AuditResultStatusViolating,
+		Msg:           stringPtr("msg"),
+		EntityName:    stringPtr("web"),
+		EntityKind:    stringPtr("Deployment"),
+		NamespaceName: stringPtr("default"),
+		ParentName:    stringPtr("parent"),
+		ParentKind:    stringPtr("Parent"),
+		EntitySpec:    spec,
+		Trigger:       "periodic",
+		CorrelationID: "correlation",
+	}
+	delta := PacketEntityDelta{
+		Gvrk: GroupVersionResourceKind{
+			GroupVersionResource: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			Kind:                 "Deployment",
+		},
+		DeltaKind:           EntityEventTypeUpsert,
+		Data:                spec,
+		Patch:               []byte(`{"spec":{"replicas":3}}`),
+		BaseResourceVersion: "10",
+		Namespace:           "default",
+		Name:                "web",
+		Timestamp:           expiry,
+	}
+
+	tests := []struct {
+		name      string
+		message   protoMessageCodec
+		generated protobuf.Message
+		decoded   protoMessageCodec
+	}{
+		{
+			"PacketEnvelope",
+			&PacketEnvelope{ID: uuid.NewV4(), Stream: uuid.NewV4(), Sequence: 1, Attempt: 2, Data: []byte(`{}`), Proto: []byte{1}},
+			&pb.PacketEnvelope{},
+			&PacketEnvelope{},
+		},
+		{
+			"PacketChunk",
+			&PacketChunk{ID: uuid.NewV4(), Kind: PacketKindEntitiesDeltas, Index: 1, Count: 2, Size: 3, Expiry: &expiry, Data: []byte{1}},
+			&pb.PacketChunk{},
+			&PacketChunk{},
+		},
+		{"PacketAck", &PacketAck{ID: uuid.NewV4(), Duplicate: true}, &pb.PacketAck{}, &PacketAck{}},
+		{"PacketAuditResultItem", item, &pb.PacketAuditResultItem{}, &PacketAuditResultItem{}},
+		{
+			"PacketAuditResultRequest",
+			&PacketAuditResultRequest{Items: []*PacketAuditResultItem{item}, Timestamp: expiry},
+			&pb.PacketAuditResultRequest{},
+			&PacketAuditResultRequest{},
+		},
+		{"PacketEntityDelta", &delta, &pb.PacketEntityDelta{}, &PacketEntityDelta{}},
+		{
+			"PacketEntitiesDeltasRequest",
+			&PacketEntitiesDeltasRequest{Items: []PacketEntityDelta{delta}, Timestamp: expiry},
+			&pb.PacketEntitiesDeltasRequest{},
+			&PacketEntitiesDeltasRequest{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.message.MarshalProto()
+			if err != nil {
+				t.Fatalf("MarshalProto() error = %v", err)
+			}
+
+			// every field of the packet is set in the generated message
+			m := tt.generated
+			err = protobuf.Unmarshal(data, m)
+			if err != nil {
+				t.Fatalf("the generated message can't decode the encoded packet, error: %v", err)
+			}
+			checkProtoFields(t, m.ProtoReflect())
+
+			encoded, err := protobuf.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			err = tt.decoded.UnmarshalProto(encoded)
+			if err != nil {
+				t.Fatalf("UnmarshalProto() of the packets.proto encoding error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.decoded, tt.message) {
+				t.Errorf("UnmarshalProto() = %+v, want %+v", tt.decoded, tt.message)
+			}
+		})
+	}
+}
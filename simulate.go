@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/MagalixCorp/magalix-agent/v3/proto"
+)
+
+// runSimulate sends the constraints of the file to the agent running on the
+// same host and prints how many resources they would flag, e.g.
+//
+//	kubectl exec deploy/magalix-agent -- /agent simulate constraints.json
+func runSimulate(args map[string]interface{}) error {
+	path := args["<constraints-file>"].(string)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read constraints, error: %w", err)
+	}
+	request := proto.PacketSimulateRequest{}
+	err = json.Unmarshal(data, &request.Constraints)
+	if err != nil {
+		return fmt.Errorf("constraints file must be a json array of constraints, error: %w", err)
+	}
+	if sampleSize, ok := args["--sample-size"].(string); ok {
+		request.SampleSize, err = strconv.Atoi(sampleSize)
+		if err != nil {
+			return fmt.Errorf("invalid --sample-size, error: %w", err)
+		}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%s%s", args["--admin-port"].(string), auditSimulate)
+	res, err := http.Post(url, contentTypeJSON, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to reach the agent, error: %w", err)
+	}
+	defer res.Body.Close()
+
+	response, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("simulation failed with status %d: %s", res.StatusCode, bytes.TrimSpace(response))
+	}
+
+	var out bytes.Buffer
+	err = json.Indent(&out, response, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}